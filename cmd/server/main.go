@@ -6,15 +6,23 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"text/tabwriter"
+	"time"
 
 	"github.com/namsral/flag"
 	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/dataset"
+	"github.com/renanrv/line-server/pkg/diagnostics"
 	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/health"
+	"github.com/renanrv/line-server/pkg/metrics"
 	"github.com/renanrv/line-server/pkg/middlewares"
+	"github.com/renanrv/line-server/pkg/source"
 	"github.com/renanrv/line-server/services"
+	"github.com/renanrv/line-server/services/handler"
 	"github.com/rs/cors"
 	"github.com/rs/zerolog"
 	zlog "github.com/rs/zerolog/log"
@@ -22,12 +30,17 @@ import (
 
 const baseURL = ""
 
+// extendedIndexPersistInterval limits how often the extended index of a dataset is persisted to its index file,
+// as lines may be appended to the file on every poll and the whole index file is rewritten.
+const extendedIndexPersistInterval = time.Minute
+
 func main() {
 	// Define flags
 	fs := flag.NewFlagSet("line-server", flag.ExitOnError)
 
 	var (
-		debugAddr          = fs.String("debug_addr", ":8081", "debug and metrics listen address")
+		debugAddr          = fs.String("debug_addr", ":8081", "debug and metrics listen address, empty to disable it")
+		debugProfiling     = fs.Bool("debug_profiling", true, "expose pprof profiles and goroutine dumps on debug_addr")
 		httpAddr           = fs.String("http_addr", ":8080", "the address that will expose the server API")
 		corsAllowedOrigins = fs.String("cors_allowed_origins", "http://localhost:8080",
 			"comma separated list of allowed origins")
@@ -37,6 +50,64 @@ func main() {
 		maxIndexes = fs.Int("max_indexes", 0, "the maximum number of indexes to generate, "+
 			"taking into account the limited memory available. If 0, it will use all available memory. If "+
 			"negative, it will not generate any indexes.")
+		indexWorkers = fs.Int("index_workers", 0, "the number of workers scanning the file concurrently "+
+			"to generate the index. If 0, it will use the number of CPUs.")
+		accessPointSpacing = fs.Int64("access_point_spacing", fileprocessing.DefaultAccessPointSpacing, "the number "+
+			"of decompressed bytes between the access points of gzip and zstd compressed files, from which their "+
+			"lines are decompressed. Smaller spacings serve lines faster but keep more access points in memory.")
+		persistIndex = fs.Bool("persist_index", true, "persist the generated index to an index file "+
+			"and load it at startup instead of generating it again while the file is unchanged")
+		indexMode = fs.String("index_mode", string(fileprocessing.IndexModeMemory), "where the index is stored: "+
+			"memory, for a sparse index limited by the available memory, or mmap, for a dense index of every line "+
+			"in a memory-mapped index file")
+		indexPath = fs.String("index_path", "", "the path to the index file. If empty, the index file is "+
+			"stored alongside the file with the .idx extension")
+		maxLineSize = fs.Int("max_line_size", handler.DefaultMaxLineSize, "the maximum size in bytes of a served "+
+			"line. Longer lines are reported as too long.")
+		lineDelimiter = fs.String("line_delimiter", string(fileprocessing.DelimiterAuto), "the line delimiter of "+
+			"the file: auto, to detect it from the beginning of the file, lf, crlf, nul or a single byte")
+		maxBatchSize = fs.Int("max_batch_size", handler.DefaultMaxBatchSize, "the maximum number of line "+
+			"indices of a batch request")
+		maxOpenFiles = fs.Int("max_open_files", dataset.DefaultMaxOpenFiles, "the maximum number of descriptors "+
+			"of the file kept open and shared by the requests. Requests wait for a descriptor once all are in use.")
+		remoteCacheSize = fs.Int64("remote_cache_size", 64*1024*1024, "the maximum size in bytes of the cache of "+
+			"the blocks fetched from the remote file of each dataset of a URL. If 0, it is disabled.")
+		remoteRetries = fs.Int("remote_retries", 3, "the number of times a request to the remote file of a dataset "+
+			"of a URL is retried once it fails with a network error or a transient status, with an exponential backoff")
+		lineCacheSize = fs.Int64("line_cache_size", 32*1024*1024, "the maximum size in bytes of the cache of "+
+			"the most recently served lines, deducted from the memory available for the index. If 0, it is disabled.")
+		blockCacheSize = fs.Int64("block_cache_size", 64*1024*1024, "the maximum size in bytes of the cache of "+
+			"the most recently read blocks of the file, deducted from the memory available for the index. "+
+			"If 0, it is disabled.")
+		htpasswdPath = fs.String("htpasswd_path", "", "the path to the htpasswd file with the bcrypt hashed "+
+			"passwords of the users allowed to call the server API. If empty, authentication is disabled unless "+
+			"auth_keys_path is set. The file is reloaded on SIGHUP.")
+		basicAuthScopes = fs.String("basic_auth_scopes", strings.Join([]string{middlewares.ScopeReadLines,
+			middlewares.ScopeReadRange, middlewares.ScopeSearch}, ","), "comma separated list of scopes granted "+
+			"to the users of the htpasswd file: read-lines, read-range, search or admin")
+		authKeysPath = fs.String("auth_keys_path", "", "the path to the JSON file with the API keys and "+
+			"the bearer token signing keys of the service consumers. If empty, only the htpasswd users are "+
+			"authenticated. The file is reloaded on SIGHUP.")
+		datasetsPath = fs.String("datasets_path", "", "the path to the JSON file with the named datasets served "+
+			"besides the file of file_path, each with its file and index policy. The in-memory indexes of the "+
+			"datasets share the memory available for indexing, or max_indexes if positive.")
+		dataDir = fs.String("data_dir", "", "the path to a directory whose files are all served as datasets "+
+			"besides the file of file_path, named after their path relative to the directory. Files added to or "+
+			"removed from the directory are picked up on every reload.")
+		dataInclude = fs.String("data_include", "", "comma separated list of glob patterns of the files of "+
+			"data_dir to serve. Patterns without a slash match the file name, the others the relative path. "+
+			"If empty, every file is served.")
+		dataExclude = fs.String("data_exclude", "*.idx,*.idx.tmp*", "comma separated list of glob patterns of the "+
+			"files of data_dir not to serve, even if included. The default excludes the index files and the temporary "+
+			"files they are written to")
+		dataEagerIndex = fs.Bool("data_eager_index", false, "index the files of data_dir once discovered, "+
+			"instead of on their first access")
+		appendOnly = fs.Bool("append_only", false, "the files only grow by appending lines, such as logs, so a "+
+			"partially written last line is not served until its line terminator is appended")
+		reloadInterval = fs.Duration("reload_interval", 10*time.Second, "how often the file is checked for "+
+			"being replaced or modified, to reload it with a new index. If 0, it is only reloaded on SIGHUP.")
+		shutdownDelay = fs.Duration("shutdown_delay", 0, "how long the server keeps serving requests while "+
+			"it is not ready anymore, before it stops listening and drains the connections")
 	)
 	fs.Usage = usageFor(fs, os.Args[0]+" [flags]")
 	_ = fs.Parse(os.Args[1:])
@@ -44,14 +115,42 @@ func main() {
 	zerolog.SetGlobalLevel(zerolog.Level(*logLevel))
 	zeroLog := zlog.With().Caller().Str("component", "line-server").Logger()
 
-	// log non-secret arguments to help debugging issues
+	// log non-secret arguments to help debugging issues, also described by the stats of the debug server
+	config := map[string]any{
+		"debug_addr":           *debugAddr,
+		"debug_profiling":      *debugProfiling,
+		"shutdown_delay":       shutdownDelay.String(),
+		"http_addr":            *httpAddr,
+		"log_level":            *logLevel,
+		"file_path":            *filePath,
+		"max_indexes":          *maxIndexes,
+		"index_mode":           *indexMode,
+		"index_workers":        *indexWorkers,
+		"access_point_spacing": *accessPointSpacing,
+		"persist_index":        *persistIndex,
+		"reload_interval":      reloadInterval.String(),
+		"append_only":          *appendOnly,
+		"index_path":           *indexPath,
+		"max_line_size":        *maxLineSize,
+		"line_delimiter":       *lineDelimiter,
+		"max_batch_size":       *maxBatchSize,
+		"max_open_files":       *maxOpenFiles,
+		"remote_cache_size":    *remoteCacheSize,
+		"remote_retries":       *remoteRetries,
+		"line_cache_size":      *lineCacheSize,
+		"block_cache_size":     *blockCacheSize,
+		"htpasswd_path":        *htpasswdPath,
+		"basic_auth_scopes":    *basicAuthScopes,
+		"auth_keys_path":       *authKeysPath,
+		"datasets_path":        *datasetsPath,
+		"data_dir":             *dataDir,
+		"data_include":         *dataInclude,
+		"data_exclude":         *dataExclude,
+		"data_eager_index":     *dataEagerIndex,
+	}
 	zeroLog.Info().
 		Str("service", "line-server").
-		Str("debug_addr", *debugAddr).
-		Str("http_addr", *httpAddr).
-		Int("log_level", *logLevel).
-		Str("file_path", *filePath).
-		Int("max_indexes", *maxIndexes).
+		Fields(config).
 		Msg("non-secret arguments")
 
 	zeroLog.Info().Msg("starting line server")
@@ -70,20 +169,128 @@ func main() {
 	}
 
 	// Check if indexes should be generated
-	var fileIndexSummary *fileprocessing.FileIndexSummary = nil
-	if *maxIndexes >= 0 {
-		fileIndexSummary, err := fileprocessing.GenerateIndex(&zeroLog, *filePath, *maxIndexes)
-		// Validate file index summary
+	if *indexPath == "" {
+		*indexPath = fileprocessing.IndexFilePath(*filePath)
+	}
+	mode := fileprocessing.IndexMode(*indexMode)
+	if mode != fileprocessing.IndexModeMemory && mode != fileprocessing.IndexModeMmap {
+		zeroLog.Fatal().Str("index_mode", *indexMode).Msg("invalid index mode")
+	}
+	delimiter, err := fileprocessing.ResolveDelimiter(fileprocessing.Delimiter(*lineDelimiter), *filePath)
+	if err != nil {
+		zeroLog.Fatal().Err(err).Str("line_delimiter", *lineDelimiter).Msg("invalid line delimiter")
+	}
+	zeroLog.Info().Str("line_delimiter", string(delimiter)).Msg("line delimiter resolved")
+	datasets := []datasetSettings{{
+		name:               dataset.DefaultName,
+		src:                source.NewLocal(*filePath),
+		indexPath:          *indexPath,
+		mode:               mode,
+		persistIndex:       *persistIndex,
+		maxIndexes:         *maxIndexes,
+		delimiter:          delimiter,
+		indexWorkers:       *indexWorkers,
+		accessPointSpacing: *accessPointSpacing,
+		reservedMemory:     *lineCacheSize + *blockCacheSize,
+		maxOpenFiles:       *maxOpenFiles,
+		appendOnly:         *appendOnly,
+		remote:             source.HTTPOptions{CacheSize: *remoteCacheSize, Retries: *remoteRetries},
+	}}
+	if *datasetsPath != "" {
+		configs, err := dataset.LoadConfig(*datasetsPath)
+		if err != nil {
+			zeroLog.Fatal().Err(err).Msg("failed to load datasets file")
+		}
+		for _, config := range configs {
+			settings, err := settingsFor(config, datasets[0], fileprocessing.Delimiter(*lineDelimiter))
+			if err != nil {
+				zeroLog.Fatal().Err(err).Str("dataset", config.Name).Msg("invalid dataset")
+			}
+			datasets = append(datasets, settings)
+		}
+	}
+	// The files of the data directory share the memory available for indexing with the other datasets
+	var directorySize int64
+	if *dataDir != "" {
+		directorySize, err = sizeOfDirectory(*dataDir)
+		if err != nil {
+			zeroLog.Fatal().Err(err).Str("data_dir", *dataDir).Msg("failed to read data directory")
+		}
+	}
+	var directoryIndexes int
+	if *datasetsPath != "" || *dataDir != "" {
+		directoryIndexes, err = apportionIndexes(&zeroLog, datasets, *maxIndexes, directorySize)
+		if err != nil {
+			zeroLog.Fatal().Err(err).Msg("failed to apportion the memory available for indexing")
+		}
+	}
+	// The files are reloaded with a new index once they are replaced or modified, polling them and on SIGHUP
+	registry := dataset.NewRegistry()
+	defer registry.Close()
+	watchContext, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	for _, settings := range datasets {
+		d, err := openDataset(&zeroLog, settings)
+		if err != nil {
+			zeroLog.Fatal().Err(err).Str("dataset", settings.name).Msg("failed to open file")
+		}
+		if err := registry.Add(settings.name, d); err != nil {
+			zeroLog.Fatal().Err(err).Msg("failed to register dataset")
+		}
+		fileReloadChannel := make(chan os.Signal, 1)
+		signal.Notify(fileReloadChannel, syscall.SIGHUP)
+		go d.Watch(watchContext, *reloadInterval, fileReloadChannel)
+	}
+	if *dataDir != "" {
+		open := func(name string, filePath string) (*dataset.Dataset, error) {
+			settings, err := directorySettings(name, filePath, datasets[0], fileprocessing.Delimiter(*lineDelimiter),
+				directoryIndexes, directorySize)
+			if err != nil {
+				return nil, err
+			}
+			settings.lazyIndex = !*dataEagerIndex
+			return openDataset(&zeroLog, settings)
+		}
+		// The local files already served as datasets are skipped, so they are not indexed twice to the same index file
+		var served []string
+		for _, settings := range datasets {
+			if local, ok := settings.src.(*source.Local); ok {
+				served = append(served, local.Name())
+			}
+		}
+		directory, err := dataset.NewDirectory(&zeroLog, *dataDir, registry, open, dataset.DirectoryOptions{
+			Include: splitList(*dataInclude),
+			Exclude: splitList(*dataExclude),
+			Skip:    served,
+		})
 		if err != nil {
-			zeroLog.Fatal().Err(err).Msg("failed to generate index")
+			zeroLog.Fatal().Err(err).Str("data_dir", *dataDir).Msg("invalid data directory")
 		}
-		zeroLog.Info().Int("length", len(fileIndexSummary.Index)).Msg("index generated successfully")
+		// The files that cannot be opened are skipped, and opened again on the following scans
+		if err := directory.Scan(); err != nil {
+			zeroLog.Error().Err(err).Msg("failed to open some files of the data directory")
+		}
+		directoryReloadChannel := make(chan os.Signal, 1)
+		signal.Notify(directoryReloadChannel, syscall.SIGHUP)
+		go directory.Watch(watchContext, *reloadInterval, directoryReloadChannel)
+	}
+	lineDataset := registry.Get(dataset.DefaultName)
+	if err := metrics.RegisterIndex(registry); err != nil {
+		zeroLog.Fatal().Err(err).Msg("failed to register index metrics")
 	}
 
 	dependencies := services.Dependencies{
-		Logger:           &zeroLog,
-		FilePath:         *filePath,
-		FileIndexSummary: fileIndexSummary,
+		Logger:         &zeroLog,
+		FilePath:       *filePath,
+		Index:          lineDataset.Index(),
+		Dataset:        lineDataset,
+		Datasets:       registry,
+		MaxLineSize:    *maxLineSize,
+		Delimiter:      delimiter,
+		MaxBatchSize:   *maxBatchSize,
+		MaxOpenFiles:   *maxOpenFiles,
+		LineCacheSize:  *lineCacheSize,
+		BlockCacheSize: *blockCacheSize,
 	}
 	srv, err := services.New(dependencies)
 	if err != nil {
@@ -96,15 +303,85 @@ func main() {
 	if err != nil {
 		zeroLog.Fatal().Err(err).Msg("failed to create line-server router")
 	}
+	// Authenticate the requests to the server API, after CORS preflight requests are handled
+	var apiHandler http.Handler = mux
+	var authenticators []middlewares.Authenticator
+	var reloaders []func() error
+	if *htpasswdPath != "" {
+		scopes, err := middlewares.ParseScopes(*basicAuthScopes)
+		if err != nil {
+			zeroLog.Fatal().Err(err).Str("basic_auth_scopes", *basicAuthScopes).Msg("invalid basic auth scopes")
+		}
+		htpasswd, err := middlewares.LoadHtpasswd(*htpasswdPath)
+		if err != nil {
+			zeroLog.Fatal().Err(err).Msg("failed to load htpasswd file")
+		}
+		authenticators = append(authenticators, htpasswd.BasicAuthenticator(scopes))
+		reloaders = append(reloaders, htpasswd.Reload)
+	}
+	if *authKeysPath != "" {
+		serviceKeys, err := middlewares.LoadServiceKeys(*authKeysPath)
+		if err != nil {
+			zeroLog.Fatal().Err(err).Msg("failed to load service keys file")
+		}
+		authenticators = append(authenticators, serviceKeys.APIKeyAuthenticator(), serviceKeys.BearerAuthenticator())
+		reloaders = append(reloaders, serviceKeys.Reload)
+	}
+	if len(authenticators) > 0 {
+		apiHandler = middlewares.AuthMiddleware(&zeroLog, authenticators...)(mux)
+		// Reload the users and the service keys on SIGHUP, without restarting the server
+		reloadChannel := make(chan os.Signal, 1)
+		signal.Notify(reloadChannel, syscall.SIGHUP)
+		go func() {
+			for range reloadChannel {
+				for _, reload := range reloaders {
+					if err := reload(); err != nil {
+						zeroLog.Error().Err(err).Msg("failed to reload credentials, keeping the ones loaded")
+					}
+				}
+				zeroLog.Info().Msg("credentials reloaded")
+			}
+		}()
+	} else {
+		zeroLog.Warn().Msg("htpasswd_path and auth_keys_path are empty, authentication is disabled")
+	}
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins: corsAllowedOriginsList,
-		AllowedHeaders: []string{"authorization"},
+		AllowedHeaders: []string{"authorization", "x-api-key"},
 	})
-	handlerHTTP := corsHandler.Handler(mux)
+	handlerHTTP := corsHandler.Handler(apiHandler)
+
+	// The health endpoints are served on both listeners, without authentication
+	checker := health.NewChecker(&zeroLog, *filePath, lineDataset, registry)
+	rootMux := http.NewServeMux()
+	checker.Register(rootMux)
+	rootMux.Handle("/", middlewares.MetricsMiddleware(mux)(handlerHTTP))
 
 	s := &http.Server{
 		Addr:    *httpAddr,
-		Handler: middlewares.LoggingMiddleware(&zeroLog)(handlerHTTP),
+		Handler: middlewares.LoggingMiddleware(&zeroLog)(rootMux),
+	}
+
+	// The debug server exposes the metrics and the diagnostics on a separate address, kept off the server API
+	var debugServer *http.Server
+	if *debugAddr != "" {
+		debugMux := diagnostics.NewRouter(&zeroLog, diagnostics.Options{
+			Profiling: *debugProfiling,
+			Config:    config,
+			Index:     lineDataset,
+			Datasets:  registry,
+		})
+		checker.Register(debugMux)
+		debugServer = &http.Server{
+			Addr:    *debugAddr,
+			Handler: middlewares.LoggingMiddleware(&zeroLog)(debugMux),
+		}
+		go func() {
+			zeroLog.Info().Msgf("starting debug server on port %s", *debugAddr)
+			if err := debugServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				zeroLog.Error().Err(err).Msg("debug server stopped")
+			}
+		}()
 	}
 
 	// Signal handling
@@ -123,14 +400,301 @@ func main() {
 	// Wait for interrupt signal
 	<-sigChannel
 	zeroLog.Info().Msg("shutting down server")
+	// The server is no longer ready, so the orchestrator stops routing requests before the connections are drained
+	checker.ShuttingDown()
+	time.Sleep(*shutdownDelay)
 
 	err = s.Shutdown(context.Background())
 	if err != nil {
 		zeroLog.Fatal().Err(err).Msg("failed to gracefully stop the server")
 	}
+	if debugServer != nil {
+		if err := debugServer.Shutdown(context.Background()); err != nil {
+			zeroLog.Error().Err(err).Msg("failed to gracefully stop the debug server")
+		}
+	}
 	zeroLog.Info().Msg("server was gracefully stopped")
 }
 
+// datasetSettings holds the settings of a dataset served by the server.
+type datasetSettings struct {
+	name      string
+	src       source.LineSource
+	indexPath string
+	// mode is the index mode of the file, or dataset.IndexModeNone to serve it without an index
+	mode         fileprocessing.IndexMode
+	persistIndex bool
+	// maxIndexes limits the number of entries of the in-memory index. If 0, it uses all available memory,
+	// and if negative, the file is served without an index.
+	maxIndexes   int
+	delimiter    fileprocessing.Delimiter
+	indexWorkers int
+	// accessPointSpacing is the number of decompressed bytes between the access points of a compressed file
+	accessPointSpacing int64
+	reservedMemory     int64
+	maxOpenFiles       int
+	// appendOnly hides the unterminated last line of the file, which may still be written
+	appendOnly bool
+	// lazyIndex defers building the index of the file until the dataset is first requested
+	lazyIndex bool
+	// remote holds the settings of the remote files of the datasets of a URL
+	remote source.HTTPOptions
+}
+
+// settingsFor returns the settings of a dataset of the datasets file,
+// inheriting the settings of the server for the ones it does not define.
+func settingsFor(config dataset.Config, defaults datasetSettings, lineDelimiter fileprocessing.Delimiter,
+) (datasetSettings, error) {
+	settings := defaults
+	settings.name = config.Name
+	settings.src = source.NewLocal(config.FilePath)
+	settings.indexPath = config.IndexPath
+	if config.IndexMode != "" {
+		settings.mode = config.IndexMode
+	}
+	switch {
+	case config.URL != "":
+		remote, err := source.NewHTTP(config.URL, settings.remote)
+		if err != nil {
+			return datasetSettings{}, err
+		}
+		settings.src = remote
+		// The index of a remote file is only persisted to a configured index file
+		if settings.indexPath == "" {
+			if settings.mode == fileprocessing.IndexModeMmap {
+				return datasetSettings{}, errors.New("index path is required to memory-map the index of a URL")
+			}
+			settings.persistIndex = false
+		}
+	case settings.indexPath == "":
+		settings.indexPath = fileprocessing.IndexFilePath(config.FilePath)
+	}
+	if config.MaxIndexes > 0 {
+		settings.maxIndexes = config.MaxIndexes
+	}
+	settings.appendOnly = settings.appendOnly || config.AppendOnly
+	if settings.mode == dataset.IndexModeNone {
+		settings.maxIndexes = -1
+	}
+	if config.LineDelimiter != "" {
+		lineDelimiter = config.LineDelimiter
+	}
+	delimiter, err := fileprocessing.ResolveDelimiterFrom(lineDelimiter, settings.src)
+	if err != nil {
+		return datasetSettings{}, err
+	}
+	settings.delimiter = delimiter
+	return settings, nil
+}
+
+// directorySettings returns the settings of a dataset of a file discovered in the data directory,
+// inheriting the settings of the server. Its index is stored alongside the file, and the number of entries
+// of its in-memory index is its share of the entries of the directory, proportional to its size.
+func directorySettings(name string, filePath string, defaults datasetSettings, lineDelimiter fileprocessing.Delimiter,
+	directoryIndexes int, directorySize int64,
+) (datasetSettings, error) {
+	settings := defaults
+	settings.name = name
+	settings.src = source.NewLocal(filePath)
+	settings.indexPath = fileprocessing.IndexFilePath(filePath)
+	if settings.mode == fileprocessing.IndexModeMemory && settings.maxIndexes >= 0 {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return datasetSettings{}, errors.Wrap(err, "failed to stat file")
+		}
+		// The files added at runtime are indexed at the same rate, as the budget is apportioned at startup
+		settings.maxIndexes = max(int(float64(directoryIndexes)*float64(info.Size())/float64(max(directorySize, 1))), 1)
+	}
+	delimiter, err := fileprocessing.ResolveDelimiter(lineDelimiter, filePath)
+	if err != nil {
+		return datasetSettings{}, err
+	}
+	settings.delimiter = delimiter
+	return settings, nil
+}
+
+// sizeOfDirectory returns the total size of the regular files under the directory.
+func sizeOfDirectory(root string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(root, func(_ string, entry os.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// splitList splits a comma separated list, ignoring its empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// apportionIndexes shares the memory budget of the in-memory indexes across the datasets whose number of entries
+// is not configured, proportionally to the size of their file, and the files of the data directory, whose share
+// is returned. The datasets with a configured number of entries are deducted from the budget,
+// which is maxIndexes or, if 0, the memory available for indexing.
+func apportionIndexes(logger *zerolog.Logger, datasets []datasetSettings, maxIndexes int, directorySize int64,
+) (int, error) {
+	if maxIndexes < 0 {
+		return 0, nil
+	}
+	budget := maxIndexes
+	if budget == 0 {
+		var err error
+		budget, err = fileprocessing.AvailableIndexes(logger, datasets[0].reservedMemory)
+		if err != nil {
+			return 0, err
+		}
+	}
+	var shared []int
+	var sizes []int64
+	for i, settings := range datasets {
+		if settings.mode != fileprocessing.IndexModeMemory || settings.maxIndexes < 0 {
+			continue
+		}
+		if i > 0 && settings.maxIndexes > 0 {
+			budget -= settings.maxIndexes
+			continue
+		}
+		info, err := settings.src.Stat()
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to stat file of dataset %q", settings.name)
+		}
+		shared = append(shared, i)
+		sizes = append(sizes, info.Size)
+	}
+	if directorySize > 0 {
+		sizes = append(sizes, directorySize)
+	}
+	if len(sizes) == 0 {
+		return 0, nil
+	}
+	shares := dataset.ApportionIndexes(max(budget, 0), sizes)
+	for j, share := range shares[:len(shared)] {
+		datasets[shared[j]].maxIndexes = share
+		logger.Info().Str("dataset", datasets[shared[j]].name).Int("max_indexes", share).Msg("index budget apportioned")
+	}
+	if directorySize == 0 {
+		return 0, nil
+	}
+	directoryIndexes := shares[len(shared)]
+	logger.Info().Int("max_indexes", directoryIndexes).Msg("index budget of the data directory apportioned")
+	return directoryIndexes, nil
+}
+
+// openDataset opens the dataset of the file, whose index is generated in background
+// while lines are served by scanning the file.
+func openDataset(logger *zerolog.Logger, settings datasetSettings) (*dataset.Dataset, error) {
+	index := fileprocessing.NewIndexHolder(nil)
+	var buildIndex dataset.BuildIndexFunc
+	var extendIndex dataset.ExtendIndexFunc
+	if settings.maxIndexes >= 0 {
+		indexOptions := fileprocessing.IndexOptions{
+			Workers:            settings.indexWorkers,
+			Delimiter:          settings.delimiter,
+			ReservedMemory:     settings.reservedMemory,
+			AccessPointSpacing: settings.accessPointSpacing,
+			// The index of a file that may still be written does not count its partially written last line
+			TerminatedLinesOnly: settings.appendOnly,
+		}
+		buildIndex = func(src source.LineSource) (*fileprocessing.FileIndexSummary, error) {
+			return generateIndex(logger, settings.mode, src, settings.indexPath, settings.persistIndex,
+				settings.maxIndexes, indexOptions)
+		}
+		if settings.mode == fileprocessing.IndexModeMemory {
+			// The lines appended to the file are indexed without scanning the file again, and the index is persisted
+			// once per interval, as the extensions are serialized by the reloads of the dataset
+			persisted := time.Now()
+			extendIndex = func(src source.LineSource, fileIndexSummary *fileprocessing.FileIndexSummary,
+			) (*fileprocessing.FileIndexSummary, error) {
+				persist := settings.persistIndex && time.Since(persisted) >= extendedIndexPersistInterval
+				if persist {
+					persisted = time.Now()
+				}
+				return extendIndexFile(logger, src, fileIndexSummary, settings.indexPath, persist,
+					settings.maxIndexes, indexOptions)
+			}
+		}
+		// The index is generated in background, while lines are served by scanning the file,
+		// unless it is generated once the dataset is first requested
+		if !settings.lazyIndex {
+			index = fileprocessing.NewPendingIndexHolder()
+			go func() {
+				fileIndexSummary, err := buildIndex(settings.src)
+				// Validate file index summary
+				if err != nil {
+					logger.Error().Err(err).Str("dataset", settings.name).
+						Msg("failed to generate index, lines will be served by scanning the file")
+					index.Fail(err)
+					return
+				}
+				index.Store(fileIndexSummary)
+				if fileIndexSummary != nil {
+					logger.Info().
+						Str("dataset", settings.name).
+						Str("mode", string(fileIndexSummary.Mode)).
+						Int("index_offset", fileIndexSummary.IndexOffset).
+						Int("number_of_lines", fileIndexSummary.NumberOfLines).
+						Dur("build_duration", index.BuildDuration()).
+						Msg("index generated successfully")
+				}
+			}()
+		}
+	}
+	return dataset.NewFromSource(logger, settings.src, index, dataset.Options{
+		MaxOpenFiles: settings.maxOpenFiles,
+		Delimiter:    settings.delimiter,
+		BuildIndex:   buildIndex,
+		ExtendIndex:  extendIndex,
+		LazyIndex:    settings.lazyIndex,
+		// Lines are served by scanning the file while it is not indexed, which must hide the same last line
+		TerminatedLinesOnly: settings.appendOnly,
+	})
+}
+
+// generateIndex loads or generates the index of the file according to the index mode.
+func generateIndex(logger *zerolog.Logger, mode fileprocessing.IndexMode, src source.LineSource, indexPath string,
+	persistIndex bool, maxIndexes int, opts fileprocessing.IndexOptions,
+) (*fileprocessing.FileIndexSummary, error) {
+	switch {
+	case mode == fileprocessing.IndexModeMmap:
+		// The dense index is always persisted, as the index file backs the memory mapping
+		return fileprocessing.LoadOrGenerateMappedIndexFrom(logger, src, indexPath, opts)
+	case persistIndex:
+		return fileprocessing.LoadOrGenerateIndexFrom(logger, src, indexPath, maxIndexes, opts)
+	default:
+		return fileprocessing.GenerateIndexFrom(logger, src, maxIndexes, opts)
+	}
+}
+
+// extendIndexFile extends the in-memory index of the file with its appended lines,
+// persisting the extended index to the index file if requested.
+func extendIndexFile(logger *zerolog.Logger, src source.LineSource, fileIndexSummary *fileprocessing.FileIndexSummary,
+	indexPath string, persistIndex bool, maxIndexes int, opts fileprocessing.IndexOptions,
+) (*fileprocessing.FileIndexSummary, error) {
+	fileIndexSummary, err := fileprocessing.ExtendIndexFrom(logger, src, fileIndexSummary, maxIndexes, opts)
+	if err != nil || fileIndexSummary == nil || !persistIndex {
+		return fileIndexSummary, err
+	}
+	// Failing to persist the index is not fatal, as the extended index can still be used
+	if err := fileprocessing.WriteIndexFile(indexPath, fileIndexSummary); err != nil {
+		logger.Warn().Err(err).Str("index_path", indexPath).Msg("failed to write index file")
+	}
+	return fileIndexSummary, nil
+}
+
 func usageFor(fs *flag.FlagSet, short string) func() {
 	return func() {
 		fmt.Fprintf(os.Stderr, "USAGE\n")
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRU is a least recently used cache bounded by the total size in bytes of its entries, rather than their number,
+// so it holds many small values or few large ones within the same memory budget.
+// It is safe for concurrent use.
+type LRU[K comparable, V any] struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	// order holds the entries from the most to the least recently used
+	order   *list.List
+	entries map[K]*list.Element
+}
+
+// entry is a cached value, with the size in bytes it is accounted for.
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+	size  int64
+}
+
+// NewLRU creates a cache holding entries up to maxBytes in total.
+func NewLRU[K comparable, V any](maxBytes int64) *LRU[K, V] {
+	return &LRU[K, V]{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  map[K]*list.Element{},
+	}
+}
+
+// Get returns the value of the key, marking it as the most recently used, and whether it was found.
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*entry[K, V]).value, true
+}
+
+// Add caches the value of the key, accounted for the given size in bytes, as the most recently used entry.
+// The least recently used entries are evicted until the cache fits its maximum size,
+// and it returns the number of evicted entries. Values larger than the maximum size are not cached.
+func (c *LRU[K, V]) Add(key K, value V, size int64) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if size > c.maxBytes {
+		return 0
+	}
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	c.entries[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, size: size})
+	c.size += size
+	evicted := 0
+	for c.size > c.maxBytes {
+		c.remove(c.order.Back())
+		evicted++
+	}
+	return evicted
+}
+
+// Size returns the total size in bytes of the cached entries.
+func (c *LRU[K, V]) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Len returns the number of cached entries.
+func (c *LRU[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// remove removes the entry of the element from the cache.
+func (c *LRU[K, V]) remove(element *list.Element) {
+	e := c.order.Remove(element).(*entry[K, V])
+	delete(c.entries, e.key)
+	c.size -= e.size
+}
@@ -0,0 +1,74 @@
+//go:build unit
+
+package cache_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/renanrv/line-server/pkg/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU(t *testing.T) {
+	c := cache.NewLRU[int, string](10)
+	assert.Equal(t, 0, c.Add(1, "one", 3))
+	assert.Equal(t, 0, c.Add(2, "two", 3))
+	assert.Equal(t, 0, c.Add(3, "three", 4))
+	assert.Equal(t, int64(10), c.Size())
+
+	// Getting an entry makes it the most recently used, so the next least recently used entry is evicted
+	value, ok := c.Get(1)
+	assert.True(t, ok)
+	assert.Equal(t, "one", value)
+	assert.Equal(t, 1, c.Add(4, "four", 3))
+	_, ok = c.Get(2)
+	assert.False(t, ok)
+	assert.Equal(t, 3, c.Len())
+	assert.Equal(t, int64(10), c.Size())
+
+	// A large entry evicts several entries
+	assert.Equal(t, 2, c.Add(5, "five", 6))
+	_, ok = c.Get(1)
+	assert.False(t, ok)
+	_, ok = c.Get(4)
+	assert.True(t, ok)
+	_, ok = c.Get(5)
+	assert.True(t, ok)
+	assert.Equal(t, int64(9), c.Size())
+
+	// Replacing an entry accounts for its new size only
+	assert.Equal(t, 0, c.Add(5, "FIVE", 7))
+	value, _ = c.Get(5)
+	assert.Equal(t, "FIVE", value)
+	assert.Equal(t, int64(10), c.Size())
+
+	// Values larger than the cache are not cached
+	assert.Equal(t, 0, c.Add(6, "six", 11))
+	_, ok = c.Get(6)
+	assert.False(t, ok)
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestLRU_Concurrent(t *testing.T) {
+	c := cache.NewLRU[int, string](100)
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := (worker*1000 + i) % 50
+				if value, ok := c.Get(key); ok {
+					assert.Equal(t, fmt.Sprint(key), value)
+					continue
+				}
+				c.Add(key, fmt.Sprint(key), 4)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, c.Size(), int64(100))
+	assert.Equal(t, int64(c.Len()*4), c.Size())
+}
@@ -0,0 +1,95 @@
+package dataset
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+)
+
+// IndexModeNone serves the file of a dataset without an index, scanning it for every request.
+const IndexModeNone fileprocessing.IndexMode = "none"
+
+// namePattern restricts the names of the datasets to a single path segment of the routes.
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Config describes a dataset of a datasets file, with the index policy of its file.
+type Config struct {
+	Name     string `json:"name"`
+	FilePath string `json:"file_path"`
+	// URL is the http or https URL of a remote file fetched with range requests, instead of a local file.
+	URL string `json:"url"`
+	// IndexMode is memory, mmap or none. If empty, the index mode of the server is used.
+	IndexMode fileprocessing.IndexMode `json:"index_mode"`
+	// IndexPath is the path to the index file. If empty, it is stored alongside the file with the .idx extension,
+	// and the index of a remote file is not persisted.
+	IndexPath string `json:"index_path"`
+	// MaxIndexes limits the number of entries of the in-memory index, instead of its share of the memory budget.
+	MaxIndexes int `json:"max_indexes"`
+	// LineDelimiter is the line delimiter of the file. If empty, the line delimiter of the server is used.
+	LineDelimiter fileprocessing.Delimiter `json:"line_delimiter"`
+	// AppendOnly hides the partially written last line of a file that only grows by appending lines.
+	// If false, the append_only setting of the server is used.
+	AppendOnly bool `json:"append_only"`
+}
+
+// configFile is the content of a datasets file.
+type configFile struct {
+	Datasets []Config `json:"datasets"`
+}
+
+// LoadConfig loads the datasets of a datasets file.
+func LoadConfig(path string) ([]Config, error) {
+	if path == "" {
+		return nil, errors.New("datasets path cannot be empty")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read datasets file")
+	}
+	var file configFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, errors.Wrap(err, "failed to parse datasets file")
+	}
+	names := map[string]bool{DefaultName: true}
+	for i, config := range file.Datasets {
+		if !namePattern.MatchString(config.Name) || (config.FilePath == "") == (config.URL == "") {
+			return nil, errors.Errorf("invalid dataset at position %d, a name of letters, digits, dots, "+
+				"dashes and underscores and either a file path or a URL are required", i)
+		}
+		if names[config.Name] {
+			return nil, errors.Errorf("duplicate dataset name %q", config.Name)
+		}
+		names[config.Name] = true
+		switch config.IndexMode {
+		case "", fileprocessing.IndexModeMemory, fileprocessing.IndexModeMmap, IndexModeNone:
+		default:
+			return nil, errors.Errorf("invalid index mode %q of dataset %q", config.IndexMode, config.Name)
+		}
+		if config.MaxIndexes < 0 {
+			return nil, errors.Errorf("max indexes of dataset %q cannot be negative", config.Name)
+		}
+	}
+	return file.Datasets, nil
+}
+
+// ApportionIndexes apportions the maximum number of index entries of the memory budget across the files
+// proportionally to their size in bytes, as larger files are likely to have more lines.
+// Each file gets at least one entry, so its index can be generated.
+func ApportionIndexes(maxIndexes int, sizes []int64) []int {
+	shares := make([]int, len(sizes))
+	total := int64(0)
+	for _, size := range sizes {
+		total += size
+	}
+	for i, size := range sizes {
+		share := maxIndexes / len(sizes)
+		if total > 0 {
+			share = int(float64(maxIndexes) * float64(size) / float64(total))
+		}
+		shares[i] = max(share, 1)
+	}
+	return shares
+}
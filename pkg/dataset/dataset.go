@@ -0,0 +1,416 @@
+package dataset
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/source"
+	"github.com/rs/zerolog"
+)
+
+// Dataset serves the lines of a file, hot reloading it once it is replaced or modified.
+// Each version of the file has its own descriptors and index, and the requests acquire the current version,
+// so a new version is swapped atomically once its index is ready, while in-flight requests finish on the old one.
+// A version is closed once it is swapped and released by all the requests that acquired it.
+type Dataset struct {
+	logger      *zerolog.Logger
+	src         source.LineSource
+	delimiter   fileprocessing.Delimiter
+	buildIndex  BuildIndexFunc
+	extendIndex ExtendIndexFunc
+	// terminatedLinesOnly hides the unterminated last line of the file, which may still be written
+	terminatedLinesOnly bool
+	// maxOpenFiles limits the number of descriptors of each version
+	maxOpenFiles int
+	current      atomic.Pointer[Version]
+	// lazy is set until the dataset is first acquired, which builds the index of its current version
+	lazy atomic.Bool
+	// closed is set once the dataset is closed, so its current version cannot be acquired anymore
+	closed atomic.Bool
+	// reloading serializes the reloads, triggered by polling and by signals
+	reloading sync.Mutex
+	// changes is closed and replaced whenever the file is reloaded or lines are appended to it
+	changesMu sync.Mutex
+	changes   chan struct{}
+}
+
+// ErrClosed is returned when a closed dataset is acquired, such as the dataset of a file removed from a directory.
+var ErrClosed = errors.New("dataset is closed")
+
+// versions counts the versions of all datasets, so their IDs are unique across datasets.
+var versions atomic.Uint64
+
+// BuildIndexFunc loads or generates the index of the file of the line source.
+type BuildIndexFunc func(src source.LineSource) (*fileprocessing.FileIndexSummary, error)
+
+// ExtendIndexFunc extends the index of the file of the line source with the lines appended since it was built.
+type ExtendIndexFunc func(src source.LineSource, fileIndexSummary *fileprocessing.FileIndexSummary,
+) (*fileprocessing.FileIndexSummary, error)
+
+// Options holds the optional settings of the dataset.
+type Options struct {
+	// MaxOpenFiles limits the number of descriptors of each version of the file opened to serve lines,
+	// which are kept open and shared by the requests. If 0, DefaultMaxOpenFiles is used.
+	MaxOpenFiles int
+	// Delimiter defines how the lines of the file are terminated, for the handlers serving several datasets.
+	// If empty, the delimiter of the handler is used.
+	Delimiter fileprocessing.Delimiter
+	// BuildIndex builds the index of the new versions of the file. If nil, new versions are served without an index.
+	BuildIndex BuildIndexFunc
+	// ExtendIndex extends the index of the current version of the file once lines are appended to it,
+	// instead of building the index of a new version. If nil, the file is reloaded once lines are appended.
+	ExtendIndex ExtendIndexFunc
+	// LazyIndex builds the index of the file with BuildIndex in background once the dataset is first acquired,
+	// instead of the index holder given to New, so the files that are never requested are not indexed.
+	LazyIndex bool
+	// TerminatedLinesOnly hides the unterminated last line of the file, which may still be written,
+	// such as an append-only log, until its terminator is appended. The index must be built with the same setting.
+	TerminatedLinesOnly bool
+}
+
+// Version is a version of the file with its descriptors and its index.
+// It is acquired by the requests serving its lines, which must release it once they are done.
+type Version struct {
+	// ID identifies the version among the versions of all datasets, so the caches shared by the datasets
+	// key their entries by version
+	ID    uint64
+	Index *fileprocessing.IndexHolder
+	Files *FilePool
+	// info describes the file as of the last reload, and is only accessed by the reloads
+	info source.Info
+	// refs counts the requests that acquired the version, and the dataset while it is the current version
+	refs atomic.Int64
+}
+
+// New creates a dataset serving the local file, whose current version is indexed by the index holder.
+// The index may still be generated in background, and a nil holder serves the file without an index.
+func New(logger *zerolog.Logger, filePath string, index *fileprocessing.IndexHolder, opts Options) (*Dataset, error) {
+	return NewFromSource(logger, source.NewLocal(filePath), index, opts)
+}
+
+// NewFromSource creates a dataset serving the file of the line source, like New does for a local file.
+func NewFromSource(logger *zerolog.Logger, src source.LineSource, index *fileprocessing.IndexHolder, opts Options,
+) (*Dataset, error) {
+	if logger == nil {
+		return nil, errors.New("logger is required")
+	}
+	if src == nil {
+		return nil, errors.New("source is required")
+	}
+	if opts.MaxOpenFiles < 0 {
+		return nil, errors.New("max open files cannot be negative")
+	}
+	if opts.MaxOpenFiles == 0 {
+		opts.MaxOpenFiles = DefaultMaxOpenFiles
+	}
+	lazy := opts.LazyIndex && opts.BuildIndex != nil
+	switch {
+	case lazy:
+		index = fileprocessing.NewDeferredIndexHolder()
+	case index == nil:
+		index = fileprocessing.NewIndexHolder(nil)
+	}
+	d := &Dataset{
+		logger:              logger,
+		src:                 src,
+		delimiter:           opts.Delimiter,
+		buildIndex:          opts.BuildIndex,
+		extendIndex:         opts.ExtendIndex,
+		maxOpenFiles:        opts.MaxOpenFiles,
+		changes:             make(chan struct{}),
+		terminatedLinesOnly: opts.TerminatedLinesOnly,
+	}
+	version, err := d.newVersion(index)
+	if err != nil {
+		return nil, err
+	}
+	d.current.Store(version)
+	d.lazy.Store(lazy)
+	return d, nil
+}
+
+// Path returns the path of the file, or the name of the file of a line source that is not local.
+func (d *Dataset) Path() string {
+	return d.src.Name()
+}
+
+// Source returns the line source of the file.
+func (d *Dataset) Source() source.LineSource {
+	return d.src
+}
+
+// Delimiter returns the line delimiter of the file, or an empty delimiter if not defined.
+func (d *Dataset) Delimiter() fileprocessing.Delimiter {
+	return d.delimiter
+}
+
+// TerminatedLinesOnly reports whether the unterminated last line of the file is hidden, as it may still be written.
+func (d *Dataset) TerminatedLinesOnly() bool {
+	return d.terminatedLinesOnly
+}
+
+// Acquire returns the current version of the file, which must be released once the request is done.
+// The first request of a lazily indexed dataset starts building its index, while it is served by scanning the file.
+// It returns ErrClosed once the dataset is closed.
+func (d *Dataset) Acquire() (*Version, error) {
+	if d.lazy.Load() && d.lazy.CompareAndSwap(true, false) {
+		go d.buildLazily()
+	}
+	for {
+		// A version swapped in the meantime may be closed already, so the new current version is acquired,
+		// unless the version was closed with the dataset
+		if version := d.current.Load(); version.acquire() {
+			return version, nil
+		}
+		if d.closed.Load() {
+			return nil, ErrClosed
+		}
+	}
+}
+
+// Index returns the index holder of the current version of the file.
+func (d *Dataset) Index() *fileprocessing.IndexHolder {
+	return d.current.Load().Index
+}
+
+// buildLazily builds the index of the current version of the file, which was not built when it was opened.
+// If the file changed since it was opened, it is reloaded with a new index instead.
+func (d *Dataset) buildLazily() {
+	if err := d.Reload(); err != nil {
+		d.logger.Error().Err(err).Str("file_path", d.src.Name()).Msg("failed to reload file, keeping the current version")
+	}
+	d.reloading.Lock()
+	defer d.reloading.Unlock()
+	version := d.current.Load()
+	if version.Index.Ready() {
+		return
+	}
+	version.Index.Start()
+	fileIndexSummary, err := d.buildIndex(d.src)
+	if err != nil {
+		d.logger.Error().Err(err).Str("file_path", d.src.Name()).
+			Msg("failed to generate index, lines will be served by scanning the file")
+		version.Index.Fail(err)
+		return
+	}
+	version.Index.Store(fileIndexSummary)
+	d.logger.Info().
+		Str("file_path", d.src.Name()).
+		Uint64("version", version.ID).
+		Dur("build_duration", version.Index.BuildDuration()).
+		Msg("index generated on first access")
+}
+
+// Changed returns a channel closed once the file is reloaded or lines are appended to it,
+// so the requests following the file are notified of its changes.
+func (d *Dataset) Changed() <-chan struct{} {
+	d.changesMu.Lock()
+	defer d.changesMu.Unlock()
+	return d.changes
+}
+
+// notify notifies the requests following the file that it changed.
+func (d *Dataset) notify() {
+	d.changesMu.Lock()
+	defer d.changesMu.Unlock()
+	close(d.changes)
+	d.changes = make(chan struct{})
+}
+
+// Reload swaps the current version of the file with a new one if the file was replaced or modified,
+// once the index of the new version is ready. If the index cannot be built, the new version is served
+// without an index, as the index of the current version does not match the file anymore.
+// The new version is opened before it is indexed, so its index matches it even if the file changes again
+// while it is indexed, and the following changes are picked up by the next reload.
+// If lines were appended to the file, the index of the current version is extended instead, if possible.
+func (d *Dataset) Reload() error {
+	d.reloading.Lock()
+	defer d.reloading.Unlock()
+	current := d.current.Load()
+	info, err := d.src.Stat()
+	if err != nil {
+		return errors.Wrap(err, "failed to stat file")
+	}
+	if !changed(current.info, info) {
+		return nil
+	}
+	if d.appended(current, info) {
+		err := d.extend(current, info)
+		if err == nil {
+			return nil
+		}
+		d.logger.Warn().Err(err).Str("file_path", d.src.Name()).Msg("failed to extend index, reloading file")
+	}
+	d.logger.Info().Str("file_path", d.src.Name()).Uint64("version", current.ID).Msg("file changed, reloading it")
+	index := fileprocessing.NewPendingIndexHolder()
+	switch {
+	case d.buildIndex == nil:
+		index.Store(nil)
+	case d.lazy.Load():
+		// The index of a dataset that was never acquired is still built on its first access
+		index = fileprocessing.NewDeferredIndexHolder()
+	}
+	version, err := d.newVersion(index)
+	if err != nil {
+		return err
+	}
+	if !index.Ready() && !d.lazy.Load() {
+		if err := d.indexVersion(version); err != nil {
+			version.Release()
+			return err
+		}
+	}
+	d.current.Store(version)
+	current.Release()
+	d.notify()
+	d.logger.Info().
+		Str("file_path", d.src.Name()).
+		Uint64("version", version.ID).
+		Dur("build_duration", index.BuildDuration()).
+		Msg("file reloaded")
+	return nil
+}
+
+// indexVersion builds the index of the version. The file is indexed as of the time its index is started,
+// which is checked against the version, so the file only changing while it is indexed does not discard the index.
+func (d *Dataset) indexVersion(version *Version) error {
+	fileIndexSummary, err := d.buildIndex(d.src)
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to generate index, lines will be served by scanning the file")
+		version.Index.Fail(err)
+		return nil
+	}
+	if fileIndexSummary != nil && (fileIndexSummary.FileInfo.Size != version.info.Size ||
+		!fileIndexSummary.FileInfo.ModTime.Equal(version.info.ModTime)) {
+		_ = fileIndexSummary.Close()
+		return errors.New("file changed while reloading")
+	}
+	version.Index.Store(fileIndexSummary)
+	return nil
+}
+
+// appended reports whether the file of the version grew, so the index of the version may be extended.
+func (d *Dataset) appended(version *Version, info source.Info) bool {
+	return d.extendIndex != nil && version.info.SameFile(info) && info.Size > version.info.Size &&
+		version.Index.Ready() && version.Index.Load() != nil
+}
+
+// extend extends the index of the version with the lines appended to its file,
+// so they are served from the same descriptors and the cached lines and blocks of the version are kept.
+func (d *Dataset) extend(version *Version, info source.Info) error {
+	fileIndexSummary, err := d.extendIndex(d.src, version.Index.Load())
+	if err != nil {
+		return err
+	}
+	if fileIndexSummary == nil {
+		return errors.New("no lines indexed")
+	}
+	version.Index.Update(fileIndexSummary)
+	version.info = info
+	d.notify()
+	d.logger.Info().
+		Str("file_path", d.src.Name()).
+		Uint64("version", version.ID).
+		Int("number_of_lines", fileIndexSummary.NumberOfLines).
+		Msg("index extended with the appended lines")
+	return nil
+}
+
+// Watch reloads the file on every tick of the interval and on every signal received, until the context is done.
+// If the interval is 0, the file is only reloaded on signals.
+// The reloads run apart from the ticks and the signals, which are coalesced into a single reload while the file
+// is reloaded, so the signals are not blocked while a new version of the file is indexed.
+func (d *Dataset) Watch(ctx context.Context, interval time.Duration, signals <-chan os.Signal) {
+	var ticks <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	reloads := make(chan struct{}, 1)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-reloads:
+			}
+			if err := d.Reload(); err != nil {
+				d.logger.Error().Err(err).Msg("failed to reload file, keeping the current version")
+			}
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+		case <-signals:
+		}
+		select {
+		case reloads <- struct{}{}:
+		default:
+			// A reload is already pending, which picks up the latest changes of the file
+		}
+	}
+}
+
+// Close releases the current version of the file, so it is closed once the in-flight requests are done.
+// The dataset cannot be used anymore.
+func (d *Dataset) Close() {
+	if d.closed.CompareAndSwap(false, true) {
+		d.current.Load().Release()
+	}
+}
+
+// newVersion opens a version of the file, referenced by the dataset as its current version.
+// The version is the file opened by the first descriptor of its pool.
+func (d *Dataset) newVersion(index *fileprocessing.IndexHolder) (*Version, error) {
+	files, err := openFilePool(d.src, d.maxOpenFiles)
+	if err != nil {
+		return nil, err
+	}
+	version := &Version{
+		ID:    versions.Add(1),
+		Index: index,
+		Files: files,
+		info:  files.info,
+	}
+	version.refs.Store(1)
+	return version, nil
+}
+
+// acquire references the version, unless it was already closed.
+func (v *Version) acquire() bool {
+	for {
+		refs := v.refs.Load()
+		if refs == 0 {
+			return false
+		}
+		if v.refs.CompareAndSwap(refs, refs+1) {
+			return true
+		}
+	}
+}
+
+// Release releases the version acquired by a request, closing it once it was swapped and released by all requests.
+func (v *Version) Release() {
+	if v.refs.Add(-1) > 0 {
+		return
+	}
+	v.Files.close()
+	// The index of the version may be memory-mapped, and no request reads it anymore
+	if fileIndexSummary := v.Index.Load(); fileIndexSummary != nil {
+		_ = fileIndexSummary.Close()
+	}
+}
+
+// changed reports whether the file was replaced or modified since the version was opened.
+func changed(version source.Info, info source.Info) bool {
+	return !version.SameFile(info) || version.Size != info.Size || !version.ModTime.Equal(info.ModTime)
+}
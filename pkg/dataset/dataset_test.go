@@ -0,0 +1,337 @@
+//go:build unit
+
+package dataset_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/dataset"
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/source"
+	"github.com/renanrv/line-server/pkg/utils"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// replaceFile atomically replaces the file with a new file of the content, as deployments replace datasets
+func replaceFile(t *testing.T, filePath string, content string) {
+	t.Helper()
+	newFilePath := filepath.Join(filepath.Dir(filePath), "new-"+filepath.Base(filePath))
+	assert.Nil(t, os.WriteFile(newFilePath, []byte(content), 0o600))
+	assert.Nil(t, os.Rename(newFilePath, filePath))
+}
+
+// appendToFile appends the content to the file, as a log is written
+func appendToFile(t *testing.T, filePath string, content string) {
+	t.Helper()
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0)
+	assert.Nil(t, err)
+	_, err = file.WriteString(content)
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+}
+
+// buildIndex indexes every line of the file
+func buildIndex(src source.LineSource) (*fileprocessing.FileIndexSummary, error) {
+	logger := zerolog.New(nil)
+	return fileprocessing.GenerateIndexFrom(&logger, src, 100, fileprocessing.IndexOptions{})
+}
+
+// acquire acquires the current version of the dataset
+func acquire(t *testing.T, d *dataset.Dataset) *dataset.Version {
+	t.Helper()
+	version, err := d.Acquire()
+	assert.Nil(t, err)
+	return version
+}
+
+// readAll reads the file through a descriptor of the version
+func readAll(t *testing.T, version *dataset.Version) string {
+	t.Helper()
+	file, err := version.Files.Acquire(context.Background())
+	assert.Nil(t, err)
+	defer version.Files.Release(file)
+	content, err := io.ReadAll(io.NewSectionReader(file, 0, 1024))
+	assert.Nil(t, err)
+	return string(content)
+}
+
+func TestDataset_Reload(t *testing.T) {
+	logger := zerolog.New(nil)
+
+	t.Run("Replaced file", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\nline2\n")
+		fileIndexSummary, err := buildIndex(source.NewLocal(file.Name()))
+		assert.Nil(t, err)
+		d, err := dataset.New(&logger, file.Name(), fileprocessing.NewIndexHolder(fileIndexSummary),
+			dataset.Options{BuildIndex: buildIndex})
+		assert.Nil(t, err)
+
+		// An unchanged file is not reloaded
+		assert.Nil(t, d.Reload())
+		old := acquire(t, d)
+		// The in-flight request holds a descriptor of the version opened before the file is replaced
+		descriptor, err := old.Files.Acquire(context.Background())
+		assert.Nil(t, err)
+		old.Files.Release(descriptor)
+
+		replaceFile(t, file.Name(), "line1\nline2\nline3\n")
+		assert.Nil(t, d.Reload())
+		current := acquire(t, d)
+		assert.Equal(t, old.ID+1, current.ID)
+		assert.Equal(t, 3, d.Index().Load().NumberOfLines)
+		assert.Equal(t, "line1\nline2\nline3\n", readAll(t, current))
+		current.Release()
+
+		// The in-flight request finishes on the old version, which is closed once released
+		assert.Equal(t, 2, old.Index.Load().NumberOfLines)
+		assert.Equal(t, "line1\nline2\n", readAll(t, old))
+		old.Release()
+		d.Close()
+		_, err = d.Acquire()
+		assert.Equal(t, dataset.ErrClosed, err)
+	})
+
+	t.Run("Modified file", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\nline2\n")
+		d, err := dataset.New(&logger, file.Name(), nil, dataset.Options{BuildIndex: buildIndex})
+		assert.Nil(t, err)
+		assert.Nil(t, d.Index().Load())
+
+		appendToFile(t, file.Name(), "line3\n")
+		assert.Nil(t, d.Reload())
+		assert.Equal(t, 3, d.Index().Load().NumberOfLines)
+	})
+
+	t.Run("Appended lines", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\nline2\n")
+		fileIndexSummary, err := buildIndex(source.NewLocal(file.Name()))
+		assert.Nil(t, err)
+		d, err := dataset.New(&logger, file.Name(), fileprocessing.NewIndexHolder(fileIndexSummary), dataset.Options{
+			BuildIndex: buildIndex,
+			ExtendIndex: func(src source.LineSource, fileIndexSummary *fileprocessing.FileIndexSummary,
+			) (*fileprocessing.FileIndexSummary, error) {
+				return fileprocessing.ExtendIndexFrom(&logger, src, fileIndexSummary, 100, fileprocessing.IndexOptions{})
+			},
+		})
+		assert.Nil(t, err)
+
+		// The index of the current version is extended, so the version and its descriptors are kept
+		initial := acquire(t, d)
+		initial.Release()
+		changed := d.Changed()
+		appendToFile(t, file.Name(), "line3\nli")
+		assert.Nil(t, d.Reload())
+		assert.Eventually(t, func() bool {
+			select {
+			case <-changed:
+				return true
+			default:
+				return false
+			}
+		}, time.Second, time.Millisecond)
+		version := acquire(t, d)
+		assert.Equal(t, initial.ID, version.ID)
+		assert.Equal(t, 3, d.Index().Load().NumberOfLines)
+		assert.Equal(t, "line1\nline2\nline3\nli", readAll(t, version))
+		version.Release()
+
+		// A file modified before its indexed size is reloaded as a new version
+		assert.Nil(t, os.WriteFile(file.Name(), []byte("LINE1\nLINE2\nLINE3\nLINE4\nLINE5\n"), 0o600))
+		assert.Nil(t, d.Reload())
+		assert.Equal(t, initial.ID+1, acquire(t, d).ID)
+		assert.Equal(t, 5, d.Index().Load().NumberOfLines)
+	})
+
+	t.Run("File changing while it is indexed", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\nline2\n")
+		d, err := dataset.New(&logger, file.Name(), nil, dataset.Options{
+			BuildIndex: func(src source.LineSource) (*fileprocessing.FileIndexSummary, error) {
+				fileIndexSummary, err := buildIndex(src)
+				// A line is appended once the file is indexed, as a file written while it is indexed
+				appendToFile(t, file.Name(), "line\n")
+				return fileIndexSummary, err
+			},
+		})
+		assert.Nil(t, err)
+
+		// The version is indexed as it was opened, so the index is not discarded by the following changes
+		replaceFile(t, file.Name(), "line1\nline2\nline3\n")
+		assert.Nil(t, d.Reload())
+		assert.Equal(t, 3, d.Index().Load().NumberOfLines)
+	})
+
+	t.Run("Index cannot be built", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\nline2\n")
+		d, err := dataset.New(&logger, file.Name(), nil, dataset.Options{
+			BuildIndex: func(source.LineSource) (*fileprocessing.FileIndexSummary, error) {
+				return nil, errors.New("failed to generate index")
+			},
+		})
+		assert.Nil(t, err)
+
+		// The new version is served by scanning the file, as the index of the old version does not match it
+		replaceFile(t, file.Name(), "line1\n")
+		assert.Nil(t, d.Reload())
+		assert.True(t, d.Index().Ready())
+		assert.EqualError(t, d.Index().Err(), "failed to generate index")
+		version := acquire(t, d)
+		defer version.Release()
+		assert.Equal(t, "line1\n", readAll(t, version))
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\nline2\n")
+		d, err := dataset.New(&logger, file.Name(), nil, dataset.Options{})
+		assert.Nil(t, err)
+		initial := acquire(t, d)
+		initial.Release()
+		assert.Nil(t, os.Remove(file.Name()))
+		assert.ErrorContains(t, d.Reload(), "failed to stat file")
+		assert.Equal(t, initial.ID, acquire(t, d).ID)
+	})
+
+	t.Run("Lazy index", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\nline2\n")
+		d, err := dataset.New(&logger, file.Name(), nil, dataset.Options{BuildIndex: buildIndex, LazyIndex: true})
+		assert.Nil(t, err)
+
+		// The index is not built until the dataset is first acquired, even once the file is replaced
+		replaceFile(t, file.Name(), "line1\nline2\nline3\n")
+		assert.Nil(t, d.Reload())
+		assert.False(t, d.Index().Ready())
+
+		version := acquire(t, d)
+		version.Release()
+		assert.Eventually(t, func() bool {
+			fileIndexSummary := d.Index().Load()
+			return fileIndexSummary != nil && fileIndexSummary.NumberOfLines == 3
+		}, time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestDataset_Watch(t *testing.T) {
+	logger := zerolog.New(nil)
+
+	t.Run("Polling", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\nline2\n")
+		d, err := dataset.New(&logger, file.Name(), nil, dataset.Options{BuildIndex: buildIndex})
+		assert.Nil(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go d.Watch(ctx, 10*time.Millisecond, nil)
+
+		replaceFile(t, file.Name(), "line1\nline2\nline3\n")
+		assert.Eventually(t, func() bool {
+			fileIndexSummary := d.Index().Load()
+			return fileIndexSummary != nil && fileIndexSummary.NumberOfLines == 3
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Signal", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\nline2\n")
+		d, err := dataset.New(&logger, file.Name(), nil, dataset.Options{BuildIndex: buildIndex})
+		assert.Nil(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		signals := make(chan os.Signal, 1)
+		go d.Watch(ctx, 0, signals)
+
+		replaceFile(t, file.Name(), "line1\nline2\nline3\n")
+		signals <- syscall.SIGHUP
+		assert.Eventually(t, func() bool {
+			fileIndexSummary := d.Index().Load()
+			return fileIndexSummary != nil && fileIndexSummary.NumberOfLines == 3
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Signal received while the file is indexed", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\nline2\n")
+		indexing := make(chan struct{}, 1)
+		release := make(chan struct{})
+		d, err := dataset.New(&logger, file.Name(), nil, dataset.Options{
+			BuildIndex: func(src source.LineSource) (*fileprocessing.FileIndexSummary, error) {
+				select {
+				case indexing <- struct{}{}:
+				default:
+				}
+				<-release
+				return buildIndex(src)
+			},
+		})
+		assert.Nil(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		signals := make(chan os.Signal)
+		go d.Watch(ctx, 0, signals)
+
+		replaceFile(t, file.Name(), "line1\nline2\nline3\n")
+		signals <- syscall.SIGHUP
+		<-indexing
+		// The signals are received while the file is indexed, and coalesced into a single reload
+		replaceFile(t, file.Name(), "line1\nline2\nline3\nline4\n")
+		for range 2 {
+			select {
+			case signals <- syscall.SIGHUP:
+			case <-time.After(time.Second):
+				t.Fatal("signal blocked while the file is indexed")
+			}
+		}
+		close(release)
+		assert.Eventually(t, func() bool {
+			fileIndexSummary := d.Index().Load()
+			return fileIndexSummary != nil && fileIndexSummary.NumberOfLines == 4
+		}, time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestFilePool(t *testing.T) {
+	logger := zerolog.New(nil)
+	file := utils.CreateTempFile(t, "line1\nline2\n")
+	d, err := dataset.New(&logger, file.Name(), nil, dataset.Options{MaxOpenFiles: 2})
+	assert.Nil(t, err)
+	version := acquire(t, d)
+	defer version.Release()
+	first, err := version.Files.Acquire(context.Background())
+	assert.Nil(t, err)
+
+	// Once the file is replaced, the descriptors of the version are shared instead of opening the new file
+	replaceFile(t, file.Name(), "other\n")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = version.Files.Acquire(ctx)
+	assert.ErrorContains(t, err, "failed to acquire file descriptor: context deadline exceeded")
+	version.Files.Release(first)
+	second, err := version.Files.Acquire(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, first, second)
+	version.Files.Release(second)
+
+	t.Run("File replaced before any request", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\n")
+		d, err := dataset.New(&logger, file.Name(), nil, dataset.Options{MaxOpenFiles: 2})
+		assert.Nil(t, err)
+		version := acquire(t, d)
+		defer version.Release()
+		// The descriptor opened with the version still reads the replaced file
+		replaceFile(t, file.Name(), "other\n")
+		descriptor, err := version.Files.Acquire(context.Background())
+		assert.Nil(t, err)
+		content, err := io.ReadAll(io.NewSectionReader(descriptor, 0, 1024))
+		assert.Nil(t, err)
+		assert.Equal(t, "line1\n", string(content))
+		version.Files.Release(descriptor)
+	})
+
+	t.Run("Negative max open files", func(t *testing.T) {
+		_, err := dataset.New(&logger, file.Name(), nil, dataset.Options{MaxOpenFiles: -1})
+		assert.EqualError(t, err, "max open files cannot be negative")
+	})
+}
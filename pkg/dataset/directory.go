@@ -0,0 +1,266 @@
+package dataset
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// OpenFunc opens the dataset of a file discovered under the root directory.
+type OpenFunc func(name string, filePath string) (*Dataset, error)
+
+// DirectoryOptions holds the optional settings of a directory.
+type DirectoryOptions struct {
+	// Include holds the glob patterns of the served files. If empty, every file is served.
+	Include []string
+	// Exclude holds the glob patterns of the files that are not served, even if included.
+	Exclude []string
+	// Skip holds the paths of the files that are not served, as they are already served as other datasets,
+	// so a file is not indexed twice under different names.
+	Skip []string
+}
+
+// Directory discovers the regular files under a root directory and serves each one as a dataset of the registry,
+// named after its slash-separated path relative to the root. Glob patterns without a slash match the base name
+// of the files, and the others match their whole relative path.
+// Files are confined to the root: symbolic links resolving outside of it are skipped, so they cannot expose
+// other files of the server, while the names of the requests are only looked up among the discovered files.
+type Directory struct {
+	logger   *zerolog.Logger
+	root     string
+	registry *Registry
+	open     OpenFunc
+	include  []string
+	exclude  []string
+	// skip holds the resolved paths of the skipped files
+	skip map[string]bool
+	// scanning serializes the scans, triggered by polling and by signals
+	scanning sync.Mutex
+	// datasets holds the datasets of the discovered files, so the other datasets of the registry are kept
+	datasets map[string]*Dataset
+}
+
+// NewDirectory creates a directory registering the datasets of the files under the root in the registry.
+// No file is discovered until it is scanned.
+func NewDirectory(logger *zerolog.Logger, root string, registry *Registry, open OpenFunc, opts DirectoryOptions,
+) (*Directory, error) {
+	if logger == nil {
+		return nil, errors.New("logger is required")
+	}
+	if registry == nil {
+		return nil, errors.New("registry is required")
+	}
+	if open == nil {
+		return nil, errors.New("open function is required")
+	}
+	for _, pattern := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Errorf("invalid glob pattern %q", pattern)
+		}
+	}
+	// The root is resolved, so the files are confined to the directory it names
+	absolute, err := filepath.Abs(root)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to resolve root directory")
+	}
+	resolved, err := filepath.EvalSymlinks(absolute)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to resolve root directory")
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to stat root directory")
+	}
+	if !info.IsDir() {
+		return nil, errors.New("root is not a directory")
+	}
+	// The skipped paths are resolved like the discovered files, so they are compared with their resolved paths
+	skip := map[string]bool{}
+	for _, skipped := range opts.Skip {
+		absolute, err := filepath.Abs(skipped)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to resolve skipped file")
+		}
+		if resolved, err := filepath.EvalSymlinks(absolute); err == nil {
+			absolute = resolved
+		}
+		skip[absolute] = true
+	}
+	return &Directory{
+		logger:   logger,
+		root:     resolved,
+		registry: registry,
+		open:     open,
+		include:  opts.Include,
+		exclude:  opts.Exclude,
+		skip:     skip,
+		datasets: map[string]*Dataset{},
+	}, nil
+}
+
+// Scan opens the datasets of the files added under the root since the previous scan,
+// and removes the datasets of the files removed.
+// The files that cannot be opened are skipped until the next scan, and the first error is returned.
+func (d *Directory) Scan() error {
+	d.scanning.Lock()
+	defer d.scanning.Unlock()
+	found := map[string]string{}
+	err := filepath.WalkDir(d.root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if filePath == d.root {
+				return err
+			}
+			// The unreadable directories are skipped, so the other files are still served
+			d.logger.Warn().Err(err).Str("path", filePath).Msg("failed to read directory entry")
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		relative, err := filepath.Rel(d.root, filePath)
+		if err != nil {
+			return nil
+		}
+		name := filepath.ToSlash(relative)
+		if !d.matches(name) {
+			return nil
+		}
+		confined, ok := d.confine(filePath)
+		if !ok {
+			d.logger.Debug().Str("path", filePath).Msg("file outside of the root directory skipped")
+			return nil
+		}
+		if d.skip[confined] {
+			d.logger.Debug().Str("path", filePath).Msg("file served as another dataset skipped")
+			return nil
+		}
+		found[name] = confined
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to scan root directory")
+	}
+	for name, removed := range d.datasets {
+		if _, ok := found[name]; ok {
+			continue
+		}
+		d.registry.Remove(name)
+		removed.Close()
+		delete(d.datasets, name)
+		d.logger.Info().Str("dataset", name).Msg("file removed, dataset no longer served")
+	}
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var firstErr error
+	for _, name := range names {
+		if _, ok := d.datasets[name]; ok {
+			continue
+		}
+		added, err := d.open(name, found[name])
+		if err == nil {
+			err = d.registry.Add(name, added)
+			if err != nil {
+				added.Close()
+			}
+		}
+		if err != nil {
+			d.logger.Error().Err(err).Str("dataset", name).Msg("failed to open dataset of discovered file")
+			if firstErr == nil {
+				firstErr = errors.Wrapf(err, "failed to open dataset %q", name)
+			}
+			continue
+		}
+		d.datasets[name] = added
+		d.logger.Info().Str("dataset", name).Msg("file discovered, dataset served")
+	}
+	return firstErr
+}
+
+// Watch scans the root and reloads the datasets of the discovered files on every tick of the interval
+// and on every signal received, until the context is done. If the interval is 0, it only does so on signals.
+func (d *Directory) Watch(ctx context.Context, interval time.Duration, signals <-chan os.Signal) {
+	var ticks <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+		case <-signals:
+		}
+		if err := d.Scan(); err != nil {
+			d.logger.Error().Err(err).Msg("failed to scan root directory")
+		}
+		for _, discovered := range d.discovered() {
+			if err := discovered.Reload(); err != nil {
+				d.logger.Error().Err(err).Str("file_path", discovered.Path()).
+					Msg("failed to reload file, keeping the current version")
+			}
+		}
+	}
+}
+
+// discovered returns the datasets of the discovered files.
+func (d *Directory) discovered() []*Dataset {
+	d.scanning.Lock()
+	defer d.scanning.Unlock()
+	datasets := make([]*Dataset, 0, len(d.datasets))
+	for _, discovered := range d.datasets {
+		datasets = append(datasets, discovered)
+	}
+	return datasets
+}
+
+// matches reports whether the file of the relative path is included and not excluded.
+func (d *Directory) matches(name string) bool {
+	return (len(d.include) == 0 || matchAny(d.include, name)) && !matchAny(d.exclude, name)
+}
+
+// matchAny reports whether any glob pattern matches the relative path, or its base name for the patterns
+// without a slash.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		target := name
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(name)
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// confine resolves the symbolic links of the path of a discovered file, and returns the resolved path
+// if it names a regular file within the root.
+func (d *Directory) confine(filePath string) (string, bool) {
+	resolved, err := filepath.EvalSymlinks(filePath)
+	if err != nil {
+		return "", false
+	}
+	relative, err := filepath.Rel(d.root, resolved)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	info, err := os.Stat(resolved)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	return resolved, true
+}
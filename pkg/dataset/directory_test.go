@@ -0,0 +1,189 @@
+//go:build unit
+
+package dataset_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/renanrv/line-server/pkg/dataset"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeFiles writes the files of the contents under the root, creating their directories
+func writeFiles(t *testing.T, root string, contents map[string]string) {
+	t.Helper()
+	for name, content := range contents {
+		filePath := filepath.Join(root, filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(filePath), 0o700))
+		assert.Nil(t, os.WriteFile(filePath, []byte(content), 0o600))
+	}
+}
+
+func TestDirectory_Scan(t *testing.T) {
+	logger := zerolog.New(nil)
+	open := func(_ string, filePath string) (*dataset.Dataset, error) {
+		return dataset.New(&logger, filePath, nil, dataset.Options{BuildIndex: buildIndex, LazyIndex: true})
+	}
+	files := map[string]string{
+		"access.log":         "line1\n",
+		"logs/2024/app.log":  "line1\nline2\n",
+		"logs/app.log.idx":   "index",
+		"app.log.idx.tmp123": "index",
+		"archive/old.txt":    "line1\n",
+		"archive/README.md":  "readme\n",
+		"logs/2024/app.json": "{}\n",
+	}
+
+	tests := []struct {
+		name          string
+		opts          dataset.DirectoryOptions
+		expectedNames []string
+	}{
+		{
+			name: "Every file",
+			expectedNames: []string{"access.log", "app.log.idx.tmp123", "archive/README.md", "archive/old.txt",
+				"logs/2024/app.json", "logs/2024/app.log", "logs/app.log.idx"},
+		},
+		{
+			name:          "Base name patterns",
+			opts:          dataset.DirectoryOptions{Include: []string{"*.log", "*.txt"}},
+			expectedNames: []string{"access.log", "archive/old.txt", "logs/2024/app.log"},
+		},
+		{
+			name:          "Relative path patterns",
+			opts:          dataset.DirectoryOptions{Include: []string{"logs/*/*"}, Exclude: []string{"*.json"}},
+			expectedNames: []string{"logs/2024/app.log"},
+		},
+		{
+			name:          "Excluded index files",
+			opts:          dataset.DirectoryOptions{Exclude: []string{"*.idx", "*.idx.tmp*", "archive/*"}},
+			expectedNames: []string{"access.log", "logs/2024/app.json", "logs/2024/app.log"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFiles(t, root, files)
+			registry := dataset.NewRegistry()
+			defer registry.Close()
+			directory, err := dataset.NewDirectory(&logger, root, registry, open, tt.opts)
+			assert.Nil(t, err)
+			assert.Nil(t, directory.Scan())
+			assert.Equal(t, tt.expectedNames, registry.Names())
+		})
+	}
+
+	t.Run("Files outside of the root", func(t *testing.T) {
+		root, outside := t.TempDir(), t.TempDir()
+		writeFiles(t, root, map[string]string{"inside.log": "line1\n"})
+		writeFiles(t, outside, map[string]string{"secret.txt": "secret\n"})
+		assert.Nil(t, os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "secret.txt")))
+		assert.Nil(t, os.Symlink(outside, filepath.Join(root, "outside")))
+		assert.Nil(t, os.Symlink("inside.log", filepath.Join(root, "link.log")))
+		registry := dataset.NewRegistry()
+		defer registry.Close()
+		directory, err := dataset.NewDirectory(&logger, root, registry, open, dataset.DirectoryOptions{})
+		assert.Nil(t, err)
+		assert.Nil(t, directory.Scan())
+		// Symbolic links are only followed within the root
+		assert.Equal(t, []string{"inside.log", "link.log"}, registry.Names())
+	})
+
+	t.Run("Files served as other datasets", func(t *testing.T) {
+		root := t.TempDir()
+		writeFiles(t, root, map[string]string{"lines.txt": "line1\n", "other.txt": "line1\n"})
+		assert.Nil(t, os.Symlink("lines.txt", filepath.Join(root, "link.txt")))
+		registry := dataset.NewRegistry()
+		defer registry.Close()
+		directory, err := dataset.NewDirectory(&logger, root, registry, open, dataset.DirectoryOptions{
+			Skip: []string{filepath.Join(root, "lines.txt")},
+		})
+		assert.Nil(t, err)
+		assert.Nil(t, directory.Scan())
+		// The file is skipped under every name resolving to it
+		assert.Equal(t, []string{"other.txt"}, registry.Names())
+	})
+
+	t.Run("Added and removed files", func(t *testing.T) {
+		root := t.TempDir()
+		writeFiles(t, root, map[string]string{"first.log": "line1\n", "second.log": "line1\n"})
+		registry := dataset.NewRegistry()
+		defer registry.Close()
+		directory, err := dataset.NewDirectory(&logger, root, registry, open, dataset.DirectoryOptions{})
+		assert.Nil(t, err)
+		assert.Nil(t, directory.Scan())
+		first := registry.Get("first.log")
+
+		assert.Nil(t, os.Remove(filepath.Join(root, "second.log")))
+		writeFiles(t, root, map[string]string{"nested/third.log": "line1\n"})
+		assert.Nil(t, directory.Scan())
+		assert.Equal(t, []string{"first.log", "nested/third.log"}, registry.Names())
+		// The datasets of the files kept are not reopened
+		assert.Equal(t, first, registry.Get("first.log"))
+	})
+
+	t.Run("Datasets of the registry", func(t *testing.T) {
+		root := t.TempDir()
+		writeFiles(t, root, map[string]string{"default": "line1\n", "other.log": "line1\n"})
+		registry := dataset.NewRegistry()
+		defer registry.Close()
+		defaultDataset, err := open(dataset.DefaultName, filepath.Join(root, "other.log"))
+		assert.Nil(t, err)
+		assert.Nil(t, registry.Add(dataset.DefaultName, defaultDataset))
+		directory, err := dataset.NewDirectory(&logger, root, registry, open, dataset.DirectoryOptions{})
+		assert.Nil(t, err)
+		// The file named after a dataset of the registry is skipped, which is kept on the following scans
+		assert.ErrorContains(t, directory.Scan(), `dataset "default" already exists`)
+		assert.Nil(t, os.Remove(filepath.Join(root, "default")))
+		assert.Nil(t, directory.Scan())
+		assert.Equal(t, []string{dataset.DefaultName, "other.log"}, registry.Names())
+		assert.Equal(t, defaultDataset, registry.Get(dataset.DefaultName))
+	})
+
+	t.Run("Invalid root", func(t *testing.T) {
+		registry := dataset.NewRegistry()
+		_, err := dataset.NewDirectory(&logger, filepath.Join(t.TempDir(), "missing"), registry, open,
+			dataset.DirectoryOptions{})
+		assert.ErrorContains(t, err, "failed to resolve root directory")
+		root := t.TempDir()
+		writeFiles(t, root, map[string]string{"file.log": "line1\n"})
+		_, err = dataset.NewDirectory(&logger, filepath.Join(root, "file.log"), registry, open,
+			dataset.DirectoryOptions{})
+		assert.EqualError(t, err, "root is not a directory")
+		_, err = dataset.NewDirectory(&logger, root, registry, open, dataset.DirectoryOptions{Include: []string{"["}})
+		assert.EqualError(t, err, `invalid glob pattern "["`)
+	})
+}
+
+func TestDirectory_Watch(t *testing.T) {
+	logger := zerolog.New(nil)
+	open := func(_ string, filePath string) (*dataset.Dataset, error) {
+		return dataset.New(&logger, filePath, nil, dataset.Options{BuildIndex: buildIndex})
+	}
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"first.log": "line1\n"})
+	registry := dataset.NewRegistry()
+	defer registry.Close()
+	directory, err := dataset.NewDirectory(&logger, root, registry, open, dataset.DirectoryOptions{})
+	assert.Nil(t, err)
+	assert.Nil(t, directory.Scan())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	go directory.Watch(ctx, 0, signals)
+
+	// A signal discovers the added files and reloads the replaced ones
+	writeFiles(t, root, map[string]string{"second.log": "line1\n"})
+	replaceFile(t, filepath.Join(root, "first.log"), "line1\nline2\n")
+	signals <- syscall.SIGHUP
+	assert.Eventually(t, func() bool {
+		fileIndexSummary := registry.Get("first.log").Index().Load()
+		return len(registry.Names()) == 2 && fileIndexSummary != nil && fileIndexSummary.NumberOfLines == 2
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,131 @@
+package dataset
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/metrics"
+	"github.com/renanrv/line-server/pkg/source"
+)
+
+// DefaultMaxOpenFiles is the maximum number of descriptors of a version of the file opened to serve lines,
+// if not configured.
+const DefaultMaxOpenFiles = 64
+
+// errFileReplaced is returned when the line source opens another file than the version of the pool.
+var errFileReplaced = errors.New("file was replaced")
+
+// FilePool holds long-lived descriptors of a version of the file, so requests do not open and close the file.
+// Lines are read with positional reads, such as pread, so a descriptor has no seek position shared between requests.
+// Each request checks out a descriptor, and descriptors are opened on demand up to the maximum,
+// after which requests wait for a descriptor to be released.
+type FilePool struct {
+	src source.LineSource
+	// info identifies the version of the file, so descriptors of a file replacing it are not opened
+	info source.Info
+	// idle holds the released descriptors, and slots a token for each opened descriptor
+	idle  chan source.File
+	slots chan struct{}
+}
+
+// openFilePool creates a pool opening up to maxOpenFiles descriptors of the file of the line source.
+// The first descriptor is opened right away and identifies the version of the file, so the pool always holds
+// a descriptor of its version, even if the file is replaced before any request.
+func openFilePool(src source.LineSource, maxOpenFiles int) (*FilePool, error) {
+	file, err := src.Open()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open file")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, errors.Wrap(err, "failed to stat file")
+	}
+	p := &FilePool{
+		src:   src,
+		info:  info,
+		idle:  make(chan source.File, maxOpenFiles),
+		slots: make(chan struct{}, maxOpenFiles),
+	}
+	p.slots <- struct{}{}
+	p.idle <- file
+	metrics.OpenFiles.Inc()
+	return p, nil
+}
+
+// Acquire checks out an idle descriptor, or opens a new one if the maximum is not reached.
+// Otherwise, it waits for a descriptor to be released until the context is done.
+// Once the file is replaced, no descriptor is opened anymore, so the requests share the opened ones,
+// which include at least the first descriptor of the pool.
+func (p *FilePool) Acquire(ctx context.Context) (source.File, error) {
+	// Idle descriptors are preferred over opening new ones
+	select {
+	case file := <-p.idle:
+		return file, nil
+	default:
+	}
+	select {
+	case file := <-p.idle:
+		return file, nil
+	case p.slots <- struct{}{}:
+		file, err := p.open()
+		if err != nil {
+			<-p.slots
+			if err == errFileReplaced {
+				return p.wait(ctx)
+			}
+			return nil, err
+		}
+		metrics.OpenFiles.Inc()
+		return file, nil
+	case <-ctx.Done():
+		return nil, errors.Wrap(ctx.Err(), "failed to acquire file descriptor")
+	}
+}
+
+// Release returns a descriptor checked out with Acquire to the pool.
+func (p *FilePool) Release(file source.File) {
+	p.idle <- file
+}
+
+// open opens a descriptor of the file, as long as the line source still opens the version of the pool.
+func (p *FilePool) open() (source.File, error) {
+	file, err := p.src.Open()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open file")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, errors.Wrap(err, "failed to stat file")
+	}
+	if !info.SameFile(p.info) {
+		_ = file.Close()
+		return nil, errFileReplaced
+	}
+	return file, nil
+}
+
+// wait waits for a descriptor to be released until the context is done.
+func (p *FilePool) wait(ctx context.Context) (source.File, error) {
+	select {
+	case file := <-p.idle:
+		return file, nil
+	case <-ctx.Done():
+		return nil, errors.Wrap(ctx.Err(), "failed to acquire file descriptor")
+	}
+}
+
+// close closes the descriptors of the pool, which must all be released.
+func (p *FilePool) close() {
+	for {
+		select {
+		case file := <-p.idle:
+			<-p.slots
+			_ = file.Close()
+			metrics.OpenFiles.Dec()
+		default:
+			return
+		}
+	}
+}
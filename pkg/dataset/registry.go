@@ -0,0 +1,91 @@
+package dataset
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+)
+
+// DefaultName is the name of the dataset of the file served by the routes without a dataset name.
+const DefaultName = "default"
+
+// Registry holds the datasets served by name, so a single server serves several files.
+// It is safe for concurrent use.
+type Registry struct {
+	mu       sync.RWMutex
+	datasets map[string]*Dataset
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{datasets: map[string]*Dataset{}}
+}
+
+// Add registers the dataset by name. Names are unique within the registry.
+func (r *Registry) Add(name string, d *Dataset) error {
+	if name == "" {
+		return errors.New("dataset name is required")
+	}
+	if d == nil {
+		return errors.New("dataset is required")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.datasets[name]; ok {
+		return errors.Errorf("dataset %q already exists", name)
+	}
+	r.datasets[name] = d
+	return nil
+}
+
+// Get returns the dataset of the name, or nil if it does not exist.
+func (r *Registry) Get(name string) *Dataset {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.datasets[name]
+}
+
+// Remove unregisters the dataset of the name and returns it, or nil if it does not exist.
+// The caller closes the dataset, whose current version is then closed once the in-flight requests release it.
+func (r *Registry) Remove(name string) *Dataset {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := r.datasets[name]
+	delete(r.datasets, name)
+	return d
+}
+
+// Names returns the names of the datasets, sorted.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.datasets))
+	for name := range r.datasets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Indexes returns the index holders of the current versions of the files of the datasets by name.
+func (r *Registry) Indexes() map[string]*fileprocessing.IndexHolder {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	indexes := make(map[string]*fileprocessing.IndexHolder, len(r.datasets))
+	for name, d := range r.datasets {
+		indexes[name] = d.Index()
+	}
+	return indexes
+}
+
+// Close closes the datasets, which cannot be used anymore.
+func (r *Registry) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, d := range r.datasets {
+		d.Close()
+		delete(r.datasets, name)
+	}
+}
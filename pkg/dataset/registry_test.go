@@ -0,0 +1,171 @@
+//go:build unit
+
+package dataset_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/renanrv/line-server/pkg/dataset"
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/utils"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	logger := zerolog.New(nil)
+	file := utils.CreateTempFile(t, "line1\nline2\n")
+	first, err := dataset.New(&logger, file.Name(), nil, dataset.Options{})
+	assert.Nil(t, err)
+	second, err := dataset.New(&logger, file.Name(), nil, dataset.Options{})
+	assert.Nil(t, err)
+
+	registry := dataset.NewRegistry()
+	defer registry.Close()
+	assert.Nil(t, registry.Add("second", second))
+	assert.Nil(t, registry.Add("first", first))
+	assert.EqualError(t, registry.Add("first", second), `dataset "first" already exists`)
+	assert.EqualError(t, registry.Add("", first), "dataset name is required")
+	assert.EqualError(t, registry.Add("third", nil), "dataset is required")
+	assert.Equal(t, []string{"first", "second"}, registry.Names())
+	assert.Equal(t, first, registry.Get("first"))
+	assert.Nil(t, registry.Get("third"))
+
+	// The versions of the datasets are distinct, so the caches shared by the datasets do not mix their lines
+	firstVersion, secondVersion := acquire(t, first), acquire(t, second)
+	defer firstVersion.Release()
+	defer secondVersion.Release()
+	assert.NotEqual(t, firstVersion.ID, secondVersion.ID)
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name           string
+		content        string
+		expectedConfig []dataset.Config
+		expectedError  string
+	}{
+		{
+			name: "Datasets",
+			content: `{"datasets": [
+				{"name": "access-logs", "file_path": "/data/access.log", "max_indexes": 1000},
+				{"name": "archive_2024.v1", "file_path": "/data/archive.txt", "index_mode": "mmap",
+					"line_delimiter": "nul"},
+				{"name": "small", "file_path": "/data/small.txt", "index_mode": "none"}
+			]}`,
+			expectedConfig: []dataset.Config{
+				{Name: "access-logs", FilePath: "/data/access.log", MaxIndexes: 1000},
+				{
+					Name:          "archive_2024.v1",
+					FilePath:      "/data/archive.txt",
+					IndexMode:     fileprocessing.IndexModeMmap,
+					LineDelimiter: fileprocessing.DelimiterNUL,
+				},
+				{Name: "small", FilePath: "/data/small.txt", IndexMode: dataset.IndexModeNone},
+			},
+		},
+		{
+			name:          "Invalid JSON",
+			content:       `{"datasets": [`,
+			expectedError: "failed to parse datasets file: unexpected end of JSON input",
+		},
+		{
+			name:    "Name with a path separator",
+			content: `{"datasets": [{"name": "logs/access", "file_path": "/data/access.log"}]}`,
+			expectedError: "invalid dataset at position 0, a name of letters, digits, dots, dashes and underscores " +
+				"and either a file path or a URL are required",
+		},
+		{
+			name: "Remote dataset",
+			content: `{"datasets": [
+				{"name": "remote", "url": "https://files.example.com/lines.txt", "index_path": "/data/remote.idx"}
+			]}`,
+			expectedConfig: []dataset.Config{
+				{Name: "remote", URL: "https://files.example.com/lines.txt", IndexPath: "/data/remote.idx"},
+			},
+		},
+		{
+			name: "File path and URL",
+			content: `{"datasets": [
+				{"name": "remote", "file_path": "/data/a.log", "url": "https://files.example.com/lines.txt"}
+			]}`,
+			expectedError: "invalid dataset at position 0, a name of letters, digits, dots, dashes and underscores " +
+				"and either a file path or a URL are required",
+		},
+		{
+			name:    "Missing file path",
+			content: `{"datasets": [{"name": "logs"}]}`,
+			expectedError: "invalid dataset at position 0, a name of letters, digits, dots, dashes and underscores " +
+				"and either a file path or a URL are required",
+		},
+		{
+			name: "Duplicate name",
+			content: `{"datasets": [{"name": "logs", "file_path": "/data/a.log"},
+				{"name": "logs", "file_path": "/data/b.log"}]}`,
+			expectedError: `duplicate dataset name "logs"`,
+		},
+		{
+			name:          "Name of the default dataset",
+			content:       `{"datasets": [{"name": "default", "file_path": "/data/a.log"}]}`,
+			expectedError: `duplicate dataset name "default"`,
+		},
+		{
+			name:          "Invalid index mode",
+			content:       `{"datasets": [{"name": "logs", "file_path": "/data/a.log", "index_mode": "disk"}]}`,
+			expectedError: `invalid index mode "disk" of dataset "logs"`,
+		},
+		{
+			name:          "Negative max indexes",
+			content:       `{"datasets": [{"name": "logs", "file_path": "/data/a.log", "max_indexes": -1}]}`,
+			expectedError: `max indexes of dataset "logs" cannot be negative`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "datasets.json")
+			assert.Nil(t, os.WriteFile(path, []byte(tt.content), 0o600))
+			config, err := dataset.LoadConfig(path)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedConfig, config)
+		})
+	}
+}
+
+func TestApportionIndexes(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxIndexes int
+		sizes      []int64
+		expected   []int
+	}{
+		{
+			name:       "Proportional to the size of the files",
+			maxIndexes: 1000,
+			sizes:      []int64{100, 300, 600},
+			expected:   []int{100, 300, 600},
+		},
+		{
+			name:       "At least one entry per file",
+			maxIndexes: 10,
+			sizes:      []int64{1, 999},
+			expected:   []int{1, 9},
+		},
+		{
+			name:       "Empty files",
+			maxIndexes: 10,
+			sizes:      []int64{0, 0},
+			expected:   []int{5, 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, dataset.ApportionIndexes(tt.maxIndexes, tt.sizes))
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"time"
+
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/metrics"
+	"github.com/rs/zerolog"
+)
+
+// Options holds the settings of the diagnostics router.
+type Options struct {
+	// Profiling exposes the pprof profiles and the goroutine dumps, which production may disable.
+	Profiling bool
+	// Config is the current non-secret configuration of the server, described by the stats endpoint.
+	Config map[string]any
+	// Index provides the file index summary of the current version of the file, described by the stats endpoint.
+	Index fileprocessing.IndexSource
+	// Datasets provides the file index summaries of the current versions of the files of the datasets by name,
+	// described by the stats endpoint.
+	Datasets fileprocessing.IndexSet
+}
+
+// Stats describes the current configuration of the server, its index, the indexes of its datasets and its runtime.
+type Stats struct {
+	Config   map[string]any        `json:"config"`
+	Index    IndexStats            `json:"index"`
+	Datasets map[string]IndexStats `json:"datasets,omitempty"`
+	Runtime  RuntimeStats          `json:"runtime"`
+}
+
+// IndexStats describes the file index summary, once the index is ready.
+type IndexStats struct {
+	// Status is pending while the index is generated, ready once it is available, or unavailable
+	Status          string     `json:"status"`
+	Mode            string     `json:"mode,omitempty"`
+	IndexOffset     int        `json:"index_offset,omitempty"`
+	Checkpoints     int        `json:"checkpoints"`
+	SizeBytes       int        `json:"size_bytes"`
+	NumberOfLines   int        `json:"number_of_lines"`
+	BuildDurationMs int64      `json:"build_duration_ms"`
+	File            *FileStats `json:"file,omitempty"`
+}
+
+// FileStats describes the version of the file the index was generated from.
+type FileStats struct {
+	Size             int64     `json:"size"`
+	ModificationTime time.Time `json:"modification_time"`
+	Fingerprint      string    `json:"fingerprint"`
+}
+
+// RuntimeStats describes the Go runtime of the server.
+type RuntimeStats struct {
+	GoVersion      string `json:"go_version"`
+	CPUs           int    `json:"cpus"`
+	Goroutines     int    `json:"goroutines"`
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+	SysBytes       uint64 `json:"sys_bytes"`
+	NumGC          uint32 `json:"num_gc"`
+}
+
+// NewRouter creates the router of the debug server, kept off the server API:
+// the Prometheus metrics at /metrics, the expvar variables at /debug/vars, the stats at /debug/stats,
+// and, if profiling is enabled, the pprof profiles at /debug/pprof/ and the goroutine dumps at /debug/goroutines.
+func NewRouter(log *zerolog.Logger, opts Options) *http.ServeMux {
+	if opts.Index == nil {
+		opts.Index = fileprocessing.NewIndexHolder(nil)
+	}
+	router := http.NewServeMux()
+	router.Handle("GET /metrics", metrics.Handler())
+	router.Handle("GET /debug/vars", expvar.Handler())
+	router.HandleFunc("GET /debug/stats", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(ReadStats(opts.Config, opts.Index.Index(), opts.Datasets)); err != nil {
+			log.Error().Err(err).Msg("failed to write stats")
+		}
+	})
+	if opts.Profiling {
+		// The pprof index serves the named profiles, such as /debug/pprof/heap
+		router.HandleFunc("/debug/pprof/", pprof.Index)
+		router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		router.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		router.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		router.HandleFunc("GET /debug/goroutines", func(w http.ResponseWriter, _ *http.Request) {
+			// Dumps the stack traces of all goroutines, in the format of an unrecovered panic
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			if err := runtimepprof.Lookup("goroutine").WriteTo(w, 2); err != nil {
+				log.Error().Err(err).Msg("failed to write goroutine dump")
+			}
+		})
+	}
+	return router
+}
+
+// ReadStats reads the stats describing the configuration, the index, the indexes of the datasets, if any,
+// and the runtime of the server.
+func ReadStats(config map[string]any, index *fileprocessing.IndexHolder, datasets fileprocessing.IndexSet) Stats {
+	stats := Stats{
+		Config: config,
+		Index:  readIndexStats(index),
+	}
+	if datasets != nil {
+		indexes := datasets.Indexes()
+		stats.Datasets = make(map[string]IndexStats, len(indexes))
+		for name, datasetIndex := range indexes {
+			stats.Datasets[name] = readIndexStats(datasetIndex)
+		}
+	}
+
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	stats.Runtime = RuntimeStats{
+		GoVersion:      runtime.Version(),
+		CPUs:           runtime.NumCPU(),
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAllocBytes: memStats.HeapAlloc,
+		SysBytes:       memStats.Sys,
+		NumGC:          memStats.NumGC,
+	}
+	return stats
+}
+
+// readIndexStats reads the stats describing the file index summary of the holder.
+func readIndexStats(index *fileprocessing.IndexHolder) IndexStats {
+	stats := IndexStats{
+		Status:          "pending",
+		BuildDurationMs: index.BuildDuration().Milliseconds(),
+	}
+	if fileIndexSummary := index.Load(); fileIndexSummary != nil {
+		stats.Status = "ready"
+		stats.Mode = string(fileIndexSummary.Mode)
+		stats.IndexOffset = fileIndexSummary.IndexOffset
+		stats.Checkpoints = len(fileIndexSummary.Index)
+		// Each checkpoint is the int64 byte offset of its line
+		stats.SizeBytes = len(fileIndexSummary.Index) * 8
+		stats.NumberOfLines = fileIndexSummary.NumberOfLines
+		stats.File = &FileStats{
+			Size:             fileIndexSummary.FileInfo.Size,
+			ModificationTime: fileIndexSummary.FileInfo.ModTime,
+			Fingerprint:      fileIndexSummary.FileInfo.Fingerprint,
+		}
+	} else if index.Ready() {
+		stats.Status = "unavailable"
+	}
+	return stats
+}
@@ -0,0 +1,121 @@
+//go:build unit
+
+package diagnostics_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/renanrv/line-server/pkg/diagnostics"
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// indexSet is a set of index holders by dataset name.
+type indexSet map[string]*fileprocessing.IndexHolder
+
+func (s indexSet) Indexes() map[string]*fileprocessing.IndexHolder {
+	return s
+}
+
+func TestNewRouter(t *testing.T) {
+	logger := zerolog.New(nil)
+	tests := []struct {
+		name           string
+		profiling      bool
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Metrics", path: "/metrics", expectedStatus: http.StatusOK, expectedBody: "go_goroutines"},
+		{name: "Expvar", path: "/debug/vars", expectedStatus: http.StatusOK, expectedBody: "\"memstats\""},
+		{name: "Stats", path: "/debug/stats", expectedStatus: http.StatusOK, expectedBody: "\"runtime\""},
+		{name: "Profiles", profiling: true, path: "/debug/pprof/", expectedStatus: http.StatusOK,
+			expectedBody: "goroutine"},
+		{name: "Heap profile", profiling: true, path: "/debug/pprof/heap?debug=1", expectedStatus: http.StatusOK,
+			expectedBody: "heap profile"},
+		{name: "Goroutine dump", profiling: true, path: "/debug/goroutines", expectedStatus: http.StatusOK,
+			expectedBody: "goroutine "},
+		{name: "Profiles disabled", path: "/debug/pprof/", expectedStatus: http.StatusNotFound},
+		{name: "Goroutine dump disabled", path: "/debug/goroutines", expectedStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := diagnostics.NewRouter(&logger, diagnostics.Options{Profiling: tt.profiling})
+			rw := httptest.NewRecorder()
+			router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assert.Equal(t, tt.expectedStatus, rw.Code)
+			assert.Contains(t, rw.Body.String(), tt.expectedBody)
+		})
+	}
+}
+
+func TestReadStats(t *testing.T) {
+	config := map[string]any{"file_path": "data/sample_100.txt"}
+	modTime := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		index         *fileprocessing.IndexHolder
+		expectedIndex diagnostics.IndexStats
+	}{
+		{
+			name: "Ready index",
+			index: fileprocessing.NewIndexHolder(&fileprocessing.FileIndexSummary{
+				Index:         []int64{0, 12, 24},
+				IndexOffset:   2,
+				NumberOfLines: 6,
+				FileInfo:      fileprocessing.FileInfo{Size: 36, ModTime: modTime, Fingerprint: "abc"},
+				Mode:          fileprocessing.IndexModeMemory,
+			}),
+			expectedIndex: diagnostics.IndexStats{
+				Status:        "ready",
+				Mode:          "memory",
+				IndexOffset:   2,
+				Checkpoints:   3,
+				SizeBytes:     24,
+				NumberOfLines: 6,
+				File:          &diagnostics.FileStats{Size: 36, ModificationTime: modTime, Fingerprint: "abc"},
+			},
+		},
+		{
+			name:          "Unavailable index",
+			index:         fileprocessing.NewIndexHolder(nil),
+			expectedIndex: diagnostics.IndexStats{Status: "unavailable"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := diagnostics.ReadStats(config, tt.index, nil)
+			assert.Equal(t, config, stats.Config)
+			assert.Equal(t, tt.expectedIndex, stats.Index)
+			assert.Nil(t, stats.Datasets)
+			assert.Greater(t, stats.Runtime.Goroutines, 0)
+			assert.NotEmpty(t, stats.Runtime.GoVersion)
+		})
+	}
+
+	t.Run("Pending index", func(t *testing.T) {
+		stats := diagnostics.ReadStats(config, fileprocessing.NewPendingIndexHolder(), nil)
+		assert.Equal(t, "pending", stats.Index.Status)
+		data, err := json.Marshal(stats.Index)
+		assert.Nil(t, err)
+		assert.NotContains(t, string(data), "\"file\"")
+	})
+
+	t.Run("Datasets", func(t *testing.T) {
+		index := fileprocessing.NewIndexHolder(nil)
+		stats := diagnostics.ReadStats(config, index, indexSet{
+			"default": index,
+			"logs":    fileprocessing.NewPendingIndexHolder(),
+		})
+		assert.Equal(t, map[string]diagnostics.IndexStats{
+			"default": {Status: "unavailable"},
+			"logs":    {Status: "pending"},
+		}, stats.Datasets)
+	})
+}
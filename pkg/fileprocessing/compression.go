@@ -0,0 +1,150 @@
+package fileprocessing
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/source"
+)
+
+// Compression defines how a file is compressed, detected from the magic bytes at its beginning.
+type Compression string
+
+const (
+	// CompressionNone is a file that is not compressed.
+	CompressionNone Compression = ""
+	// CompressionGzip is a file of one or more gzip members.
+	CompressionGzip Compression = "gzip"
+	// CompressionZstd is a file of one or more zstd frames, such as a seekable zstd file.
+	CompressionZstd Compression = "zstd"
+)
+
+// DefaultAccessPointSpacing is the number of decompressed bytes between the access points of a compressed file,
+// if not configured.
+const DefaultAccessPointSpacing = 4 * 1024 * 1024
+
+const (
+	// gzipMagic identifies a gzip member.
+	gzipMagic = 0x8b1f
+	// zstdMagic identifies a zstd frame.
+	zstdMagic = 0xfd2fb528
+	// zstdSkippableMagic identifies a skippable zstd frame, such as the seek table of a seekable zstd file,
+	// once its lowest 4 bits are cleared.
+	zstdSkippableMagic = 0x184d2a50
+)
+
+// String returns the name of the compression, or none if the file is not compressed.
+func (c Compression) String() string {
+	if c == CompressionNone {
+		return "none"
+	}
+	return string(c)
+}
+
+// AccessPoint is a position of a compressed file from which its content can be decompressed,
+// without decompressing the file from its beginning.
+// For gzip, it is the beginning of a deflate block, which references the 32 KiB decompressed before it,
+// and for zstd, the beginning of a frame, which is decompressed on its own.
+type AccessPoint struct {
+	// Offset is the offset of the decompressed content at the access point.
+	Offset int64
+	// Bit is the offset in bits of the compressed file at the access point, as deflate blocks are not byte aligned.
+	Bit int64
+	// Window holds the deflate compressed data decompressed before a gzip access point, up to 32 KiB.
+	// It is empty at the beginning of a gzip member and for zstd.
+	Window []byte
+}
+
+// DetectCompression detects the compression of the content from its magic bytes.
+// Content without the magic bytes of gzip or zstd is considered not compressed.
+func DetectCompression(r io.ReaderAt) (Compression, error) {
+	var magic [4]byte
+	n, err := r.ReadAt(magic[:], 0)
+	if err != nil && err != io.EOF {
+		return CompressionNone, errors.Wrap(err, "failed to read file magic bytes")
+	}
+	switch {
+	case n >= 2 && binary.LittleEndian.Uint16(magic[:]) == gzipMagic:
+		return CompressionGzip, nil
+	case n == 4 && (binary.LittleEndian.Uint32(magic[:]) == zstdMagic ||
+		binary.LittleEndian.Uint32(magic[:])&^0xf == zstdSkippableMagic):
+		return CompressionZstd, nil
+	default:
+		return CompressionNone, nil
+	}
+}
+
+// DetectFileCompression detects the compression of the file from its magic bytes.
+func DetectFileCompression(filePath string) (Compression, error) {
+	return DetectCompressionFrom(source.NewLocal(filePath))
+}
+
+// DetectCompressionFrom detects the compression of the file of the line source from its magic bytes.
+func DetectCompressionFrom(src source.LineSource) (Compression, error) {
+	file, err := src.Open()
+	if err != nil {
+		return CompressionNone, errors.Wrap(err, "failed to open file")
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	return DetectCompression(file)
+}
+
+// accessPointSpacing returns the number of decompressed bytes between the access points of a compressed file.
+func (o IndexOptions) accessPointSpacing() int64 {
+	if o.AccessPointSpacing <= 0 {
+		return DefaultAccessPointSpacing
+	}
+	return o.AccessPointSpacing
+}
+
+// accessPointRecorder records the access points of a compressed file every spacing decompressed bytes,
+// as its content is decompressed from its beginning.
+type accessPointRecorder struct {
+	spacing      int64
+	accessPoints []AccessPoint
+}
+
+// record records the access point if it is the first one or far enough from the previous one.
+// The window is compressed, as the windows of the access points of a large file would not fit in memory otherwise.
+func (r *accessPointRecorder) record(bit int64, offset int64, window []byte) error {
+	if len(r.accessPoints) > 0 && offset-r.accessPoints[len(r.accessPoints)-1].Offset < r.spacing {
+		return nil
+	}
+	accessPoint := AccessPoint{Offset: offset, Bit: bit}
+	if len(window) > 0 {
+		var compressed bytes.Buffer
+		writer, err := flate.NewWriter(&compressed, flate.BestSpeed)
+		if err != nil {
+			return errors.Wrap(err, "failed to compress window")
+		}
+		if _, err := writer.Write(window); err != nil {
+			return errors.Wrap(err, "failed to compress window")
+		}
+		if err := writer.Close(); err != nil {
+			return errors.Wrap(err, "failed to compress window")
+		}
+		accessPoint.Window = compressed.Bytes()
+	}
+	r.accessPoints = append(r.accessPoints, accessPoint)
+	return nil
+}
+
+// window returns the data decompressed before the access point.
+func (p AccessPoint) window() ([]byte, error) {
+	if len(p.Window) == 0 {
+		return nil, nil
+	}
+	window, err := io.ReadAll(flate.NewReader(bytes.NewReader(p.Window)))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decompress window")
+	}
+	if len(window) > windowSize {
+		return nil, errors.New("invalid access point window")
+	}
+	return window, nil
+}
@@ -0,0 +1,322 @@
+//go:build unit
+
+package fileprocessing_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/utils"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// gzipMembers compresses the content into a gzip member for each compression level.
+func gzipMembers(t *testing.T, content string, levels ...int) string {
+	t.Helper()
+	var compressed bytes.Buffer
+	for _, level := range levels {
+		writer, err := gzip.NewWriterLevel(&compressed, level)
+		assert.Nil(t, err)
+		_, err = writer.Write([]byte(content))
+		assert.Nil(t, err)
+		assert.Nil(t, writer.Close())
+	}
+	return compressed.String()
+}
+
+// zstdFrames compresses the content into zstd frames of frameSize bytes,
+// preceded by a skippable frame like the seek table of a seekable zstd file.
+func zstdFrames(t *testing.T, content string, frameSize int) string {
+	t.Helper()
+	encoder, err := zstd.NewWriter(nil)
+	assert.Nil(t, err)
+	compressed := []byte{0x5e, 0x2a, 0x4d, 0x18, 3, 0, 0, 0, 1, 2, 3}
+	for start := 0; start < len(content); start += frameSize {
+		compressed = encoder.EncodeAll([]byte(content[start:min(start+frameSize, len(content))]), compressed)
+	}
+	return string(compressed)
+}
+
+// generatedLines generates count lines of random sizes, so the lines cross the deflate blocks and zstd frames.
+func generatedLines(count int) string {
+	random := rand.New(rand.NewSource(1))
+	var content strings.Builder
+	for i := range count {
+		fmt.Fprintf(&content, "line %d %s\n", i, strings.Repeat(fmt.Sprintf("%x", random.Int63()), random.Intn(8)))
+	}
+	return content.String()
+}
+
+// openFile opens the file for reading until the end of the test.
+func openFile(t *testing.T, filePath string) *os.File {
+	t.Helper()
+	file, err := os.Open(filePath)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_ = file.Close()
+	})
+	return file
+}
+
+// lineOffsets returns the offset of every line of the content.
+func lineOffsets(content string) []int64 {
+	offsets := []int64{0}
+	for i, b := range []byte(content) {
+		if b == '\n' && i+1 < len(content) {
+			offsets = append(offsets, int64(i+1))
+		}
+	}
+	return offsets
+}
+
+func TestDetectCompression(t *testing.T) {
+	tests := []struct {
+		name                string
+		content             string
+		expectedCompression fileprocessing.Compression
+	}{
+		{
+			name:                "Plain file",
+			content:             "line1\nline2\n",
+			expectedCompression: fileprocessing.CompressionNone,
+		},
+		{
+			name:                "Empty file",
+			content:             "",
+			expectedCompression: fileprocessing.CompressionNone,
+		},
+		{
+			name:                "Single byte file",
+			content:             "\x1f",
+			expectedCompression: fileprocessing.CompressionNone,
+		},
+		{
+			name:                "Gzip file",
+			content:             gzipMembers(t, "line1\nline2\n", gzip.DefaultCompression),
+			expectedCompression: fileprocessing.CompressionGzip,
+		},
+		{
+			name:                "Zstd file",
+			content:             zstdFrames(t, "line1\nline2\n", 1024)[11:],
+			expectedCompression: fileprocessing.CompressionZstd,
+		},
+		{
+			name:                "Seekable zstd file starting with a skippable frame",
+			content:             zstdFrames(t, "line1\nline2\n", 1024),
+			expectedCompression: fileprocessing.CompressionZstd,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compression, err := fileprocessing.DetectCompression(strings.NewReader(tt.content))
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedCompression, compression)
+
+			file := utils.CreateTempFile(t, tt.content)
+			compression, err = fileprocessing.DetectFileCompression(file.Name())
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedCompression, compression)
+		})
+	}
+
+	t.Run("Missing file", func(t *testing.T) {
+		_, err := fileprocessing.DetectFileCompression(filepath.Join(t.TempDir(), "missing"))
+		assert.ErrorContains(t, err, "failed to open file")
+	})
+}
+
+func TestGenerateIndex_Compressed(t *testing.T) {
+	logger := zerolog.New(nil)
+	content := generatedLines(800)
+	offsets := lineOffsets(content)
+	// The members of every compression level repeat a shorter content, so the file is not four times as large
+	member := content[:strings.Index(content, "line 200 ")]
+
+	tests := []struct {
+		name                string
+		content             string
+		expectedCompression fileprocessing.Compression
+		expectedContent     string
+	}{
+		{
+			name:                "Gzip file",
+			content:             gzipMembers(t, content, gzip.DefaultCompression),
+			expectedCompression: fileprocessing.CompressionGzip,
+			expectedContent:     content,
+		},
+		{
+			name: "Gzip file of several members with stored, fixed and dynamic blocks",
+			content: gzipMembers(t, member, gzip.NoCompression, gzip.HuffmanOnly, gzip.BestSpeed,
+				gzip.BestCompression),
+			expectedCompression: fileprocessing.CompressionGzip,
+			expectedContent:     strings.Repeat(member, 4),
+		},
+		{
+			name:                "Zstd file of several frames",
+			content:             zstdFrames(t, content, 8*1024),
+			expectedCompression: fileprocessing.CompressionZstd,
+			expectedContent:     content,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := utils.CreateTempFile(t, tt.content)
+			expectedOffsets := lineOffsets(tt.expectedContent)
+			if tt.expectedContent == content {
+				expectedOffsets = offsets
+			}
+			// Every line is indexed, or the index is compacted as the lines are counted
+			for _, maxIndexes := range []int{len(expectedOffsets), 3} {
+				fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), maxIndexes,
+					fileprocessing.IndexOptions{AccessPointSpacing: 8 * 1024})
+				assert.Nil(t, err)
+				assert.Equal(t, tt.expectedCompression, fileIndexSummary.Compression)
+				assert.Equal(t, len(expectedOffsets), fileIndexSummary.NumberOfLines)
+				assert.LessOrEqual(t, len(fileIndexSummary.Index), maxIndexes)
+				assert.Equal(t, int64(len(tt.content)), fileIndexSummary.FileInfo.Size)
+				// Every checkpoint is the offset of its line in the decompressed content
+				for i, offset := range fileIndexSummary.Index {
+					assert.Equal(t, expectedOffsets[i*fileIndexSummary.IndexOffset], offset)
+				}
+				assert.Greater(t, len(fileIndexSummary.AccessPoints), 1)
+				assert.Equal(t, int64(0), fileIndexSummary.AccessPoints[0].Offset)
+			}
+			fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), len(expectedOffsets),
+				fileprocessing.IndexOptions{AccessPointSpacing: 8 * 1024})
+			assert.Nil(t, err)
+			assert.Equal(t, 1, fileIndexSummary.IndexOffset)
+
+			// The content is decompressed from the closest access point of any offset
+			reader := fileprocessing.NewDecompressedReader(openFile(t, file.Name()), fileIndexSummary.Compression,
+				fileIndexSummary.AccessPoints)
+			random := rand.New(rand.NewSource(2))
+			buffer := make([]byte, 4096)
+			for range 20 {
+				offset := random.Int63n(int64(len(tt.expectedContent)))
+				n, err := reader.ReadAt(buffer, offset)
+				expected := tt.expectedContent[offset:min(offset+int64(len(buffer)), int64(len(tt.expectedContent)))]
+				assert.Equal(t, expected, string(buffer[:n]))
+				if n < len(buffer) {
+					assert.Equal(t, io.EOF, err)
+				} else {
+					assert.Nil(t, err)
+				}
+			}
+			n, err := reader.ReadAt(buffer, int64(len(tt.expectedContent)))
+			assert.Equal(t, 0, n)
+			assert.Equal(t, io.EOF, err)
+			assert.Nil(t, reader.(io.Closer).Close())
+		})
+	}
+
+	t.Run("Unterminated last line", func(t *testing.T) {
+		file := utils.CreateTempFile(t, gzipMembers(t, "line1\nline2\nline3", gzip.DefaultCompression))
+		fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), 10, fileprocessing.IndexOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{0, 6, 12}, fileIndexSummary.Index)
+		assert.Equal(t, 3, fileIndexSummary.NumberOfLines)
+	})
+
+	t.Run("Empty compressed content", func(t *testing.T) {
+		file := utils.CreateTempFile(t, gzipMembers(t, "", gzip.DefaultCompression))
+		fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), 10, fileprocessing.IndexOptions{})
+		assert.Nil(t, err)
+		assert.Nil(t, fileIndexSummary)
+	})
+
+	t.Run("Corrupted gzip file", func(t *testing.T) {
+		compressed := []byte(gzipMembers(t, content, gzip.DefaultCompression))
+		// The CRC-32 of the member no longer matches its content
+		compressed[len(compressed)-8] ^= 0xff
+		file := utils.CreateTempFile(t, string(compressed))
+		_, err := fileprocessing.GenerateIndex(&logger, file.Name(), 10, fileprocessing.IndexOptions{})
+		assert.ErrorContains(t, err, "gzip checksum mismatch")
+	})
+
+	t.Run("Truncated zstd file", func(t *testing.T) {
+		compressed := zstdFrames(t, content, 8*1024)
+		file := utils.CreateTempFile(t, compressed[:len(compressed)/2])
+		_, err := fileprocessing.GenerateIndex(&logger, file.Name(), 10, fileprocessing.IndexOptions{})
+		assert.ErrorContains(t, err, "failed to decompress zstd file")
+	})
+}
+
+func TestIndexFile_Compressed(t *testing.T) {
+	logger := zerolog.New(nil)
+	content := generatedLines(1500)
+	file := utils.CreateTempFile(t, gzipMembers(t, content, gzip.DefaultCompression))
+	opts := fileprocessing.IndexOptions{AccessPointSpacing: 16 * 1024}
+
+	t.Run("Persists the access points", func(t *testing.T) {
+		indexPath := filepath.Join(t.TempDir(), "index.idx")
+		fileIndexSummary, err := fileprocessing.LoadOrGenerateIndex(&logger, file.Name(), indexPath, 100, opts)
+		assert.Nil(t, err)
+		assert.Equal(t, 16, fileIndexSummary.IndexOffset)
+
+		persisted, err := fileprocessing.ReadIndexFile(indexPath)
+		assert.Nil(t, err)
+		assert.Equal(t, fileIndexSummary.Index, persisted.Index)
+		assert.Equal(t, fileprocessing.CompressionGzip, persisted.Compression)
+		assert.Equal(t, fileIndexSummary.AccessPoints, persisted.AccessPoints)
+
+		// The index offset of a compressed file is a power of two, so the index file is loaded for the same maximum
+		loaded, err := fileprocessing.LoadOrGenerateIndex(&logger, file.Name(), indexPath, 100, opts)
+		assert.Nil(t, err)
+		assert.Equal(t, persisted, loaded)
+	})
+
+	t.Run("Maps the dense index and the access points", func(t *testing.T) {
+		indexPath := filepath.Join(t.TempDir(), "index.idx")
+		fileIndexSummary, err := fileprocessing.GenerateMappedIndex(&logger, file.Name(), indexPath, opts)
+		assert.Nil(t, err)
+		assert.Equal(t, lineOffsets(content), fileIndexSummary.Index)
+		assert.Equal(t, fileprocessing.CompressionGzip, fileIndexSummary.Compression)
+		assert.Greater(t, len(fileIndexSummary.AccessPoints), 1)
+
+		reader := fileprocessing.NewDecompressedReader(openFile(t, file.Name()), fileIndexSummary.Compression,
+			fileIndexSummary.AccessPoints)
+		last := fileIndexSummary.Index[len(fileIndexSummary.Index)-1]
+		buffer := make([]byte, int64(len(content))-last)
+		_, err = reader.ReadAt(buffer, last)
+		assert.Nil(t, err)
+		assert.Equal(t, content[last:], string(buffer))
+		assert.Nil(t, fileIndexSummary.Close())
+	})
+
+	t.Run("Rejects the extension of the index", func(t *testing.T) {
+		fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), 100, opts)
+		assert.Nil(t, err)
+		_, err = fileprocessing.ExtendIndex(&logger, file.Name(), fileIndexSummary, 100, opts)
+		assert.EqualError(t, err, "index of a compressed file cannot be extended")
+	})
+
+	t.Run("Detects the delimiter of the decompressed content", func(t *testing.T) {
+		crlf := utils.CreateTempFile(t, gzipMembers(t, "line1\r\nline2\r\n", gzip.DefaultCompression))
+		delimiter, err := fileprocessing.ResolveDelimiter(fileprocessing.DelimiterAuto, crlf.Name())
+		assert.Nil(t, err)
+		assert.Equal(t, fileprocessing.DelimiterCRLF, delimiter)
+	})
+
+	t.Run("Rejects a corrupted access point", func(t *testing.T) {
+		indexPath := filepath.Join(t.TempDir(), "index.idx")
+		fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), 100, opts)
+		assert.Nil(t, err)
+		assert.Nil(t, fileprocessing.WriteIndexFile(indexPath, fileIndexSummary))
+		stat, err := os.Stat(indexPath)
+		assert.Nil(t, err)
+		writeAt(t, indexPath, stat.Size()-1, []byte{1})
+
+		_, err = fileprocessing.ReadIndexFile(indexPath)
+		assert.EqualError(t, err, "index file checksum mismatch")
+	})
+}
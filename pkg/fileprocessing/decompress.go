@@ -0,0 +1,332 @@
+package fileprocessing
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// zstdDecoders reuses the zstd decoders, whose buffers are expensive to allocate.
+var zstdDecoders = sync.Pool{
+	New: func() any {
+		decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+		if err != nil {
+			panic(err)
+		}
+		return decoder
+	},
+}
+
+// zstdReader decompresses the zstd frames of a file from the beginning of the file or from an access point,
+// one frame at a time, reporting the beginning of each frame, from which decompression can resume,
+// to record access points. The skippable frames, such as the seek table of a seekable zstd file, are skipped.
+type zstdReader struct {
+	file io.ReaderAt
+	// offset is the offset of the compressed file of the next frame, and total the offset of the decompressed content
+	offset  int64
+	total   int64
+	decoder *zstd.Decoder
+	inFrame bool
+
+	// onFrame is called with the bit offset of the compressed file and the offset of the decompressed content
+	// at the beginning of each frame, if set
+	onFrame func(bit int64, offset int64, window []byte) error
+}
+
+// newZstdReader creates a reader of the zstd frames of the file from its beginning,
+// or from the access point if not nil.
+func newZstdReader(file io.ReaderAt, accessPoint *AccessPoint) *zstdReader {
+	r := &zstdReader{
+		file:    file,
+		decoder: zstdDecoders.Get().(*zstd.Decoder),
+	}
+	if accessPoint != nil {
+		r.offset = accessPoint.Bit / 8
+		r.total = accessPoint.Offset
+	}
+	return r
+}
+
+// Read reads the decompressed content, moving to the next frame once a frame is decompressed.
+func (r *zstdReader) Read(p []byte) (int, error) {
+	for {
+		if !r.inFrame {
+			size, skippable, err := zstdFrameSize(r.file, r.offset)
+			if err != nil {
+				return 0, err
+			}
+			if skippable {
+				r.offset += size
+				continue
+			}
+			if r.onFrame != nil {
+				if err := r.onFrame(r.offset*8, r.total, nil); err != nil {
+					return 0, err
+				}
+			}
+			if err := r.decoder.Reset(io.NewSectionReader(r.file, r.offset, size)); err != nil {
+				return 0, errors.Wrap(err, "failed to decompress zstd frame")
+			}
+			r.offset += size
+			r.inFrame = true
+		}
+		n, err := r.decoder.Read(p)
+		r.total += int64(n)
+		if err == io.EOF {
+			r.inFrame = false
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		if err != nil {
+			return n, errors.Wrap(err, "failed to decompress zstd frame")
+		}
+		return n, nil
+	}
+}
+
+// Close returns the decoder to the pool, so the reader cannot be used anymore.
+func (r *zstdReader) Close() error {
+	if r.decoder != nil {
+		_ = r.decoder.Reset(nil)
+		zstdDecoders.Put(r.decoder)
+		r.decoder = nil
+	}
+	return nil
+}
+
+// zstdFrameSize returns the size of the zstd frame at the offset of the compressed file and whether it is skippable,
+// walking the headers of its blocks. It returns io.EOF if the file ends at the offset.
+func zstdFrameSize(file io.ReaderAt, offset int64) (int64, bool, error) {
+	var header [8]byte
+	n, err := file.ReadAt(header[:], offset)
+	switch {
+	case n == 0 && err == io.EOF:
+		return 0, false, io.EOF
+	case n < len(header) && err != io.EOF:
+		return 0, false, errors.Wrap(err, "error reading file")
+	case n < 5:
+		return 0, false, errors.New("truncated zstd frame")
+	}
+	magic := binary.LittleEndian.Uint32(header[:4])
+	if magic&^0xf == zstdSkippableMagic {
+		if n < 8 {
+			return 0, false, errors.New("truncated zstd frame")
+		}
+		return 8 + int64(binary.LittleEndian.Uint32(header[4:])), true, nil
+	}
+	if magic != zstdMagic {
+		return 0, false, errors.New("invalid zstd frame")
+	}
+	descriptor := header[4]
+	singleSegment := descriptor&0x20 != 0
+	position := offset + 5 + int64([4]int{0, 1, 2, 4}[descriptor&0x3])
+	if !singleSegment {
+		// The window descriptor
+		position++
+	}
+	switch contentSizeFlag := descriptor >> 6; {
+	case contentSizeFlag == 0 && singleSegment:
+		position++
+	case contentSizeFlag > 0:
+		position += 1 << contentSizeFlag
+	}
+	for {
+		var blockHeader [3]byte
+		if _, err := file.ReadAt(blockHeader[:], position); err != nil {
+			if err == io.EOF {
+				return 0, false, errors.New("truncated zstd frame")
+			}
+			return 0, false, errors.Wrap(err, "error reading file")
+		}
+		value := uint32(blockHeader[0]) | uint32(blockHeader[1])<<8 | uint32(blockHeader[2])<<16
+		position += 3
+		switch blockType := value >> 1 & 0x3; blockType {
+		case 1:
+			// A RLE block holds a single byte repeated
+			position++
+		case 3:
+			return 0, false, errors.New("invalid zstd block")
+		default:
+			position += int64(value >> 3)
+		}
+		if value&1 == 1 {
+			break
+		}
+	}
+	// The content checksum follows the last block
+	if descriptor&0x4 != 0 {
+		position += 4
+	}
+	return position - offset, false, nil
+}
+
+// decompressionStream is the decompressed content of a compressed file from a position,
+// which reports the beginning of the deflate blocks or zstd frames from which decompression can resume.
+type decompressionStream interface {
+	io.ReadCloser
+	setOnAccessPoint(fn func(bit int64, offset int64, window []byte) error)
+}
+
+func (f *inflater) setOnAccessPoint(fn func(bit int64, offset int64, window []byte) error) {
+	f.onBlock = fn
+}
+
+func (r *zstdReader) setOnAccessPoint(fn func(bit int64, offset int64, window []byte) error) {
+	r.onFrame = fn
+}
+
+// openDecompressionStream opens the decompressed content of the compressed file from its beginning,
+// or from the access point if not nil.
+func openDecompressionStream(file io.ReaderAt, compression Compression, accessPoint *AccessPoint,
+) (decompressionStream, error) {
+	switch compression {
+	case CompressionGzip:
+		return newInflater(file, accessPoint)
+	case CompressionZstd:
+		return newZstdReader(file, accessPoint), nil
+	default:
+		return nil, errors.Errorf("unsupported compression %q", compression)
+	}
+}
+
+// scanDecompressed decompresses the compressed file from its beginning, calling fn with each chunk of
+// the decompressed content and its offset, and records an access point every spacing decompressed bytes.
+// It returns the access points and the size of the decompressed content.
+func scanDecompressed(file io.ReaderAt, compression Compression, spacing int64, buffer []byte,
+	fn func(chunk []byte, offset int64) error,
+) ([]AccessPoint, int64, error) {
+	stream, err := openDecompressionStream(file, compression, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() {
+		_ = stream.Close()
+	}()
+	recorder := &accessPointRecorder{spacing: spacing}
+	stream.setOnAccessPoint(recorder.record)
+	var offset int64
+	for {
+		n, err := stream.Read(buffer)
+		if n > 0 {
+			if err := fn(buffer[:n], offset); err != nil {
+				return nil, 0, err
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF {
+			return recorder.accessPoints, offset, nil
+		}
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "failed to decompress %s file", compression)
+		}
+	}
+}
+
+// NewDecompressedReader returns a reader of the decompressed content of the file with positional reads,
+// or the file itself if it is not compressed.
+// Each read decompresses the file from the closest access point before the read position,
+// or from the beginning of the file without access points, unless it follows the previous read,
+// which is continued, so sequential reads decompress the file once.
+// The reader of a compressed file implements io.Closer, to release its stream once the reads are done.
+func NewDecompressedReader(file io.ReaderAt, compression Compression, accessPoints []AccessPoint) io.ReaderAt {
+	if compression == CompressionNone {
+		return file
+	}
+	return &decompressedReader{file: file, compression: compression, accessPoints: accessPoints}
+}
+
+// decompressedReader reads the decompressed content of a compressed file with positional reads.
+// Concurrent reads are serialized, as they share the stream continued by the sequential reads.
+type decompressedReader struct {
+	file         io.ReaderAt
+	compression  Compression
+	accessPoints []AccessPoint
+
+	mu sync.Mutex
+	// stream is the stream of the previous read, positioned at the offset of the decompressed content
+	stream   decompressionStream
+	position int64
+}
+
+// ReadAt reads the decompressed content at the offset, returning io.EOF if it ends before the buffer is filled.
+func (r *decompressedReader) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	// The stream is continued unless it is beyond the offset or an access point is closer to the offset
+	i := sort.Search(len(r.accessPoints), func(i int) bool {
+		return r.accessPoints[i].Offset > off
+	}) - 1
+	if r.stream == nil || r.position > off || (i >= 0 && r.accessPoints[i].Offset > r.position) {
+		if err := r.open(i); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := io.CopyN(io.Discard, r.stream, off-r.position); err != nil {
+		r.close()
+		if err == io.EOF {
+			return 0, io.EOF
+		}
+		return 0, err
+	}
+	r.position = off
+	n, err := io.ReadFull(r.stream, p)
+	r.position += int64(n)
+	switch err {
+	case nil:
+		return n, nil
+	case io.EOF, io.ErrUnexpectedEOF:
+		r.close()
+		return n, io.EOF
+	default:
+		r.close()
+		return n, err
+	}
+}
+
+// Close closes the stream of the previous read, returning its decoder to the pool.
+func (r *decompressedReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.close()
+	return nil
+}
+
+// open opens the stream from the access point of the index, or from the beginning of the file if negative.
+func (r *decompressedReader) open(i int) error {
+	r.close()
+	var accessPoint *AccessPoint
+	if i >= 0 {
+		accessPoint = &r.accessPoints[i]
+		r.position = accessPoint.Offset
+	}
+	stream, err := openDecompressionStream(r.file, r.compression, accessPoint)
+	if err != nil {
+		return err
+	}
+	r.stream = stream
+	return nil
+}
+
+// close closes the stream, so the next read opens a new one.
+func (r *decompressedReader) close() {
+	if r.stream != nil {
+		_ = r.stream.Close()
+		r.stream = nil
+	}
+	r.position = 0
+}
+
+// newSectionReaderFrom creates a reader of the file from the offset until its end.
+func newSectionReaderFrom(file io.ReaderAt, offset int64) *io.SectionReader {
+	return io.NewSectionReader(file, offset, math.MaxInt64-offset)
+}
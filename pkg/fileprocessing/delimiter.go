@@ -0,0 +1,140 @@
+package fileprocessing
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/source"
+)
+
+// delimiterSampleSize defines the size of the beginning of the file sampled to detect its line delimiter.
+const delimiterSampleSize = 64 * 1024
+
+// Delimiter defines how the lines of a file are terminated.
+// Besides the named delimiters, a custom delimiter is a single byte terminating every line, such as "|".
+type Delimiter string
+
+const (
+	// DelimiterAuto detects the line delimiter from the beginning of the file.
+	DelimiterAuto Delimiter = "auto"
+	// DelimiterLF terminates lines with `\n`.
+	DelimiterLF Delimiter = "lf"
+	// DelimiterCRLF terminates lines with `\r\n`.
+	// Lines terminated with `\n` only are also accepted, so files with mixed line endings are supported.
+	DelimiterCRLF Delimiter = "crlf"
+	// DelimiterNUL terminates lines with the NUL byte.
+	DelimiterNUL Delimiter = "nul"
+)
+
+// Validate checks if the delimiter is a named delimiter or a single byte.
+// An empty delimiter is valid and defaults to DelimiterLF.
+func (d Delimiter) Validate() error {
+	switch d {
+	case "", DelimiterAuto, DelimiterLF, DelimiterCRLF, DelimiterNUL:
+		return nil
+	}
+	if len(d) != 1 {
+		return errors.Errorf("invalid line delimiter %q, it must be auto, lf, crlf, nul or a single byte", string(d))
+	}
+	return nil
+}
+
+// Terminator returns the byte terminating every line.
+// The line offsets only depend on the terminator, as the carriage return of CRLF is part of the line bytes.
+func (d Delimiter) Terminator() byte {
+	switch {
+	case d == DelimiterNUL:
+		return 0
+	case len(d) == 1:
+		return d[0]
+	default:
+		return '\n'
+	}
+}
+
+// Trim removes the line terminator, and the carriage return preceding it for CRLF, from a line.
+func (d Delimiter) Trim(line []byte) []byte {
+	line = bytes.TrimSuffix(line, []byte{d.Terminator()})
+	if d == DelimiterCRLF {
+		line = bytes.TrimSuffix(line, []byte{'\r'})
+	}
+	return line
+}
+
+// DetectDelimiter detects the line delimiter from the beginning of the content.
+// Text lines do not contain the NUL byte, so content containing it is considered NUL terminated.
+// Otherwise, the first `\n` identifies a CRLF or LF file, depending on whether it is preceded by `\r`.
+func DetectDelimiter(r io.ReaderAt, size int64) (Delimiter, error) {
+	buffer := make([]byte, min(size, delimiterSampleSize))
+	n, err := r.ReadAt(buffer, 0)
+	if err != nil && err != io.EOF {
+		return "", errors.Wrap(err, "failed to read file sample")
+	}
+	buffer = buffer[:n]
+	if bytes.IndexByte(buffer, 0) >= 0 {
+		return DelimiterNUL, nil
+	}
+	if i := bytes.IndexByte(buffer, '\n'); i > 0 && buffer[i-1] == '\r' {
+		return DelimiterCRLF, nil
+	}
+	return DelimiterLF, nil
+}
+
+// ResolveDelimiter validates the delimiter and, for DelimiterAuto, detects it from the file,
+// or from the decompressed content of a compressed file.
+func ResolveDelimiter(d Delimiter, filePath string) (Delimiter, error) {
+	return ResolveDelimiterFrom(d, source.NewLocal(filePath))
+}
+
+// ResolveDelimiterFrom validates the delimiter and, for DelimiterAuto, detects it from the file of the line source,
+// or from the decompressed content of a compressed file.
+func ResolveDelimiterFrom(d Delimiter, src source.LineSource) (Delimiter, error) {
+	if err := d.Validate(); err != nil {
+		return "", err
+	}
+	switch d {
+	case "":
+		return DelimiterLF, nil
+	case DelimiterAuto:
+	default:
+		return d, nil
+	}
+	file, err := src.Open()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to open file")
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	stat, err := file.Stat()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to stat file")
+	}
+	// The delimiter of a compressed file is detected from the beginning of its decompressed content
+	compression, err := DetectCompression(file)
+	if err != nil {
+		return "", err
+	}
+	if compression != CompressionNone {
+		reader := NewDecompressedReader(file, compression, nil)
+		defer func() {
+			_ = reader.(io.Closer).Close()
+		}()
+		return DetectDelimiter(reader, delimiterSampleSize)
+	}
+	return DetectDelimiter(file, stat.Size)
+}
+
+// unterminatedLastLine checks if the last line of the content is not terminated,
+// in which case it is still counted as a line.
+func unterminatedLastLine(r io.ReaderAt, size int64, terminator byte) (bool, error) {
+	if size == 0 {
+		return false, nil
+	}
+	var last [1]byte
+	if _, err := r.ReadAt(last[:], size-1); err != nil && err != io.EOF {
+		return false, errors.Wrap(err, "error reading file")
+	}
+	return last[0] != terminator, nil
+}
@@ -0,0 +1,94 @@
+//go:build unit
+
+package fileprocessing_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDelimiter(t *testing.T) {
+	tests := []struct {
+		name               string
+		delimiter          fileprocessing.Delimiter
+		line               string
+		expectedTerminator byte
+		expectedLine       string
+		expectedError      string
+	}{
+		{name: "Default", line: "line\r\n", expectedTerminator: '\n', expectedLine: "line\r"},
+		{name: "LF", delimiter: fileprocessing.DelimiterLF, line: "line\r\n", expectedTerminator: '\n',
+			expectedLine: "line\r"},
+		{name: "CRLF", delimiter: fileprocessing.DelimiterCRLF, line: "line\r\n", expectedTerminator: '\n',
+			expectedLine: "line"},
+		{name: "CRLF with LF line ending", delimiter: fileprocessing.DelimiterCRLF, line: "line\n",
+			expectedTerminator: '\n', expectedLine: "line"},
+		{name: "CRLF with carriage return in the line", delimiter: fileprocessing.DelimiterCRLF, line: "li\rne\r\n",
+			expectedTerminator: '\n', expectedLine: "li\rne"},
+		{name: "NUL", delimiter: fileprocessing.DelimiterNUL, line: "line\n\x00", expectedTerminator: 0,
+			expectedLine: "line\n"},
+		{name: "Custom byte", delimiter: ";", line: "line;", expectedTerminator: ';', expectedLine: "line"},
+		{name: "Unterminated line", delimiter: fileprocessing.DelimiterCRLF, line: "line", expectedTerminator: '\n',
+			expectedLine: "line"},
+		{name: "Invalid delimiter", delimiter: "tab", expectedError: `invalid line delimiter "tab", ` +
+			"it must be auto, lf, crlf, nul or a single byte"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.delimiter.Validate()
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedTerminator, tt.delimiter.Terminator())
+			assert.Equal(t, tt.expectedLine, string(tt.delimiter.Trim([]byte(tt.line))))
+		})
+	}
+}
+
+func TestDetectDelimiter(t *testing.T) {
+	tests := []struct {
+		name              string
+		content           string
+		expectedDelimiter fileprocessing.Delimiter
+	}{
+		{name: "Empty file", content: "", expectedDelimiter: fileprocessing.DelimiterLF},
+		{name: "LF", content: "line1\nline2\r\n", expectedDelimiter: fileprocessing.DelimiterLF},
+		{name: "CRLF", content: "line1\r\nline2\n", expectedDelimiter: fileprocessing.DelimiterCRLF},
+		{name: "NUL", content: "line1\x00line2\x00", expectedDelimiter: fileprocessing.DelimiterNUL},
+		{name: "NUL with LF in the lines", content: "line\n1\x00line2\x00",
+			expectedDelimiter: fileprocessing.DelimiterNUL},
+		{name: "Single unterminated line", content: "line1", expectedDelimiter: fileprocessing.DelimiterLF},
+		{name: "Line ending beyond the sample", content: strings.Repeat("a", 70*1024) + "\r\n",
+			expectedDelimiter: fileprocessing.DelimiterLF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := utils.CreateTempFile(t, tt.content)
+			delimiter, err := fileprocessing.DetectDelimiter(strings.NewReader(tt.content), int64(len(tt.content)))
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedDelimiter, delimiter)
+
+			resolved, err := fileprocessing.ResolveDelimiter(fileprocessing.DelimiterAuto, file.Name())
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedDelimiter, resolved)
+		})
+	}
+
+	t.Run("Explicit delimiter is not detected", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\r\nline2\r\n")
+		delimiter, err := fileprocessing.ResolveDelimiter(fileprocessing.DelimiterNUL, file.Name())
+		assert.Nil(t, err)
+		assert.Equal(t, fileprocessing.DelimiterNUL, delimiter)
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		_, err := fileprocessing.ResolveDelimiter(fileprocessing.DelimiterAuto, "nonexistent_file.txt")
+		assert.EqualError(t, err, "failed to open file: open nonexistent_file.txt: no such file or directory")
+	})
+}
@@ -0,0 +1,78 @@
+package fileprocessing
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/source"
+)
+
+// fingerprintSampleSize defines the size of each block sampled to compute the content fingerprint.
+const fingerprintSampleSize = 64 * 1024
+
+// FileInfo identifies the version of a file an index was generated from.
+type FileInfo struct {
+	Size        int64
+	ModTime     time.Time
+	Fingerprint string
+}
+
+// Matches reports whether both file infos describe the same version of a file.
+func (i FileInfo) Matches(other FileInfo) bool {
+	return i.Size == other.Size && i.ModTime.Equal(other.ModTime) && i.Fingerprint == other.Fingerprint
+}
+
+// ReadFileInfo reads the size and modification time of a file and computes its content fingerprint.
+func ReadFileInfo(filePath string) (FileInfo, error) {
+	return ReadFileInfoFrom(source.NewLocal(filePath))
+}
+
+// ReadFileInfoFrom reads the size and modification time of the file of the line source
+// and computes its content fingerprint.
+func ReadFileInfoFrom(src source.LineSource) (FileInfo, error) {
+	file, err := src.Open()
+	if err != nil {
+		return FileInfo{}, errors.Wrap(err, "failed to open file")
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	stat, err := file.Stat()
+	if err != nil {
+		return FileInfo{}, errors.Wrap(err, "failed to stat file")
+	}
+	fingerprint, err := Fingerprint(file, stat.Size)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return FileInfo{
+		Size:        stat.Size,
+		ModTime:     stat.ModTime,
+		Fingerprint: fingerprint,
+	}, nil
+}
+
+// Fingerprint computes a SHA-256 fingerprint of the file content.
+// Hashing the whole content is too slow for very large files, so the fingerprint is computed
+// from the file size and blocks sampled at the beginning, the middle and the end of the file.
+func Fingerprint(r io.ReaderAt, size int64) (string, error) {
+	hash := sha256.New()
+	var sizeBytes [8]byte
+	binary.LittleEndian.PutUint64(sizeBytes[:], uint64(size))
+	hash.Write(sizeBytes[:])
+
+	buffer := make([]byte, fingerprintSampleSize)
+	for _, start := range []int64{0, size/2 - fingerprintSampleSize/2, size - fingerprintSampleSize} {
+		start = max(start, 0)
+		n, err := r.ReadAt(buffer[:min(int64(fingerprintSampleSize), size-start)], start)
+		if err != nil && err != io.EOF {
+			return "", errors.Wrap(err, "failed to read file sample")
+		}
+		hash.Write(buffer[:n])
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,160 @@
+package fileprocessing
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/source"
+	"github.com/rs/zerolog"
+)
+
+// ExtendIndex extends the file index summary of a file that only grows, such as a log,
+// scanning the bytes appended since its last checkpoint instead of the whole file.
+// The new summary keeps the index offset and shares the checkpoints of the previous summary, which is not modified
+// and can still be read concurrently, so only the latest summary of a file may be extended.
+// Only terminated lines are counted, so a partially written last line is not served until its terminator arrives,
+// except for an unterminated last line of the indexed file, already counted, so the number of lines never decreases.
+// The unterminated last line is never counted if the index only counts terminated lines, as set by the options.
+// If the checkpoints exceed maxIndexes, the index offset is doubled until they fit.
+// If maxIndexes is 0, it is calculated from the available memory.
+func ExtendIndex(logger *zerolog.Logger, filePath string, fileIndexSummary *FileIndexSummary, maxIndexes int,
+	opts IndexOptions,
+) (*FileIndexSummary, error) {
+	if filePath == "" {
+		return nil, errors.New("file path cannot be empty")
+	}
+	return ExtendIndexFrom(logger, source.NewLocal(filePath), fileIndexSummary, maxIndexes, opts)
+}
+
+// ExtendIndexFrom extends the file index summary of the file of the line source,
+// like ExtendIndex does for a local file.
+func ExtendIndexFrom(logger *zerolog.Logger, src source.LineSource, fileIndexSummary *FileIndexSummary,
+	maxIndexes int, opts IndexOptions,
+) (*FileIndexSummary, error) {
+	// Validate arguments
+	if logger == nil {
+		return nil, errors.New("logger cannot be nil")
+	}
+	if src == nil {
+		return nil, errors.New("source cannot be nil")
+	}
+	if fileIndexSummary == nil || len(fileIndexSummary.Index) == 0 || fileIndexSummary.IndexOffset <= 0 {
+		return nil, errors.New("file index summary is required")
+	}
+	if fileIndexSummary.Mode == IndexModeMmap {
+		return nil, errors.New("memory-mapped index cannot be extended")
+	}
+	// The content appended to a compressed file cannot be decompressed on its own
+	if fileIndexSummary.Compression != CompressionNone {
+		return nil, errors.New("index of a compressed file cannot be extended")
+	}
+	terminator := opts.Delimiter.Terminator()
+	if fileIndexSummary.Terminator != terminator {
+		return nil, errors.New("index has another line delimiter")
+	}
+	if fileIndexSummary.TerminatedLinesOnly != opts.TerminatedLinesOnly {
+		return nil, errors.New("index counts another last line")
+	}
+	file, err := src.Open()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open file")
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Error().Err(err).Msg("failed to close file")
+		}
+	}()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to stat file")
+	}
+	// The indexed bytes must be unchanged, so the checkpoints are still valid
+	indexedSize := fileIndexSummary.FileInfo.Size
+	if stat.Size < indexedSize {
+		return nil, errors.New("file was truncated")
+	}
+	fingerprint, err := Fingerprint(file, indexedSize)
+	if err != nil {
+		return nil, err
+	}
+	if fingerprint != fileIndexSummary.FileInfo.Fingerprint {
+		return nil, errors.New("file was modified before its indexed size")
+	}
+	if maxIndexes == 0 {
+		maxIndexes, err = AvailableIndexes(logger, opts.ReservedMemory)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if maxIndexes <= 0 {
+		return nil, errors.New("insufficient memory available for indexing")
+	}
+
+	start := time.Now()
+	// The lines following the last checkpoint are scanned again, as the last line may have been unterminated
+	last := len(fileIndexSummary.Index) - 1
+	indexOffset := fileIndexSummary.IndexOffset
+	firstLine := last * indexOffset
+	workers := opts.workers()
+	ranges := splitRanges(stat.Size-fileIndexSummary.Index[last], workers)
+	for i := range ranges {
+		ranges[i].start += fileIndexSummary.Index[last]
+		ranges[i].end += fileIndexSummary.Index[last]
+	}
+	// The checkpoints are appended in place after the ones of the previous summary, which does not read beyond its
+	// length, and the index grows like an appended slice, so its capacity is reused by the following extensions
+	c := checkpoints{index: fileIndexSummary.Index[:last+1], indexOffset: indexOffset, maxIndexes: maxIndexes,
+		lineEnds: firstLine}
+	scan := func(i int, buffer []byte) ([]uint32, error) {
+		return collectRelativeLineEnds(file, ranges[i], terminator, buffer)
+	}
+	err = scanRanges(ranges, workers, scan, func(i int, lineEnds []uint32) error {
+		c.add(ranges[i].start, lineEnds)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	linesCount := c.lineEnds
+	if !fileIndexSummary.TerminatedLinesOnly {
+		// The unterminated last line of the indexed file was counted by the previous summary, so it is still counted
+		linesCount = max(linesCount, fileIndexSummary.NumberOfLines)
+	}
+	if linesCount == 0 {
+		return nil, nil
+	}
+	index, indexOffset := c.finish(linesCount)
+	logger.Info().
+		Int64("appended_bytes", stat.Size-indexedSize).
+		Int("number_of_lines", linesCount).
+		Int("index_offset", indexOffset).
+		Dur("duration", time.Since(start)).
+		Msg("index extended")
+
+	fingerprint, err = Fingerprint(file, stat.Size)
+	if err != nil {
+		return nil, err
+	}
+	return &FileIndexSummary{
+		Index:         index,
+		IndexOffset:   indexOffset,
+		NumberOfLines: linesCount,
+		Terminator:    terminator,
+		Mode:          IndexModeMemory,
+		FileInfo: FileInfo{
+			Size:        stat.Size,
+			ModTime:     stat.ModTime,
+			Fingerprint: fingerprint,
+		},
+		TerminatedLinesOnly: opts.TerminatedLinesOnly,
+	}, nil
+}
+
+// compactIndex doubles the index offset by keeping every other checkpoint, into a new index.
+func compactIndex(index []int64, indexOffset int) ([]int64, int) {
+	compacted := make([]int64, (len(index)+1)/2)
+	for i := range compacted {
+		compacted[i] = index[2*i]
+	}
+	return compacted, 2 * indexOffset
+}
@@ -0,0 +1,206 @@
+//go:build unit
+
+package fileprocessing_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/utils"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// appendToFile appends the content to the file, as a log is written
+func appendToFile(t *testing.T, filePath string, content string) {
+	t.Helper()
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0)
+	assert.Nil(t, err)
+	_, err = file.WriteString(content)
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+}
+
+func TestExtendIndex(t *testing.T) {
+	logger := zerolog.New(nil)
+	tests := []struct {
+		name                  string
+		content               string
+		appended              []string
+		maxIndexes            int
+		terminatedLinesOnly   bool
+		expectedIndex         []int64
+		expectedIndexOffset   int
+		expectedNumberOfLines int
+	}{
+		{
+			name:                  "Appended lines",
+			content:               "line1\nline2\n",
+			appended:              []string{"line3\nline4\n"},
+			maxIndexes:            10,
+			expectedIndex:         []int64{0, 6, 12, 18},
+			expectedIndexOffset:   1,
+			expectedNumberOfLines: 4,
+		},
+		{
+			name:                  "Partially written last line",
+			content:               "line1\n",
+			appended:              []string{"line2\nli"},
+			maxIndexes:            10,
+			expectedIndex:         []int64{0, 6},
+			expectedIndexOffset:   1,
+			expectedNumberOfLines: 2,
+		},
+		{
+			name:                  "Partially written last line completed",
+			content:               "line1\n",
+			appended:              []string{"line2\nli", "ne3\n"},
+			maxIndexes:            10,
+			expectedIndex:         []int64{0, 6, 12},
+			expectedIndexOffset:   1,
+			expectedNumberOfLines: 3,
+		},
+		{
+			name:                  "Unterminated last line of the indexed file",
+			content:               "line1\nline2",
+			appended:              []string{"-end\nline3\n"},
+			maxIndexes:            10,
+			expectedIndex:         []int64{0, 6, 16},
+			expectedIndexOffset:   1,
+			expectedNumberOfLines: 3,
+		},
+		{
+			name:                  "Unterminated last line of the indexed file still unterminated",
+			content:               "line1\nline2",
+			appended:              []string{"-end"},
+			maxIndexes:            10,
+			expectedIndex:         []int64{0, 6},
+			expectedIndexOffset:   1,
+			expectedNumberOfLines: 2,
+		},
+		{
+			name:                  "Unterminated last line of the indexed file followed by a partially written line",
+			content:               "line1\nline2",
+			appended:              []string{"-end\nli"},
+			maxIndexes:            10,
+			expectedIndex:         []int64{0, 6},
+			expectedIndexOffset:   1,
+			expectedNumberOfLines: 2,
+		},
+		{
+			name:                  "Unterminated last line of the indexed file left out",
+			content:               "line1\nli",
+			maxIndexes:            10,
+			terminatedLinesOnly:   true,
+			expectedIndex:         []int64{0},
+			expectedIndexOffset:   1,
+			expectedNumberOfLines: 1,
+		},
+		{
+			name:                  "Unterminated last line of the indexed file left out until terminated",
+			content:               "line1\nli",
+			appended:              []string{"ne2", "\nline3"},
+			maxIndexes:            10,
+			terminatedLinesOnly:   true,
+			expectedIndex:         []int64{0, 6},
+			expectedIndexOffset:   1,
+			expectedNumberOfLines: 2,
+		},
+		{
+			name:                  "Sparse index",
+			content:               "line1\nline2\nline3\nline4\n",
+			appended:              []string{"line5\nline6\n"},
+			maxIndexes:            3,
+			expectedIndex:         []int64{0, 12, 24},
+			expectedIndexOffset:   2,
+			expectedNumberOfLines: 6,
+		},
+		{
+			name:                  "Index offset doubled to fit max indexes",
+			content:               "line1\nline2\nline3\nline4\n",
+			appended:              []string{"line5\nline6\nline7\nline8\n"},
+			maxIndexes:            4,
+			expectedIndex:         []int64{0, 12, 24, 36},
+			expectedIndexOffset:   2,
+			expectedNumberOfLines: 8,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := utils.CreateTempFile(t, tt.content)
+			opts := fileprocessing.IndexOptions{TerminatedLinesOnly: tt.terminatedLinesOnly}
+			fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), tt.maxIndexes, opts)
+			assert.Nil(t, err)
+			previousIndex := append([]int64(nil), fileIndexSummary.Index...)
+			previous := fileIndexSummary
+			for _, content := range tt.appended {
+				appendToFile(t, file.Name(), content)
+				fileIndexSummary, err = fileprocessing.ExtendIndex(&logger, file.Name(), fileIndexSummary,
+					tt.maxIndexes, opts)
+				assert.Nil(t, err)
+			}
+
+			assert.Equal(t, tt.expectedIndex, fileIndexSummary.Index)
+			assert.Equal(t, tt.expectedIndexOffset, fileIndexSummary.IndexOffset)
+			assert.Equal(t, tt.expectedNumberOfLines, fileIndexSummary.NumberOfLines)
+			assert.Equal(t, tt.terminatedLinesOnly, fileIndexSummary.TerminatedLinesOnly)
+			fileInfo, err := fileprocessing.ReadFileInfo(file.Name())
+			assert.Nil(t, err)
+			assert.Equal(t, fileInfo, fileIndexSummary.FileInfo)
+			// The previous summary can still be read concurrently
+			assert.Equal(t, previousIndex, previous.Index)
+		})
+	}
+}
+
+func TestExtendIndex_Errors(t *testing.T) {
+	logger := zerolog.New(nil)
+	generate := func(t *testing.T, content string) (*os.File, *fileprocessing.FileIndexSummary) {
+		file := utils.CreateTempFile(t, content)
+		fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), 10, fileprocessing.IndexOptions{})
+		assert.Nil(t, err)
+		return file, fileIndexSummary
+	}
+
+	t.Run("Missing file index summary", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\n")
+		_, err := fileprocessing.ExtendIndex(&logger, file.Name(), nil, 10, fileprocessing.IndexOptions{})
+		assert.EqualError(t, err, "file index summary is required")
+	})
+
+	t.Run("Memory-mapped index", func(t *testing.T) {
+		file, fileIndexSummary := generate(t, "line1\n")
+		fileIndexSummary.Mode = fileprocessing.IndexModeMmap
+		_, err := fileprocessing.ExtendIndex(&logger, file.Name(), fileIndexSummary, 10, fileprocessing.IndexOptions{})
+		assert.EqualError(t, err, "memory-mapped index cannot be extended")
+	})
+
+	t.Run("Another line delimiter", func(t *testing.T) {
+		file, fileIndexSummary := generate(t, "line1\n")
+		_, err := fileprocessing.ExtendIndex(&logger, file.Name(), fileIndexSummary, 10,
+			fileprocessing.IndexOptions{Delimiter: fileprocessing.DelimiterNUL})
+		assert.EqualError(t, err, "index has another line delimiter")
+	})
+
+	t.Run("Another last line", func(t *testing.T) {
+		file, fileIndexSummary := generate(t, "line1\nline2")
+		_, err := fileprocessing.ExtendIndex(&logger, file.Name(), fileIndexSummary, 10,
+			fileprocessing.IndexOptions{TerminatedLinesOnly: true})
+		assert.EqualError(t, err, "index counts another last line")
+	})
+
+	t.Run("Truncated file", func(t *testing.T) {
+		file, fileIndexSummary := generate(t, "line1\nline2\n")
+		assert.Nil(t, os.Truncate(file.Name(), 6))
+		_, err := fileprocessing.ExtendIndex(&logger, file.Name(), fileIndexSummary, 10, fileprocessing.IndexOptions{})
+		assert.EqualError(t, err, "file was truncated")
+	})
+
+	t.Run("Modified file", func(t *testing.T) {
+		file, fileIndexSummary := generate(t, "line1\nline2\n")
+		assert.Nil(t, os.WriteFile(file.Name(), []byte("LINE1\nLINE2\nline3\n"), 0o600))
+		_, err := fileprocessing.ExtendIndex(&logger, file.Name(), fileIndexSummary, 10, fileprocessing.IndexOptions{})
+		assert.EqualError(t, err, "file was modified before its indexed size")
+	})
+}
@@ -0,0 +1,99 @@
+package fileprocessing
+
+import (
+	"bytes"
+	"io"
+	"math/bits"
+)
+
+// indexCompressed decompresses the compressed file in a single pass, as its content cannot be split into byte ranges
+// scanned concurrently, collecting the offset of every IndexOffset-th line of the decompressed content
+// and recording its access points.
+// The number of lines is unknown until the file is decompressed, so every line is indexed at first,
+// and the index offset is doubled whenever the checkpoints exceed maxIndexes.
+// It returns the index, the index offset, the number of lines, the access points and the decompressed size.
+func indexCompressed(file io.ReaderAt, compression Compression, terminator byte, maxIndexes int, spacing int64,
+) ([]int64, int, int, []AccessPoint, int64, error) {
+	index := []int64{0}
+	indexOffset := 1
+	lineEnds := 0
+	var last byte
+	scan := func(chunk []byte, offset int64) error {
+		for i := 0; ; {
+			next := bytes.IndexByte(chunk[i:], terminator)
+			if next < 0 {
+				break
+			}
+			i += next + 1
+			lineEnds++
+			if lineEnds%indexOffset == 0 {
+				index = append(index, offset+int64(i))
+				// The last checkpoint may start a line that does not exist, if the content ends with it
+				if len(index) > maxIndexes+1 {
+					index, indexOffset = compactIndex(index, indexOffset)
+				}
+			}
+		}
+		last = chunk[len(chunk)-1]
+		return nil
+	}
+	accessPoints, size, err := scanDecompressed(file, compression, spacing, make([]byte, readBufferSize), scan)
+	if err != nil {
+		return nil, 0, 0, nil, 0, err
+	}
+	linesCount := lineEnds
+	if size > 0 && last != terminator {
+		linesCount++
+	}
+	if linesCount == 0 {
+		return nil, 0, 0, nil, 0, nil
+	}
+	index = index[:entriesFor(linesCount, indexOffset)]
+	for len(index) > maxIndexes {
+		index, indexOffset = compactIndex(index, indexOffset)
+	}
+	return index, indexOffset, linesCount, accessPoints, size, nil
+}
+
+// compactedIndexOffsetFor calculates the index offset of the index of a compressed file with linesCount lines,
+// which is the smallest power of two for which the index has at most maxIndexes entries.
+func compactedIndexOffsetFor(linesCount int, maxIndexes int) int {
+	indexOffset := indexOffsetFor(linesCount, maxIndexes)
+	if indexOffset <= 1 {
+		return 1
+	}
+	return 1 << bits.Len(uint(indexOffset-1))
+}
+
+// writeDecompressedLineOffsets decompresses the compressed file, streaming the offset of every line of the
+// decompressed content to the index file, and returns the access points of the file.
+func writeDecompressedLineOffsets(file io.ReaderAt, compression Compression, terminator byte, spacing int64,
+	writer *indexFileWriter,
+) ([]AccessPoint, error) {
+	var lineStart int64
+	scan := func(chunk []byte, offset int64) error {
+		for i := 0; ; {
+			next := bytes.IndexByte(chunk[i:], terminator)
+			if next < 0 {
+				break
+			}
+			i += next + 1
+			if err := writer.append(lineStart); err != nil {
+				return err
+			}
+			lineStart = offset + int64(i)
+		}
+		return nil
+	}
+	accessPoints, size, err := scanDecompressed(file, compression, spacing, make([]byte, readBufferSize), scan)
+	if err != nil {
+		return nil, err
+	}
+	// The last line is unterminated if it starts before the end of the content
+	if lineStart < size {
+		if err := writer.append(lineStart); err != nil {
+			return nil, err
+		}
+	}
+	return accessPoints, nil
+}
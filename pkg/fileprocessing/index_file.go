@@ -0,0 +1,420 @@
+package fileprocessing
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/source"
+	"github.com/rs/zerolog"
+)
+
+// indexFileMagic identifies a line server index file.
+var indexFileMagic = [8]byte{'L', 'S', 'I', 'N', 'D', 'E', 'X', 0}
+
+// indexFileVersion is the version of the index file layout.
+// It must be incremented whenever the layout changes, so outdated index files are rebuilt.
+const indexFileVersion = 3
+
+// indexFileHeaderSize is the size of the encoded indexFileHeader.
+const indexFileHeaderSize = 112
+
+// indexFileHeader is the fixed size header of an index file.
+// All values are little-endian and the header size is a multiple of 8 bytes,
+// so the offsets that follow it are aligned and can be memory-mapped.
+// The lowest byte of Flags holds the line terminator the offsets were computed with,
+// the next byte the compression of the file, and the lowest bit of the third byte whether an unterminated last line
+// was left out of the indexed lines.
+// The entries are followed by the AccessPoints of a compressed file, which take AccessPointsSize bytes:
+// the offset, bit and window length of each access point, followed by its window padded to a multiple of 8 bytes.
+type indexFileHeader struct {
+	Magic         [8]byte
+	Version       uint32
+	Flags         uint32
+	FileSize      int64
+	ModTime       int64
+	Fingerprint   [32]byte
+	IndexOffset   int64
+	NumberOfLines int64
+	Entries       int64
+	// AccessPoints and AccessPointsSize describe the access points following the entries
+	AccessPoints     int64
+	AccessPointsSize int64
+	Checksum         uint32
+	_                uint32
+}
+
+// compressionCodes are the codes of the compressions stored in the flags of the index file header.
+var compressionCodes = []Compression{CompressionNone, CompressionGzip, CompressionZstd}
+
+// IndexFilePath returns the default path of the index file persisted alongside the given file.
+func IndexFilePath(filePath string) string {
+	return filePath + ".idx"
+}
+
+// WriteIndexFile persists the file index summary to a versioned binary index file.
+// The index is written to a temporary file that is renamed once complete,
+// so a partially written index file is never loaded.
+func WriteIndexFile(indexPath string, fileIndexSummary *FileIndexSummary) error {
+	if fileIndexSummary == nil {
+		return errors.New("file index summary cannot be nil")
+	}
+	if fileIndexSummary.IndexOffset <= 0 ||
+		len(fileIndexSummary.Index) != entriesFor(fileIndexSummary.NumberOfLines, fileIndexSummary.IndexOffset) {
+		return errors.New("invalid file index summary")
+	}
+	writer, err := createIndexFileWriter(indexPath)
+	if err != nil {
+		return err
+	}
+	defer writer.abort()
+	for _, offset := range fileIndexSummary.Index {
+		if err := writer.append(offset); err != nil {
+			return err
+		}
+	}
+	if err := writer.appendAccessPoints(fileIndexSummary.AccessPoints); err != nil {
+		return err
+	}
+	return writer.commit(fileIndexSummary.FileInfo, fileIndexSummary.Terminator, fileIndexSummary.Compression,
+		fileIndexSummary.TerminatedLinesOnly, fileIndexSummary.IndexOffset, fileIndexSummary.NumberOfLines)
+}
+
+// ReadIndexFile loads a file index summary from an index file into memory.
+// An error is returned if the index file is missing, has an unsupported version or is corrupted.
+func ReadIndexFile(indexPath string) (*FileIndexSummary, error) {
+	file, err := os.Open(indexPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open index file")
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to stat index file")
+	}
+	reader := bufio.NewReader(file)
+	header, err := readIndexFileHeader(reader, stat.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	index := make([]int64, header.Entries)
+	checksum := crc32.NewIEEE()
+	var buffer [8]byte
+	for i := range index {
+		if _, err := io.ReadFull(reader, buffer[:]); err != nil {
+			return nil, errors.Wrap(err, "failed to read index file entries")
+		}
+		checksum.Write(buffer[:])
+		index[i] = int64(binary.LittleEndian.Uint64(buffer[:]))
+	}
+	accessPointsData := make([]byte, header.AccessPointsSize)
+	if _, err := io.ReadFull(reader, accessPointsData); err != nil {
+		return nil, errors.Wrap(err, "failed to read index file access points")
+	}
+	checksum.Write(accessPointsData)
+	if checksum.Sum32() != header.Checksum {
+		return nil, errors.New("index file checksum mismatch")
+	}
+	accessPoints, err := decodeAccessPoints(accessPointsData, header.AccessPoints)
+	if err != nil {
+		return nil, err
+	}
+	return &FileIndexSummary{
+		Index:               index,
+		IndexOffset:         int(header.IndexOffset),
+		NumberOfLines:       int(header.NumberOfLines),
+		Terminator:          header.terminator(),
+		FileInfo:            header.fileInfo(),
+		Mode:                IndexModeMemory,
+		Compression:         header.compression(),
+		AccessPoints:        accessPoints,
+		TerminatedLinesOnly: header.terminatedLinesOnly(),
+	}, nil
+}
+
+// LoadOrGenerateIndex loads the file index summary persisted in the index file if it still matches the file.
+// Otherwise, the index is generated from the file and persisted to the index file,
+// so the next load does not need to scan the file again.
+func LoadOrGenerateIndex(logger *zerolog.Logger, filePath string, indexPath string, maxIndexes int,
+	opts IndexOptions,
+) (*FileIndexSummary, error) {
+	return LoadOrGenerateIndexFrom(logger, source.NewLocal(filePath), indexPath, maxIndexes, opts)
+}
+
+// LoadOrGenerateIndexFrom loads the file index summary persisted in the index file if it still matches
+// the file of the line source, like LoadOrGenerateIndex does for a local file.
+func LoadOrGenerateIndexFrom(logger *zerolog.Logger, src source.LineSource, indexPath string, maxIndexes int,
+	opts IndexOptions,
+) (*FileIndexSummary, error) {
+	if logger == nil {
+		return nil, errors.New("logger cannot be nil")
+	}
+	if indexPath == "" {
+		return nil, errors.New("index path cannot be empty")
+	}
+	fileInfo, err := ReadFileInfoFrom(src)
+	if err != nil {
+		return nil, err
+	}
+	fileIndexSummary, err := ReadIndexFile(indexPath)
+	switch {
+	case err != nil:
+		logger.Info().Err(err).Str("index_path", indexPath).Msg("index file cannot be loaded, generating index")
+	case !fileIndexSummary.FileInfo.Matches(fileInfo):
+		logger.Info().Str("index_path", indexPath).Msg("index file is stale, generating index")
+	case fileIndexSummary.Terminator != opts.Delimiter.Terminator():
+		logger.Info().Str("index_path", indexPath).Msg("index file has another line delimiter, generating index")
+	case !countsLastLine(fileIndexSummary, opts):
+		logger.Info().Str("index_path", indexPath).Msg("index file counts another last line, generating index")
+	case !fitsMaxIndexes(logger, fileIndexSummary, maxIndexes, opts.ReservedMemory):
+		logger.Info().Str("index_path", indexPath).Msg("index file does not match maximum number of indexes, " +
+			"generating index")
+	default:
+		logger.Info().Str("index_path", indexPath).Msg("index loaded from index file")
+		return fileIndexSummary, nil
+	}
+
+	fileIndexSummary, err = GenerateIndexFrom(logger, src, maxIndexes, opts)
+	if err != nil || fileIndexSummary == nil {
+		return fileIndexSummary, err
+	}
+	// Failing to persist the index is not fatal, as the generated index can still be used
+	if err := WriteIndexFile(indexPath, fileIndexSummary); err != nil {
+		logger.Warn().Err(err).Str("index_path", indexPath).Msg("failed to write index file")
+	} else {
+		logger.Info().Str("index_path", indexPath).Msg("index written to index file")
+	}
+	return fileIndexSummary, nil
+}
+
+// fitsMaxIndexes checks if the loaded index is the one that would be generated for the provided maxIndexes.
+// If maxIndexes is 0, the index only needs to fit in the memory currently available, besides the reserved memory.
+func fitsMaxIndexes(logger *zerolog.Logger, fileIndexSummary *FileIndexSummary, maxIndexes int,
+	reservedMemory int64,
+) bool {
+	if maxIndexes == 0 {
+		available, err := AvailableIndexes(logger, reservedMemory)
+		return err == nil && len(fileIndexSummary.Index) <= available
+	}
+	// The index offset is doubled as the lines are counted, so it is a power of two
+	return maxIndexes > 0 &&
+		fileIndexSummary.IndexOffset == compactedIndexOffsetFor(fileIndexSummary.NumberOfLines, maxIndexes)
+}
+
+// countsLastLine checks if the loaded index counts the unterminated last line of the file as the options do.
+// The last line of a compressed file is always counted, as the file is not written anymore.
+func countsLastLine(fileIndexSummary *FileIndexSummary, opts IndexOptions) bool {
+	return fileIndexSummary.Compression != CompressionNone ||
+		fileIndexSummary.TerminatedLinesOnly == opts.TerminatedLinesOnly
+}
+
+// readIndexFileHeader reads and validates the header of an index file with the given size.
+func readIndexFileHeader(r io.Reader, indexFileSize int64) (indexFileHeader, error) {
+	var header indexFileHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return header, errors.Wrap(err, "failed to read index file header")
+	}
+	if header.Magic != indexFileMagic {
+		return header, errors.New("invalid index file")
+	}
+	if header.Version != indexFileVersion {
+		return header, errors.Errorf("unsupported index file version %d", header.Version)
+	}
+	if header.IndexOffset <= 0 || header.NumberOfLines <= 0 || header.Entries <= 0 ||
+		header.Entries != int64(entriesFor(int(header.NumberOfLines), int(header.IndexOffset))) ||
+		header.AccessPoints < 0 || header.AccessPointsSize < header.AccessPoints*24 ||
+		int(header.Flags>>8&0xff) >= len(compressionCodes) || header.Flags>>16 > 1 ||
+		indexFileSize != indexFileHeaderSize+header.Entries*8+header.AccessPointsSize {
+		return header, errors.New("corrupted index file")
+	}
+	return header, nil
+}
+
+// terminator returns the line terminator the offsets were computed with.
+func (h indexFileHeader) terminator() byte {
+	return byte(h.Flags)
+}
+
+// compression returns the compression of the file the index was generated from.
+func (h indexFileHeader) compression() Compression {
+	return compressionCodes[h.Flags>>8&0xff]
+}
+
+// terminatedLinesOnly returns whether an unterminated last line was left out of the indexed lines.
+func (h indexFileHeader) terminatedLinesOnly() bool {
+	return h.Flags>>16&1 == 1
+}
+
+// decodeAccessPoints decodes the access points following the entries of an index file.
+// The windows are copied, so they do not reference the memory-mapped index file.
+func decodeAccessPoints(data []byte, count int64) ([]AccessPoint, error) {
+	if count == 0 {
+		return nil, nil
+	}
+	accessPoints := make([]AccessPoint, count)
+	for i := range accessPoints {
+		if len(data) < 24 {
+			return nil, errors.New("corrupted index file")
+		}
+		windowSize := int64(binary.LittleEndian.Uint64(data[16:24]))
+		paddedSize := (windowSize + 7) &^ 7
+		if windowSize < 0 || paddedSize > int64(len(data)-24) {
+			return nil, errors.New("corrupted index file")
+		}
+		accessPoints[i] = AccessPoint{
+			Offset: int64(binary.LittleEndian.Uint64(data[0:8])),
+			Bit:    int64(binary.LittleEndian.Uint64(data[8:16])),
+		}
+		if windowSize > 0 {
+			accessPoints[i].Window = bytes.Clone(data[24 : 24+windowSize])
+		}
+		data = data[24+paddedSize:]
+	}
+	return accessPoints, nil
+}
+
+// fileInfo returns the info of the file the index was generated from.
+func (h indexFileHeader) fileInfo() FileInfo {
+	return FileInfo{
+		Size:        h.FileSize,
+		ModTime:     time.Unix(0, h.ModTime),
+		Fingerprint: hex.EncodeToString(h.Fingerprint[:]),
+	}
+}
+
+// indexFileWriter streams index entries to a temporary index file,
+// which replaces the index file once the header is written.
+type indexFileWriter struct {
+	indexPath string
+	file      *os.File
+	writer    *bufio.Writer
+	checksum  hash.Hash32
+	entries   int64
+	buffer    [8]byte
+
+	// accessPoints and accessPointsSize describe the access points written after the entries
+	accessPoints     int64
+	accessPointsSize int64
+}
+
+// createIndexFileWriter creates a temporary index file next to the index file, reserving space for the header.
+func createIndexFileWriter(indexPath string) (*indexFileWriter, error) {
+	file, err := os.CreateTemp(filepath.Dir(indexPath), filepath.Base(indexPath)+".tmp")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create index file")
+	}
+	w := &indexFileWriter{
+		indexPath: indexPath,
+		file:      file,
+		writer:    bufio.NewWriterSize(file, 1024*1024),
+		checksum:  crc32.NewIEEE(),
+	}
+	if _, err := w.writer.Write(make([]byte, indexFileHeaderSize)); err != nil {
+		w.abort()
+		return nil, errors.Wrap(err, "failed to write index file header")
+	}
+	return w, nil
+}
+
+// append writes the offset of the next indexed line.
+func (w *indexFileWriter) append(offset int64) error {
+	binary.LittleEndian.PutUint64(w.buffer[:], uint64(offset))
+	if _, err := w.writer.Write(w.buffer[:]); err != nil {
+		return errors.Wrap(err, "failed to write index file entries")
+	}
+	w.checksum.Write(w.buffer[:])
+	w.entries++
+	return nil
+}
+
+// appendAccessPoints writes the access points of a compressed file, once every entry is written.
+func (w *indexFileWriter) appendAccessPoints(accessPoints []AccessPoint) error {
+	var padding [8]byte
+	for _, accessPoint := range accessPoints {
+		paddedSize := (len(accessPoint.Window) + 7) &^ 7
+		for _, value := range []int64{accessPoint.Offset, accessPoint.Bit, int64(len(accessPoint.Window))} {
+			binary.LittleEndian.PutUint64(w.buffer[:], uint64(value))
+			if _, err := w.writer.Write(w.buffer[:]); err != nil {
+				return errors.Wrap(err, "failed to write index file access points")
+			}
+			w.checksum.Write(w.buffer[:])
+		}
+		for _, data := range [][]byte{accessPoint.Window, padding[:paddedSize-len(accessPoint.Window)]} {
+			if _, err := w.writer.Write(data); err != nil {
+				return errors.Wrap(err, "failed to write index file access points")
+			}
+			w.checksum.Write(data)
+		}
+		w.accessPoints++
+		w.accessPointsSize += 24 + int64(paddedSize)
+	}
+	return nil
+}
+
+// commit writes the header of the index file and renames it to the index path.
+func (w *indexFileWriter) commit(fileInfo FileInfo, terminator byte, compression Compression,
+	terminatedLinesOnly bool, indexOffset int, numberOfLines int,
+) error {
+	fingerprint, err := hex.DecodeString(fileInfo.Fingerprint)
+	if err != nil || len(fingerprint) != sha256.Size {
+		return errors.New("invalid file fingerprint")
+	}
+	code := slices.Index(compressionCodes, compression)
+	if code < 0 {
+		return errors.Errorf("unsupported compression %q", compression)
+	}
+	flags := uint32(terminator) | uint32(code)<<8
+	if terminatedLinesOnly {
+		flags |= 1 << 16
+	}
+	header := indexFileHeader{
+		Magic:            indexFileMagic,
+		Version:          indexFileVersion,
+		Flags:            flags,
+		FileSize:         fileInfo.Size,
+		ModTime:          fileInfo.ModTime.UnixNano(),
+		IndexOffset:      int64(indexOffset),
+		NumberOfLines:    int64(numberOfLines),
+		Entries:          w.entries,
+		AccessPoints:     w.accessPoints,
+		AccessPointsSize: w.accessPointsSize,
+		Checksum:         w.checksum.Sum32(),
+	}
+	copy(header.Fingerprint[:], fingerprint)
+	if err := w.writer.Flush(); err != nil {
+		return errors.Wrap(err, "failed to write index file")
+	}
+	var headerBytes bytes.Buffer
+	if err := binary.Write(&headerBytes, binary.LittleEndian, header); err != nil {
+		return errors.Wrap(err, "failed to encode index file header")
+	}
+	if _, err := w.file.WriteAt(headerBytes.Bytes(), 0); err != nil {
+		return errors.Wrap(err, "failed to write index file header")
+	}
+	if err := w.file.Close(); err != nil {
+		return errors.Wrap(err, "failed to close index file")
+	}
+	if err := os.Rename(w.file.Name(), w.indexPath); err != nil {
+		return errors.Wrap(err, "failed to rename index file")
+	}
+	return nil
+}
+
+// abort removes the temporary index file if it was not committed.
+func (w *indexFileWriter) abort() {
+	_ = w.file.Close()
+	_ = os.Remove(w.file.Name())
+}
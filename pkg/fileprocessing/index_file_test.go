@@ -0,0 +1,205 @@
+//go:build unit
+
+package fileprocessing_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/utils"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexFile(t *testing.T) {
+	content := "line1\nline2\nline3\nline4\nline5\n"
+	file := utils.CreateTempFile(t, content)
+	logger := zerolog.New(nil)
+	fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), 2, fileprocessing.IndexOptions{})
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name          string
+		corrupt       func(indexPath string)
+		expectedError string
+	}{
+		{
+			name: "Valid index file",
+		},
+		{
+			name: "Missing index file",
+			corrupt: func(indexPath string) {
+				assert.Nil(t, os.Remove(indexPath))
+			},
+			expectedError: "failed to open index file",
+		},
+		{
+			name: "Invalid magic",
+			corrupt: func(indexPath string) {
+				writeAt(t, indexPath, 0, []byte("INVALID!"))
+			},
+			expectedError: "invalid index file",
+		},
+		{
+			name: "Unsupported version",
+			corrupt: func(indexPath string) {
+				writeAt(t, indexPath, 8, []byte{99, 0, 0, 0})
+			},
+			expectedError: "unsupported index file version 99",
+		},
+		{
+			name: "Truncated index file",
+			corrupt: func(indexPath string) {
+				assert.Nil(t, os.Truncate(indexPath, 116))
+			},
+			expectedError: "corrupted index file",
+		},
+		{
+			name: "Corrupted entries",
+			corrupt: func(indexPath string) {
+				writeAt(t, indexPath, 112, []byte{1})
+			},
+			expectedError: "index file checksum mismatch",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexPath := filepath.Join(t.TempDir(), "index.idx")
+			assert.Nil(t, fileprocessing.WriteIndexFile(indexPath, fileIndexSummary))
+			if tt.corrupt != nil {
+				tt.corrupt(indexPath)
+			}
+
+			result, err := fileprocessing.ReadIndexFile(indexPath)
+			if tt.expectedError != "" {
+				assert.Nil(t, result)
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, fileIndexSummary.Index, result.Index)
+			assert.Equal(t, fileIndexSummary.IndexOffset, result.IndexOffset)
+			assert.Equal(t, fileIndexSummary.NumberOfLines, result.NumberOfLines)
+			assert.True(t, fileIndexSummary.FileInfo.Matches(result.FileInfo))
+		})
+	}
+}
+
+func TestLoadOrGenerateIndex(t *testing.T) {
+	logger := zerolog.New(nil)
+
+	t.Run("Generates and persists the index", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\nline2\nline3\n")
+		indexPath := filepath.Join(t.TempDir(), "index.idx")
+
+		result, err := fileprocessing.LoadOrGenerateIndex(&logger, file.Name(), indexPath, 10, fileprocessing.IndexOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{0, 6, 12}, result.Index)
+		assert.True(t, utils.FileExists(indexPath))
+	})
+
+	t.Run("Loads a matching index file", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\nline2\nline3\n")
+		indexPath := filepath.Join(t.TempDir(), "index.idx")
+		fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), 10, fileprocessing.IndexOptions{})
+		assert.Nil(t, err)
+		// Persist a fake index with the file info of the file, so it is only returned if loaded from disk
+		fileIndexSummary.Index = []int64{1, 2, 3}
+		assert.Nil(t, fileprocessing.WriteIndexFile(indexPath, fileIndexSummary))
+
+		result, err := fileprocessing.LoadOrGenerateIndex(&logger, file.Name(), indexPath, 10, fileprocessing.IndexOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, fileIndexSummary.Index, result.Index)
+	})
+
+	t.Run("Rebuilds a stale index file", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\nline2\nline3\n")
+		indexPath := filepath.Join(t.TempDir(), "index.idx")
+		_, err := fileprocessing.LoadOrGenerateIndex(&logger, file.Name(), indexPath, 10, fileprocessing.IndexOptions{})
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(file.Name(), []byte("a\nb\n"), 0o600))
+		assert.Nil(t, os.Chtimes(file.Name(), time.Now(), time.Now().Add(time.Minute)))
+
+		result, err := fileprocessing.LoadOrGenerateIndex(&logger, file.Name(), indexPath, 10, fileprocessing.IndexOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{0, 2}, result.Index)
+		assert.Equal(t, 2, result.NumberOfLines)
+
+		persisted, err := fileprocessing.ReadIndexFile(indexPath)
+		assert.Nil(t, err)
+		assert.Equal(t, result.Index, persisted.Index)
+	})
+
+	t.Run("Rebuilds an index file generated with another maximum number of indexes", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\nline2\nline3\n")
+		indexPath := filepath.Join(t.TempDir(), "index.idx")
+		_, err := fileprocessing.LoadOrGenerateIndex(&logger, file.Name(), indexPath, 10, fileprocessing.IndexOptions{})
+		assert.Nil(t, err)
+
+		result, err := fileprocessing.LoadOrGenerateIndex(&logger, file.Name(), indexPath, 2, fileprocessing.IndexOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{0, 12}, result.Index)
+	})
+
+	t.Run("Rebuilds an index file generated with another line delimiter", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1|line2\nline3|")
+		indexPath := filepath.Join(t.TempDir(), "index.idx")
+		_, err := fileprocessing.LoadOrGenerateIndex(&logger, file.Name(), indexPath, 10, fileprocessing.IndexOptions{})
+		assert.Nil(t, err)
+
+		result, err := fileprocessing.LoadOrGenerateIndex(&logger, file.Name(), indexPath, 10,
+			fileprocessing.IndexOptions{Delimiter: "|"})
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{0, 6}, result.Index)
+
+		persisted, err := fileprocessing.ReadIndexFile(indexPath)
+		assert.Nil(t, err)
+		assert.Equal(t, byte('|'), persisted.Terminator)
+	})
+
+	t.Run("Rebuilds an index file counting the unterminated last line", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\nline2\nli")
+		indexPath := filepath.Join(t.TempDir(), "index.idx")
+		_, err := fileprocessing.LoadOrGenerateIndex(&logger, file.Name(), indexPath, 10, fileprocessing.IndexOptions{})
+		assert.Nil(t, err)
+
+		result, err := fileprocessing.LoadOrGenerateIndex(&logger, file.Name(), indexPath, 10,
+			fileprocessing.IndexOptions{TerminatedLinesOnly: true})
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{0, 6}, result.Index)
+
+		persisted, err := fileprocessing.ReadIndexFile(indexPath)
+		assert.Nil(t, err)
+		assert.True(t, persisted.TerminatedLinesOnly)
+		assert.Equal(t, 2, persisted.NumberOfLines)
+	})
+
+	t.Run("Rebuilds a corrupted index file", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\nline2\nline3\n")
+		indexPath := filepath.Join(t.TempDir(), "index.idx")
+		assert.Nil(t, os.WriteFile(indexPath, []byte("garbage"), 0o600))
+
+		result, err := fileprocessing.LoadOrGenerateIndex(&logger, file.Name(), indexPath, 10, fileprocessing.IndexOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{0, 6, 12}, result.Index)
+	})
+
+	t.Run("Empty index path", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\n")
+		_, err := fileprocessing.LoadOrGenerateIndex(&logger, file.Name(), "", 10, fileprocessing.IndexOptions{})
+		assert.EqualError(t, err, "index path cannot be empty")
+	})
+}
+
+// writeAt overwrites the bytes of a file at the given offset
+func writeAt(t *testing.T, filePath string, offset int64, data []byte) {
+	t.Helper()
+	file, err := os.OpenFile(filePath, os.O_WRONLY, 0)
+	assert.Nil(t, err)
+	_, err = file.WriteAt(data, offset)
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+}
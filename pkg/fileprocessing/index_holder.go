@@ -0,0 +1,119 @@
+package fileprocessing
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// IndexHolder publishes a file index summary to concurrent readers.
+// It allows the index to be generated in background while lines are served by scanning the file,
+// atomically switching to the index once it is stored.
+type IndexHolder struct {
+	summary atomic.Pointer[FileIndexSummary]
+	ready   atomic.Bool
+	err     atomic.Pointer[error]
+	// pendingSince is the time in nanoseconds the generation of the index started, and buildDuration the time it took
+	pendingSince  atomic.Int64
+	buildDuration atomic.Int64
+	// deferred is set if the index is not generated until it is started
+	deferred bool
+}
+
+// IndexSource provides the index holder of the current version of a file, which changes as the file is reloaded.
+type IndexSource interface {
+	Index() *IndexHolder
+}
+
+// IndexSet provides the index holders of the current versions of several files by name, such as the datasets
+// of a server, which change as files are added or removed.
+type IndexSet interface {
+	Indexes() map[string]*IndexHolder
+}
+
+// NewIndexHolder creates an index holder publishing a file index summary that is already available.
+// The summary may be nil if the file has no index.
+func NewIndexHolder(fileIndexSummary *FileIndexSummary) *IndexHolder {
+	h := &IndexHolder{}
+	h.Store(fileIndexSummary)
+	return h
+}
+
+// NewPendingIndexHolder creates an index holder whose file index summary is still being generated.
+func NewPendingIndexHolder() *IndexHolder {
+	h := &IndexHolder{}
+	h.Start()
+	return h
+}
+
+// NewDeferredIndexHolder creates an index holder whose file index summary is not generated until it is started,
+// such as the index of a file generated on its first access.
+func NewDeferredIndexHolder() *IndexHolder {
+	return &IndexHolder{deferred: true}
+}
+
+// Start marks the generation of the file index summary as started, from which its build duration is measured.
+func (h *IndexHolder) Start() {
+	h.pendingSince.Store(time.Now().UnixNano())
+}
+
+// Index returns the holder itself, so a holder is the index source of a file that is not reloaded.
+func (h *IndexHolder) Index() *IndexHolder {
+	return h
+}
+
+// Load returns the published file index summary, or nil if no index is available.
+func (h *IndexHolder) Load() *FileIndexSummary {
+	return h.summary.Load()
+}
+
+// Store publishes the file index summary and marks the holder as ready.
+func (h *IndexHolder) Store(fileIndexSummary *FileIndexSummary) {
+	if pendingSince := h.pendingSince.Load(); pendingSince != 0 {
+		h.buildDuration.Store(time.Now().UnixNano() - pendingSince)
+	}
+	h.summary.Store(fileIndexSummary)
+	h.ready.Store(true)
+}
+
+// Update publishes a new file index summary of the same version of the file, such as an extended index,
+// keeping the time it took to build the index.
+func (h *IndexHolder) Update(fileIndexSummary *FileIndexSummary) {
+	h.summary.Store(fileIndexSummary)
+}
+
+// Fail marks the holder as ready without a file index summary, as the generation of the index failed,
+// so lines are served by scanning the file.
+func (h *IndexHolder) Fail(err error) {
+	h.err.Store(&err)
+	h.Store(nil)
+}
+
+// Err returns the error the generation of the index failed with, or nil.
+func (h *IndexHolder) Err() error {
+	if err := h.err.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+// Ready reports whether the generation of the index has completed,
+// so lines are no longer served by scanning the file from the beginning.
+func (h *IndexHolder) Ready() bool {
+	return h.ready.Load()
+}
+
+// Deferred reports whether the index is generated on demand, such as on the first access of the file,
+// while lines are served by scanning the file.
+func (h *IndexHolder) Deferred() bool {
+	return h.deferred
+}
+
+// BuildDuration returns the time it took to load or generate the index once the holder is ready,
+// or the time elapsed since the generation started while it is pending.
+// It is 0 for a holder created with an index that was already available, or whose generation has not started.
+func (h *IndexHolder) BuildDuration() time.Duration {
+	if pendingSince := h.pendingSince.Load(); !h.Ready() && pendingSince != 0 {
+		return time.Duration(time.Now().UnixNano() - pendingSince)
+	}
+	return time.Duration(h.buildDuration.Load())
+}
@@ -0,0 +1,73 @@
+//go:build unit
+
+package fileprocessing_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexHolder(t *testing.T) {
+	fileIndexSummary := &fileprocessing.FileIndexSummary{
+		Index:         []int64{0, 6, 12},
+		IndexOffset:   1,
+		NumberOfLines: 3,
+	}
+
+	t.Run("Available index", func(t *testing.T) {
+		holder := fileprocessing.NewIndexHolder(fileIndexSummary)
+		assert.True(t, holder.Ready())
+		assert.Equal(t, fileIndexSummary, holder.Load())
+		assert.Equal(t, time.Duration(0), holder.BuildDuration())
+	})
+
+	t.Run("No index", func(t *testing.T) {
+		holder := fileprocessing.NewIndexHolder(nil)
+		assert.True(t, holder.Ready())
+		assert.Nil(t, holder.Load())
+	})
+
+	t.Run("Pending index", func(t *testing.T) {
+		holder := fileprocessing.NewPendingIndexHolder()
+		assert.False(t, holder.Ready())
+		assert.Nil(t, holder.Load())
+		time.Sleep(10 * time.Millisecond)
+		assert.GreaterOrEqual(t, holder.BuildDuration(), 10*time.Millisecond)
+
+		holder.Store(fileIndexSummary)
+		assert.True(t, holder.Ready())
+		assert.Equal(t, fileIndexSummary, holder.Load())
+		// The build duration stops once the index is stored
+		buildDuration := holder.BuildDuration()
+		assert.GreaterOrEqual(t, buildDuration, 10*time.Millisecond)
+		time.Sleep(time.Millisecond)
+		assert.Equal(t, buildDuration, holder.BuildDuration())
+	})
+
+	t.Run("Deferred index", func(t *testing.T) {
+		holder := fileprocessing.NewDeferredIndexHolder()
+		assert.False(t, holder.Ready())
+		time.Sleep(10 * time.Millisecond)
+		// The build duration is measured once the generation of the index starts
+		assert.Equal(t, time.Duration(0), holder.BuildDuration())
+
+		holder.Start()
+		holder.Store(fileIndexSummary)
+		assert.True(t, holder.Ready())
+		assert.Less(t, holder.BuildDuration(), 10*time.Millisecond)
+	})
+
+	t.Run("Failed index", func(t *testing.T) {
+		holder := fileprocessing.NewPendingIndexHolder()
+		assert.Nil(t, holder.Err())
+
+		holder.Fail(errors.New("failed to generate index"))
+		assert.True(t, holder.Ready())
+		assert.Nil(t, holder.Load())
+		assert.EqualError(t, holder.Err(), "failed to generate index")
+	})
+}
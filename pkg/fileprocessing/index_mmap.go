@@ -0,0 +1,237 @@
+package fileprocessing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/source"
+	"github.com/rs/zerolog"
+)
+
+// GenerateMappedIndex reads a file and generates a dense index with the byte offset of every line.
+// Unlike GenerateIndex, the index is not kept in the Go heap: the offsets are streamed to the index file,
+// which is then memory-mapped, so the kernel pages the offsets in and out as lines are requested.
+// This allows every line to be indexed even when the index does not fit in the available memory.
+// The byte ranges of the file are scanned concurrently and their offsets are written in range order.
+// Gzip and zstd compressed files are decompressed in a single pass instead, and their access points are written
+// after the offsets.
+// Lines are terminated by the delimiter of the options, and an unterminated last line is also indexed,
+// unless the options only count the terminated lines of an uncompressed file.
+func GenerateMappedIndex(logger *zerolog.Logger, filePath string, indexPath string, opts IndexOptions,
+) (*FileIndexSummary, error) {
+	if filePath == "" {
+		return nil, errors.New("file path cannot be empty")
+	}
+	return GenerateMappedIndexFrom(logger, source.NewLocal(filePath), indexPath, opts)
+}
+
+// GenerateMappedIndexFrom generates the dense index of the file of the line source into the index file,
+// like GenerateMappedIndex does for a local file.
+func GenerateMappedIndexFrom(logger *zerolog.Logger, src source.LineSource, indexPath string, opts IndexOptions,
+) (*FileIndexSummary, error) {
+	// Validate arguments
+	if logger == nil {
+		return nil, errors.New("logger cannot be nil")
+	}
+	if src == nil {
+		return nil, errors.New("source cannot be nil")
+	}
+	if indexPath == "" {
+		return nil, errors.New("index path cannot be empty")
+	}
+	fileInfo, err := ReadFileInfoFrom(src)
+	if err != nil {
+		return nil, err
+	}
+	file, err := src.Open()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open file")
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Error().Err(err).Msg("failed to close file")
+		}
+	}()
+	writer, err := createIndexFileWriter(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	defer writer.abort()
+
+	start := time.Now()
+	workers := opts.workers()
+	terminator := opts.Delimiter.Terminator()
+	compression, err := DetectCompression(file)
+	if err != nil {
+		return nil, err
+	}
+	var accessPoints []AccessPoint
+	terminatedLinesOnly := opts.TerminatedLinesOnly && compression == CompressionNone
+	if compression != CompressionNone {
+		workers = 1
+		accessPoints, err = writeDecompressedLineOffsets(file, compression, terminator, opts.accessPointSpacing(),
+			writer)
+	} else {
+		err = writeLineOffsets(file, fileInfo.Size, workers, terminator, terminatedLinesOnly, writer)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if writer.entries == 0 {
+		return nil, nil
+	}
+	if err := writer.appendAccessPoints(accessPoints); err != nil {
+		return nil, err
+	}
+	if err := writer.commit(fileInfo, terminator, compression, terminatedLinesOnly, 1, int(writer.entries)); err != nil {
+		return nil, err
+	}
+	logger.Info().
+		Str("index_path", indexPath).
+		Int("workers", workers).
+		Int64("length", writer.entries).
+		Dur("duration", time.Since(start)).
+		Msg("index written to index file")
+	return MapIndexFile(indexPath)
+}
+
+// writeLineOffsets scans the byte ranges of the file concurrently, streaming the offset of every line
+// to the index file in range order. An unterminated last line is left out if terminatedLinesOnly is set.
+func writeLineOffsets(file io.ReaderAt, size int64, workers int, terminator byte, terminatedLinesOnly bool,
+	writer *indexFileWriter,
+) error {
+	// Every line starts where the previous one ends, so the offset of a line is written once its terminator is found
+	ranges := splitRanges(size, workers)
+	var lineStart int64
+	scan := func(i int, buffer []byte) ([]int64, error) {
+		return collectLineEnds(file, ranges[i], terminator, buffer)
+	}
+	err := scanRanges(ranges, workers, scan, func(_ int, lineEnds []int64) error {
+		for _, lineEnd := range lineEnds {
+			if err := writer.append(lineStart); err != nil {
+				return err
+			}
+			lineStart = lineEnd
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// The last line is unterminated if it starts before the end of the file
+	if lineStart < size && !terminatedLinesOnly {
+		return writer.append(lineStart)
+	}
+	return nil
+}
+
+// MapIndexFile memory-maps an index file and returns a file index summary backed by the mapping.
+// The returned summary must be closed to release the mapping.
+// An error is returned if the index file is missing, has an unsupported version or is corrupted.
+func MapIndexFile(indexPath string) (*FileIndexSummary, error) {
+	if !nativeLittleEndian() {
+		return nil, errors.New("memory-mapped indexes are only supported on little-endian platforms")
+	}
+	file, err := os.Open(indexPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open index file")
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to stat index file")
+	}
+	if stat.Size() < indexFileHeaderSize {
+		return nil, errors.New("corrupted index file")
+	}
+	data, err := mmapFile(file, stat.Size())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to map index file")
+	}
+	header, err := readIndexFileHeader(bytes.NewReader(data[:indexFileHeaderSize]), stat.Size())
+	if err == nil && crc32.ChecksumIEEE(data[indexFileHeaderSize:]) != header.Checksum {
+		err = errors.New("index file checksum mismatch")
+	}
+	var accessPoints []AccessPoint
+	if err == nil {
+		accessPoints, err = decodeAccessPoints(data[indexFileHeaderSize+header.Entries*8:], header.AccessPoints)
+	}
+	if err != nil {
+		_ = munmapFile(data)
+		return nil, err
+	}
+	return &FileIndexSummary{
+		IndexOffset:         int(header.IndexOffset),
+		NumberOfLines:       int(header.NumberOfLines),
+		Terminator:          header.terminator(),
+		FileInfo:            header.fileInfo(),
+		Mode:                IndexModeMmap,
+		Compression:         header.compression(),
+		AccessPoints:        accessPoints,
+		TerminatedLinesOnly: header.terminatedLinesOnly(),
+		// The entries are 8-byte aligned little-endian offsets, so they can be used in place
+		Index:   unsafe.Slice((*int64)(unsafe.Pointer(&data[indexFileHeaderSize])), header.Entries),
+		mapping: data,
+	}, nil
+}
+
+// LoadOrGenerateMappedIndex memory-maps the dense index persisted in the index file if it still matches the file.
+// Otherwise, the dense index is generated from the file into the index file and memory-mapped.
+func LoadOrGenerateMappedIndex(logger *zerolog.Logger, filePath string, indexPath string, opts IndexOptions,
+) (*FileIndexSummary, error) {
+	return LoadOrGenerateMappedIndexFrom(logger, source.NewLocal(filePath), indexPath, opts)
+}
+
+// LoadOrGenerateMappedIndexFrom memory-maps the dense index persisted in the index file if it still matches
+// the file of the line source, like LoadOrGenerateMappedIndex does for a local file.
+func LoadOrGenerateMappedIndexFrom(logger *zerolog.Logger, src source.LineSource, indexPath string,
+	opts IndexOptions,
+) (*FileIndexSummary, error) {
+	if logger == nil {
+		return nil, errors.New("logger cannot be nil")
+	}
+	if indexPath == "" {
+		return nil, errors.New("index path cannot be empty")
+	}
+	fileInfo, err := ReadFileInfoFrom(src)
+	if err != nil {
+		return nil, err
+	}
+	fileIndexSummary, err := MapIndexFile(indexPath)
+	switch {
+	case err != nil:
+		logger.Info().Err(err).Str("index_path", indexPath).Msg("index file cannot be mapped, generating index")
+	case !fileIndexSummary.FileInfo.Matches(fileInfo):
+		logger.Info().Str("index_path", indexPath).Msg("index file is stale, generating index")
+	case fileIndexSummary.Terminator != opts.Delimiter.Terminator():
+		logger.Info().Str("index_path", indexPath).Msg("index file has another line delimiter, generating index")
+	case !countsLastLine(fileIndexSummary, opts):
+		logger.Info().Str("index_path", indexPath).Msg("index file counts another last line, generating index")
+	case fileIndexSummary.IndexOffset != 1:
+		logger.Info().Str("index_path", indexPath).Msg("index file is not dense, generating index")
+	default:
+		logger.Info().Str("index_path", indexPath).Msg("index mapped from index file")
+		return fileIndexSummary, nil
+	}
+	if fileIndexSummary != nil {
+		if err := fileIndexSummary.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return GenerateMappedIndexFrom(logger, src, indexPath, opts)
+}
+
+// nativeLittleEndian checks if the platform stores integers in little-endian byte order.
+func nativeLittleEndian() bool {
+	var buffer [2]byte
+	binary.NativeEndian.PutUint16(buffer[:], 1)
+	return buffer[0] == 1
+}
@@ -0,0 +1,153 @@
+//go:build unit
+
+package fileprocessing_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/utils"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateMappedIndex(t *testing.T) {
+	longLine := strings.Repeat("a", 100*1024)
+	tests := []struct {
+		name                string
+		content             string
+		terminatedLinesOnly bool
+		expectedOffsets     []int64
+		expectedError       string
+	}{
+		{
+			name:            "Empty file",
+			content:         "",
+			expectedOffsets: nil,
+		},
+		{
+			name:            "Multiple lines",
+			content:         "line1\nline2\nline3\n",
+			expectedOffsets: []int64{0, 6, 12},
+		},
+		{
+			name:            "Lines longer than the read buffer",
+			content:         "line1\n" + longLine + "\nline3\n",
+			expectedOffsets: []int64{0, 6, int64(len(longLine)) + 7},
+		},
+		{
+			name:            "Unterminated last line",
+			content:         "line1\nline2",
+			expectedOffsets: []int64{0, 6},
+		},
+		{
+			name:                "Unterminated last line left out",
+			content:             "line1\nline2",
+			terminatedLinesOnly: true,
+			expectedOffsets:     []int64{0},
+		},
+	}
+	logger := zerolog.New(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := utils.CreateTempFile(t, tt.content)
+			indexPath := filepath.Join(t.TempDir(), "index.idx")
+
+			result, err := fileprocessing.GenerateMappedIndex(&logger, file.Name(), indexPath,
+				fileprocessing.IndexOptions{TerminatedLinesOnly: tt.terminatedLinesOnly})
+			assert.Nil(t, err)
+			if tt.expectedOffsets == nil {
+				assert.Nil(t, result)
+				return
+			}
+			defer func() {
+				assert.Nil(t, result.Close())
+			}()
+			assert.Equal(t, fileprocessing.IndexModeMmap, result.Mode)
+			assert.Equal(t, tt.expectedOffsets, result.Index)
+			assert.Equal(t, 1, result.IndexOffset)
+			assert.Equal(t, len(tt.expectedOffsets), result.NumberOfLines)
+			assert.Equal(t, tt.terminatedLinesOnly, result.TerminatedLinesOnly)
+			for line, expectedOffset := range tt.expectedOffsets {
+				checkpoint, offset, ok := result.Checkpoint(line)
+				assert.True(t, ok)
+				assert.Equal(t, line, checkpoint)
+				assert.Equal(t, expectedOffset, offset)
+			}
+			_, _, ok := result.Checkpoint(len(tt.expectedOffsets))
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestLoadOrGenerateMappedIndex(t *testing.T) {
+	logger := zerolog.New(nil)
+
+	t.Run("Maps a matching index file", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\nline2\nline3\n")
+		indexPath := filepath.Join(t.TempDir(), "index.idx")
+		fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), 10, fileprocessing.IndexOptions{})
+		assert.Nil(t, err)
+		assert.Nil(t, fileprocessing.WriteIndexFile(indexPath, fileIndexSummary))
+
+		result, err := fileprocessing.LoadOrGenerateMappedIndex(&logger, file.Name(), indexPath,
+			fileprocessing.IndexOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{0, 6, 12}, result.Index)
+		assert.Nil(t, result.Close())
+		assert.Nil(t, result.Index)
+	})
+
+	t.Run("Regenerates a sparse index file", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\nline2\nline3\n")
+		indexPath := filepath.Join(t.TempDir(), "index.idx")
+		fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), 2, fileprocessing.IndexOptions{})
+		assert.Nil(t, err)
+		assert.Nil(t, fileprocessing.WriteIndexFile(indexPath, fileIndexSummary))
+
+		result, err := fileprocessing.LoadOrGenerateMappedIndex(&logger, file.Name(), indexPath,
+			fileprocessing.IndexOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{0, 6, 12}, result.Index)
+		assert.Nil(t, result.Close())
+	})
+
+	t.Run("Regenerates a stale index file", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\nline2\nline3\n")
+		indexPath := filepath.Join(t.TempDir(), "index.idx")
+		result, err := fileprocessing.LoadOrGenerateMappedIndex(&logger, file.Name(), indexPath,
+			fileprocessing.IndexOptions{})
+		assert.Nil(t, err)
+		assert.Nil(t, result.Close())
+		assert.Nil(t, os.WriteFile(file.Name(), []byte("a\nb\n"), 0o600))
+		assert.Nil(t, os.Chtimes(file.Name(), time.Now(), time.Now().Add(time.Minute)))
+
+		result, err = fileprocessing.LoadOrGenerateMappedIndex(&logger, file.Name(), indexPath,
+			fileprocessing.IndexOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{0, 2}, result.Index)
+		assert.Nil(t, result.Close())
+	})
+
+	t.Run("Regenerates a corrupted index file", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\nline2\nline3\n")
+		indexPath := filepath.Join(t.TempDir(), "index.idx")
+		result, err := fileprocessing.LoadOrGenerateMappedIndex(&logger, file.Name(), indexPath,
+			fileprocessing.IndexOptions{})
+		assert.Nil(t, err)
+		assert.Nil(t, result.Close())
+		writeAt(t, indexPath, 116, []byte{1})
+
+		_, err = fileprocessing.MapIndexFile(indexPath)
+		assert.EqualError(t, err, "index file checksum mismatch")
+		result, err = fileprocessing.LoadOrGenerateMappedIndex(&logger, file.Name(), indexPath,
+			fileprocessing.IndexOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{0, 6, 12}, result.Index)
+		assert.Nil(t, result.Close())
+	})
+}
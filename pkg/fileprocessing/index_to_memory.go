@@ -1,126 +1,323 @@
 package fileprocessing
 
 import (
-	"bufio"
 	"fmt"
+	"io"
 	"math"
-	"os"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/source"
 	"github.com/rs/zerolog"
 	"github.com/shirou/gopsutil/v4/mem"
 )
 
-// FileIndexSummary holds the index map and metadata about the indexed file.
+// IndexMode defines where the index of a file is stored.
+type IndexMode string
+
+const (
+	// IndexModeMemory keeps a sparse index in memory, limited by the memory available.
+	IndexModeMemory IndexMode = "memory"
+	// IndexModeMmap keeps a dense index of every line in a memory-mapped index file.
+	IndexModeMmap IndexMode = "mmap"
+)
+
+// FileIndexSummary holds the index and metadata about the indexed file.
+// The index is a sorted array with the byte offset of every IndexOffset-th line,
+// so Index[i] is the offset of line i*IndexOffset. According to the Mode,
+// the array is either allocated in memory or backed by a memory-mapped index file.
+// Terminator is the byte terminating the indexed lines, as the offsets are only valid for that line delimiter.
+// For a compressed file, the offsets are offsets of its decompressed content, which is decompressed
+// from the closest of its AccessPoints before the offset, and FileInfo describes the compressed file.
+// TerminatedLinesOnly reports whether an unterminated last line was left out of the indexed lines.
 type FileIndexSummary struct {
-	Index         map[int]int64
-	IndexOffset   int
-	NumberOfLines int
+	Index               []int64
+	IndexOffset         int
+	NumberOfLines       int
+	Terminator          byte
+	FileInfo            FileInfo
+	Mode                IndexMode
+	Compression         Compression
+	AccessPoints        []AccessPoint
+	TerminatedLinesOnly bool
+
+	// mapping holds the memory-mapped index file backing Index
+	mapping []byte
+}
+
+// Checkpoint returns the closest indexed line at or before the given line and its byte offset.
+// The checkpoint is computed arithmetically from the index offset, without scanning the index.
+func (s *FileIndexSummary) Checkpoint(line int) (int, int64, bool) {
+	if line < 0 || line >= s.NumberOfLines || s.IndexOffset <= 0 {
+		return 0, 0, false
+	}
+	checkpoint := line / s.IndexOffset
+	if checkpoint >= len(s.Index) {
+		return 0, 0, false
+	}
+	return checkpoint * s.IndexOffset, s.Index[checkpoint], true
+}
+
+// Close releases the memory-mapped index file, if any.
+func (s *FileIndexSummary) Close() error {
+	if s.mapping == nil {
+		return nil
+	}
+	s.Index = nil
+	err := munmapFile(s.mapping)
+	s.mapping = nil
+	if err != nil {
+		return errors.Wrap(err, "failed to unmap index file")
+	}
+	return nil
 }
 
 // memoryLimitFactor defines the fraction of total system memory allowed for index usage.
 const memoryLimitFactor = 0.7
 
-// Estimate the memory usage per index entry (approximate).
-const bytesPerIndexEntry = 16 // 8 bytes for int key + 8 bytes for int64 value (map overhead excluded)
+// Memory usage per index entry.
+// The index is a contiguous array allocated with its exact length, so each entry only costs its int64 offset.
+const bytesPerIndexEntry = 8
 
 // GenerateIndex reads a file and generates an index of line numbers
 // and their corresponding byte offsets.
 // The index is kept in memory and is used to quickly access lines in the file.
 // The function takes the file path as argument and maxIndexes to limit the number of indexes.
 // If maxIndexes is 0, it calculates the number of indexes that can be generated based on the available memory.
-func GenerateIndex(logger *zerolog.Logger, filePath string, maxIndexes int) (*FileIndexSummary, error) {
+// The file is split into byte ranges that are scanned concurrently by a pool of workers,
+// whose line terminators are stitched together in range order to number the lines.
+// Lines are terminated by the delimiter of the options, and an unterminated last line is also counted,
+// unless the options only count the terminated lines of an uncompressed file.
+// Gzip and zstd compressed files, detected from their magic bytes, are decompressed in a single pass instead,
+// recording the access points from which their lines are decompressed.
+func GenerateIndex(logger *zerolog.Logger, filePath string, maxIndexes int, opts IndexOptions,
+) (*FileIndexSummary, error) {
+	if filePath == "" {
+		return nil, errors.New("file path cannot be empty")
+	}
+	return GenerateIndexFrom(logger, source.NewLocal(filePath), maxIndexes, opts)
+}
+
+// GenerateIndexFrom generates the index of the file of the line source, like GenerateIndex does for a local file.
+func GenerateIndexFrom(logger *zerolog.Logger, src source.LineSource, maxIndexes int, opts IndexOptions,
+) (*FileIndexSummary, error) {
 	// Validate arguments
 	if logger == nil {
 		return nil, errors.New("logger cannot be nil")
 	}
-	if filePath == "" {
-		return nil, errors.New("file path cannot be empty")
+	if src == nil {
+		return nil, errors.New("source cannot be nil")
 	}
 	// Open the file
-	file, err := os.Open(filePath)
+	file, err := src.Open()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open file")
+	}
 	// Close the file when done
 	defer func() {
 		if err := file.Close(); err != nil {
 			logger.Error().Err(err).Msg("failed to close file")
 		}
 	}()
+	// Identify the version of the file being indexed
+	stat, err := file.Stat()
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to open file")
-	}
-	// Count the number of lines in the file
-	linesCount, err := countLines(file)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to count lines")
+		return nil, errors.Wrap(err, "failed to stat file")
 	}
-	if linesCount == 0 {
+	if stat.Size == 0 {
 		return nil, nil
 	}
-	// Seek to the beginning of the file
-	_, err = file.Seek(0, 0)
+	fingerprint, err := Fingerprint(file, stat.Size)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to seek to beginning of file")
+		return nil, err
 	}
+	terminator := opts.Delimiter.Terminator()
 
 	// If maxIndexes is not provided, calculate the maximum number of indexes
 	if maxIndexes == 0 {
-		// Determine available memory for index creation
-		vmStat, err := mem.VirtualMemory()
+		maxIndexes, err = AvailableIndexes(logger, opts.ReservedMemory)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to get system info")
+			return nil, err
 		}
-
-		// Calculate the maximum number of indexes based on available memory
-		availableMemory := float64(vmStat.Available) * memoryLimitFactor
-		maxIndexes = int(availableMemory / bytesPerIndexEntry)
-
-		logger.Info().
-			Str("memory limit factor", fmt.Sprintf("%.2f", memoryLimitFactor)).
-			Str("available memory", fmt.Sprintf("%.2f (GB)", float64(vmStat.Available)/1e9)).
-			Str("available memory for index generation", fmt.Sprintf("%.2f (GB)", availableMemory/1e9)).
-			Int("maximum number of indexes", maxIndexes).
-			Msg("Memory and index statistics")
 	}
 	if maxIndexes <= 0 {
 		return nil, errors.New("insufficient memory available for indexing")
 	}
-	// Calculate the index offset
-	indexOffset := int(math.Ceil(float64(linesCount) / float64(maxIndexes)))
 
-	fileIndexSummary := &FileIndexSummary{
+	fileInfo := FileInfo{
+		Size:        stat.Size,
+		ModTime:     stat.ModTime,
+		Fingerprint: fingerprint,
+	}
+	compression, err := DetectCompression(file)
+	if err != nil {
+		return nil, err
+	}
+	if compression != CompressionNone {
+		return generateCompressedIndex(logger, file, compression, fileInfo, maxIndexes, opts)
+	}
+	unterminated, err := unterminatedLastLine(file, stat.Size, terminator)
+	if err != nil {
+		return nil, err
+	}
+	unterminated = unterminated && !opts.TerminatedLinesOnly
+
+	start := time.Now()
+	workers := opts.workers()
+	ranges := splitRanges(stat.Size, workers)
+	var index []int64
+	var linesCount int
+	indexOffset := 1
+	// Every line has at least one byte, so if the file size fits in maxIndexes, every line is indexed.
+	// Otherwise, the index offset is doubled as the lines are counted, so both are collected in a single pass.
+	if int64(maxIndexes) >= stat.Size {
+		index, err = indexAllLines(file, ranges, workers, terminator, unterminated)
+		linesCount = len(index)
+	} else {
+		index, indexOffset, linesCount, err = indexCheckpoints(file, ranges, workers, terminator, unterminated,
+			maxIndexes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if linesCount == 0 {
+		return nil, nil
+	}
+	logger.Info().
+		Int("workers", workers).
+		Int("ranges", len(ranges)).
+		Int("number_of_lines", linesCount).
+		Dur("duration", time.Since(start)).
+		Msg("file scanned")
+
+	return &FileIndexSummary{
+		Index:               index,
+		IndexOffset:         indexOffset,
+		NumberOfLines:       linesCount,
+		Terminator:          terminator,
+		Mode:                IndexModeMemory,
+		FileInfo:            fileInfo,
+		TerminatedLinesOnly: opts.TerminatedLinesOnly,
+	}, nil
+}
+
+// generateCompressedIndex generates the index of the decompressed content of a compressed file.
+func generateCompressedIndex(logger *zerolog.Logger, file io.ReaderAt, compression Compression, fileInfo FileInfo,
+	maxIndexes int, opts IndexOptions,
+) (*FileIndexSummary, error) {
+	start := time.Now()
+	terminator := opts.Delimiter.Terminator()
+	index, indexOffset, linesCount, accessPoints, size, err := indexCompressed(file, compression, terminator,
+		maxIndexes, opts.accessPointSpacing())
+	if err != nil || linesCount == 0 {
+		return nil, err
+	}
+	logger.Info().
+		Stringer("compression", compression).
+		Int64("decompressed_size", size).
+		Int("access_points", len(accessPoints)).
+		Int("number_of_lines", linesCount).
+		Dur("duration", time.Since(start)).
+		Msg("compressed file scanned")
+
+	return &FileIndexSummary{
+		Index:         index,
 		IndexOffset:   indexOffset,
 		NumberOfLines: linesCount,
+		Terminator:    terminator,
+		Mode:          IndexModeMemory,
+		FileInfo:      fileInfo,
+		Compression:   compression,
+		AccessPoints:  accessPoints,
+	}, nil
+}
+
+// indexAllLines scans the byte ranges concurrently, collecting the offset of every line in a single pass.
+// If the last line is unterminated, it starts after the last line terminator.
+func indexAllLines(r io.ReaderAt, ranges []fileRange, workers int, terminator byte, unterminated bool,
+) ([]int64, error) {
+	lineEnds := make([][]int64, len(ranges))
+	linesCount := 0
+	if unterminated {
+		linesCount++
 	}
-	indexMap := make(map[int]int64)
-	var offset int64 = 0
-	currentLine := 0
-	scanner := bufio.NewScanner(file)
-	// Read the file line by line and populate the index map
-	for scanner.Scan() {
-		if currentLine%indexOffset == 0 {
-			indexMap[currentLine] = offset
-		}
-		offset += int64(len(scanner.Bytes()) + 1) // +1 for '\n'
-		currentLine++
+	scan := func(i int, buffer []byte) ([]int64, error) {
+		return collectLineEnds(r, ranges[i], terminator, buffer)
+	}
+	err := scanRanges(ranges, workers, scan, func(i int, result []int64) error {
+		lineEnds[i] = result
+		linesCount += len(result)
+		return nil
+	})
+	if err != nil || linesCount == 0 {
+		return nil, err
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, errors.Wrap(err, "error reading file")
+	// Every line starts where the previous one ends, so the offsets are shifted by the first line
+	index := make([]int64, 0, linesCount)
+	index = append(index, 0)
+	for i := range lineEnds {
+		index = append(index, lineEnds[i][:min(len(lineEnds[i]), linesCount-len(index))]...)
+		lineEnds[i] = nil
 	}
-	fileIndexSummary.Index = indexMap
-	return fileIndexSummary, nil
+	return index, nil
 }
 
-// countLines counts the number of lines in a file.
-func countLines(file *os.File) (int, error) {
-	lineCount := 0
-	reader := bufio.NewReader(file)
-	for {
-		// Read chunks of data
-		_, err := reader.ReadBytes('\n')
-		if err != nil {
-			break
-		}
-		lineCount += 1 // Count each newline
+// indexCheckpoints scans the byte ranges concurrently in a single pass, collecting the line ends of each range,
+// which are stitched in range order into the offset of every IndexOffset-th line.
+// The index offset is the smallest power of two for which the index has at most maxIndexes entries.
+// It returns the index, the index offset and the number of lines.
+func indexCheckpoints(r io.ReaderAt, ranges []fileRange, workers int, terminator byte, unterminated bool,
+	maxIndexes int,
+) ([]int64, int, int, error) {
+	c := checkpoints{index: []int64{0}, indexOffset: 1, maxIndexes: maxIndexes}
+	scan := func(i int, buffer []byte) ([]uint32, error) {
+		return collectRelativeLineEnds(r, ranges[i], terminator, buffer)
+	}
+	err := scanRanges(ranges, workers, scan, func(i int, lineEnds []uint32) error {
+		c.add(ranges[i].start, lineEnds)
+		return nil
+	})
+	linesCount := c.lineEnds
+	if unterminated {
+		linesCount++
+	}
+	if err != nil || linesCount == 0 {
+		return nil, 0, 0, err
+	}
+	index, indexOffset := c.finish(linesCount)
+	return index, indexOffset, linesCount, nil
+}
+
+// AvailableIndexes calculates the maximum number of indexes that fit in the memory available for indexing,
+// once the reserved memory is deducted.
+func AvailableIndexes(logger *zerolog.Logger, reservedMemory int64) (int, error) {
+	// Determine available memory for index creation
+	vmStat, err := mem.VirtualMemory()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get system info")
 	}
-	return lineCount, nil
+
+	// Calculate the maximum number of indexes based on available memory
+	availableMemory := math.Max(float64(vmStat.Available)*memoryLimitFactor-float64(reservedMemory), 0)
+	maxIndexes := int(availableMemory / bytesPerIndexEntry)
+
+	logger.Info().
+		Str("memory limit factor", fmt.Sprintf("%.2f", memoryLimitFactor)).
+		Str("available memory", fmt.Sprintf("%.2f (GB)", float64(vmStat.Available)/1e9)).
+		Str("reserved memory", fmt.Sprintf("%.2f (GB)", float64(reservedMemory)/1e9)).
+		Str("available memory for index generation", fmt.Sprintf("%.2f (GB)", availableMemory/1e9)).
+		Int("maximum number of indexes", maxIndexes).
+		Msg("Memory and index statistics")
+	return maxIndexes, nil
+}
+
+// indexOffsetFor calculates the number of lines between consecutive indexes,
+// so the index of a file with linesCount lines has at most maxIndexes entries.
+func indexOffsetFor(linesCount int, maxIndexes int) int {
+	return int(math.Ceil(float64(linesCount) / float64(maxIndexes)))
+}
+
+// entriesFor calculates the number of entries in the index of a file with linesCount lines.
+func entriesFor(linesCount int, indexOffset int) int {
+	return (linesCount + indexOffset - 1) / indexOffset
 }
@@ -3,6 +3,9 @@
 package fileprocessing_test
 
 import (
+	"math"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/pkg/errors"
@@ -18,6 +21,8 @@ func TestGenerateIndex(t *testing.T) {
 		content                  string
 		logger                   *zerolog.Logger
 		maxIndexes               int
+		delimiter                fileprocessing.Delimiter
+		reservedMemory           int64
 		expectedFileIndexSummary *fileprocessing.FileIndexSummary
 		expectedError            error
 	}{
@@ -35,11 +40,11 @@ func TestGenerateIndex(t *testing.T) {
 			logger:     &zerolog.Logger{},
 			maxIndexes: 10,
 			expectedFileIndexSummary: &fileprocessing.FileIndexSummary{
-				Index: map[int]int64{
-					0: 0,
-				},
+				Index:         []int64{0},
 				IndexOffset:   1,
 				NumberOfLines: 1,
+				Terminator:    '\n',
+				Mode:          fileprocessing.IndexModeMemory,
 			},
 			expectedError: nil,
 		},
@@ -48,13 +53,11 @@ func TestGenerateIndex(t *testing.T) {
 			content: "line1\nline2\nline3\n",
 			logger:  &zerolog.Logger{},
 			expectedFileIndexSummary: &fileprocessing.FileIndexSummary{
-				Index: map[int]int64{
-					0: 0,
-					1: 6,
-					2: 12,
-				},
+				Index:         []int64{0, 6, 12},
 				IndexOffset:   1,
 				NumberOfLines: 3,
+				Terminator:    '\n',
+				Mode:          fileprocessing.IndexModeMemory,
 			},
 			expectedError: nil,
 		},
@@ -64,13 +67,11 @@ func TestGenerateIndex(t *testing.T) {
 			logger:     &zerolog.Logger{},
 			maxIndexes: 10,
 			expectedFileIndexSummary: &fileprocessing.FileIndexSummary{
-				Index: map[int]int64{
-					0: 0,
-					1: 6,
-					2: 12,
-				},
+				Index:         []int64{0, 6, 12},
 				IndexOffset:   1,
 				NumberOfLines: 3,
+				Terminator:    '\n',
+				Mode:          fileprocessing.IndexModeMemory,
 			},
 			expectedError: nil,
 		},
@@ -80,15 +81,109 @@ func TestGenerateIndex(t *testing.T) {
 			logger:     &zerolog.Logger{},
 			maxIndexes: 2,
 			expectedFileIndexSummary: &fileprocessing.FileIndexSummary{
-				Index: map[int]int64{
-					0: 0,
-					3: 18,
-				},
-				IndexOffset:   3,
+				Index:         []int64{0, 24},
+				IndexOffset:   4,
 				NumberOfLines: 5,
+				Terminator:    '\n',
+				Mode:          fileprocessing.IndexModeMemory,
 			},
 			expectedError: nil,
 		},
+		{
+			name:       "Unterminated last line",
+			content:    "line1\nline2\nline3",
+			logger:     &zerolog.Logger{},
+			maxIndexes: 10,
+			expectedFileIndexSummary: &fileprocessing.FileIndexSummary{
+				Index:         []int64{0, 6, 12},
+				IndexOffset:   1,
+				NumberOfLines: 3,
+				Terminator:    '\n',
+				Mode:          fileprocessing.IndexModeMemory,
+			},
+		},
+		{
+			name:       "Unterminated last line with maxIndexes < lines",
+			content:    "line1\nline2\nline3\nline4",
+			logger:     &zerolog.Logger{},
+			maxIndexes: 2,
+			expectedFileIndexSummary: &fileprocessing.FileIndexSummary{
+				Index:         []int64{0, 12},
+				IndexOffset:   2,
+				NumberOfLines: 4,
+				Terminator:    '\n',
+				Mode:          fileprocessing.IndexModeMemory,
+			},
+		},
+		{
+			name:       "Single unterminated line",
+			content:    "line1",
+			logger:     &zerolog.Logger{},
+			maxIndexes: 10,
+			expectedFileIndexSummary: &fileprocessing.FileIndexSummary{
+				Index:         []int64{0},
+				IndexOffset:   1,
+				NumberOfLines: 1,
+				Terminator:    '\n',
+				Mode:          fileprocessing.IndexModeMemory,
+			},
+		},
+		{
+			name:       "CRLF line endings",
+			content:    "line1\r\nline2\r\nline3\r\n",
+			logger:     &zerolog.Logger{},
+			maxIndexes: 10,
+			delimiter:  fileprocessing.DelimiterCRLF,
+			expectedFileIndexSummary: &fileprocessing.FileIndexSummary{
+				Index:         []int64{0, 7, 14},
+				IndexOffset:   1,
+				NumberOfLines: 3,
+				Terminator:    '\n',
+				Mode:          fileprocessing.IndexModeMemory,
+			},
+		},
+		{
+			name:       "Mixed line endings",
+			content:    "line1\r\nline2\nline3\r\n\r\nline5",
+			logger:     &zerolog.Logger{},
+			maxIndexes: 10,
+			delimiter:  fileprocessing.DelimiterCRLF,
+			expectedFileIndexSummary: &fileprocessing.FileIndexSummary{
+				Index:         []int64{0, 7, 13, 20, 22},
+				IndexOffset:   1,
+				NumberOfLines: 5,
+				Terminator:    '\n',
+				Mode:          fileprocessing.IndexModeMemory,
+			},
+		},
+		{
+			name:       "NUL terminated lines",
+			content:    "line1\x00line\n2\x00line3\x00",
+			logger:     &zerolog.Logger{},
+			maxIndexes: 10,
+			delimiter:  fileprocessing.DelimiterNUL,
+			expectedFileIndexSummary: &fileprocessing.FileIndexSummary{
+				Index:         []int64{0, 6, 13},
+				IndexOffset:   1,
+				NumberOfLines: 3,
+				Terminator:    0,
+				Mode:          fileprocessing.IndexModeMemory,
+			},
+		},
+		{
+			name:       "Custom delimiter",
+			content:    "line1|line2|line3",
+			logger:     &zerolog.Logger{},
+			maxIndexes: 10,
+			delimiter:  "|",
+			expectedFileIndexSummary: &fileprocessing.FileIndexSummary{
+				Index:         []int64{0, 6, 12},
+				IndexOffset:   1,
+				NumberOfLines: 3,
+				Terminator:    '|',
+				Mode:          fileprocessing.IndexModeMemory,
+			},
+		},
 		{
 			name:                     "Missing logger",
 			content:                  "line1\nline2\nline3\n",
@@ -113,6 +208,15 @@ func TestGenerateIndex(t *testing.T) {
 			expectedFileIndexSummary: nil,
 			expectedError:            errors.New("insufficient memory available for indexing"),
 		},
+		{
+			name:                     "Available memory is reserved",
+			content:                  "line1\nline2\nline3\n",
+			logger:                   &zerolog.Logger{},
+			maxIndexes:               0,
+			reservedMemory:           math.MaxInt64,
+			expectedFileIndexSummary: nil,
+			expectedError:            errors.New("insufficient memory available for indexing"),
+		},
 	}
 
 	for _, tt := range tests {
@@ -125,8 +229,14 @@ func TestGenerateIndex(t *testing.T) {
 				filePath = "nonexistent_file.txt"
 			}
 
-			result, err := fileprocessing.GenerateIndex(tt.logger, filePath, tt.maxIndexes)
+			result, err := fileprocessing.GenerateIndex(tt.logger, filePath, tt.maxIndexes,
+				fileprocessing.IndexOptions{Delimiter: tt.delimiter, ReservedMemory: tt.reservedMemory})
 
+			if tt.expectedFileIndexSummary != nil {
+				fileInfo, err := fileprocessing.ReadFileInfo(filePath)
+				assert.Nil(t, err)
+				tt.expectedFileIndexSummary.FileInfo = fileInfo
+			}
 			assert.Equal(t, tt.expectedFileIndexSummary, result)
 			if tt.expectedError != nil || err != nil {
 				assert.Equal(t, tt.expectedError.Error(), err.Error())
@@ -134,3 +244,86 @@ func TestGenerateIndex(t *testing.T) {
 		})
 	}
 }
+
+func TestFileIndexSummary_Checkpoint(t *testing.T) {
+	fileIndexSummary := &fileprocessing.FileIndexSummary{
+		Index:         []int64{0, 18, 36},
+		IndexOffset:   3,
+		NumberOfLines: 8,
+	}
+	tests := []struct {
+		name               string
+		line               int
+		expectedCheckpoint int
+		expectedOffset     int64
+		expectedOk         bool
+	}{
+		{name: "First line", line: 0, expectedCheckpoint: 0, expectedOffset: 0, expectedOk: true},
+		{name: "Indexed line", line: 3, expectedCheckpoint: 3, expectedOffset: 18, expectedOk: true},
+		{name: "Line between checkpoints", line: 5, expectedCheckpoint: 3, expectedOffset: 18, expectedOk: true},
+		{name: "Last line", line: 7, expectedCheckpoint: 6, expectedOffset: 36, expectedOk: true},
+		{name: "Negative line", line: -1},
+		{name: "Line beyond the end of the file", line: 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkpoint, offset, ok := fileIndexSummary.Checkpoint(tt.line)
+			assert.Equal(t, tt.expectedCheckpoint, checkpoint)
+			assert.Equal(t, tt.expectedOffset, offset)
+			assert.Equal(t, tt.expectedOk, ok)
+		})
+	}
+}
+
+func TestGenerateIndex_Workers(t *testing.T) {
+	// Generate a file spanning several byte ranges, with lines crossing the range boundaries
+	var content strings.Builder
+	var offsets []int64
+	for line := 0; content.Len() < 5*1024*1024; line++ {
+		offsets = append(offsets, int64(content.Len()))
+		content.WriteString(strings.Repeat("x", line%200) + "\n")
+	}
+	file := utils.CreateTempFile(t, content.String())
+	logger := zerolog.New(nil)
+	// The index offset is the smallest power of two for which the checkpoints fit
+	checkpointsOffset := 1
+	for (len(offsets)+checkpointsOffset-1)/checkpointsOffset > 1000 {
+		checkpointsOffset *= 2
+	}
+
+	tests := []struct {
+		name                string
+		workers             int
+		maxIndexes          int
+		expectedIndexOffset int
+	}{
+		{name: "Single worker indexing every line", workers: 1, maxIndexes: content.Len(), expectedIndexOffset: 1},
+		{name: "Multiple workers indexing every line", workers: 4, maxIndexes: content.Len(), expectedIndexOffset: 1},
+		{name: "Single worker indexing checkpoints", workers: 1, maxIndexes: 1000,
+			expectedIndexOffset: checkpointsOffset},
+		{name: "Multiple workers indexing checkpoints", workers: 4, maxIndexes: 1000,
+			expectedIndexOffset: checkpointsOffset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := fileprocessing.GenerateIndex(&logger, file.Name(), tt.maxIndexes,
+				fileprocessing.IndexOptions{Workers: tt.workers})
+			assert.Nil(t, err)
+			assert.Equal(t, len(offsets), result.NumberOfLines)
+			assert.Equal(t, tt.expectedIndexOffset, result.IndexOffset)
+			var expectedIndex []int64
+			for line := 0; line < len(offsets); line += tt.expectedIndexOffset {
+				expectedIndex = append(expectedIndex, offsets[line])
+			}
+			assert.Equal(t, expectedIndex, result.Index)
+		})
+	}
+
+	t.Run("Multiple workers generating a memory-mapped index", func(t *testing.T) {
+		result, err := fileprocessing.GenerateMappedIndex(&logger, file.Name(),
+			filepath.Join(t.TempDir(), "index.idx"), fileprocessing.IndexOptions{Workers: 4})
+		assert.Nil(t, err)
+		assert.Equal(t, offsets, result.Index)
+		assert.Nil(t, result.Close())
+	})
+}
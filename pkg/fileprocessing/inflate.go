@@ -0,0 +1,640 @@
+package fileprocessing
+
+import (
+	"bufio"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math/bits"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// windowSize is the maximum distance of the back-references of deflate, so decompression resumes at the beginning
+	// of a deflate block given the windowSize bytes decompressed before it.
+	windowSize = 32 * 1024
+	// maxCodeBits is the maximum length of the Huffman codes of deflate.
+	maxCodeBits = 15
+	// fastBits is the length of the codes decoded with a single table lookup, while longer codes are decoded bit by bit.
+	fastBits = 9
+	// inflateChunkSize is the number of bytes decompressed ahead of the reader.
+	inflateChunkSize = 64 * 1024
+	// maxMatchLength is the maximum length of a back-reference of deflate.
+	maxMatchLength = 258
+)
+
+// errCorruptDeflate is returned when the deflate stream of a gzip member is invalid.
+var errCorruptDeflate = errors.New("corrupted deflate stream")
+
+// inflateState is the next step of the decompression of a gzip file.
+type inflateState int
+
+const (
+	stateMemberHeader inflateState = iota
+	stateBlockHeader
+	stateStoredBlock
+	stateHuffmanBlock
+)
+
+// lengthBase and lengthExtra are the base length and the number of extra bits of the length symbols,
+// and distBase and distExtra the ones of the distance symbols.
+var (
+	lengthBase = [29]uint16{3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31, 35, 43, 51, 59, 67, 83, 99, 115,
+		131, 163, 195, 227, 258}
+	lengthExtra = [29]uint8{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0}
+	distBase    = [30]uint16{1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193, 257, 385, 513, 769, 1025, 1537,
+		2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577}
+	distExtra = [30]uint8{0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13}
+	// codeLengthOrder is the order of the code lengths of the code length alphabet of a dynamic block.
+	codeLengthOrder = [19]uint8{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+)
+
+// fixedLiterals and fixedDistances are the Huffman codes of the fixed Huffman blocks.
+var (
+	fixedLiterals, fixedDistances huffman
+	fixedOnce                     sync.Once
+)
+
+// huffman decodes the symbols of a canonical Huffman code.
+// The codes of at most fastBits bits are decoded with a single table lookup, and the longer ones bit by bit.
+type huffman struct {
+	// fast holds the symbol and the length of the codes of at most fastBits bits, indexed by their reversed bits,
+	// as the symbol shifted by 4 bits and the length in the lowest 4 bits. It is 0 for the longer codes.
+	fast [1 << fastBits]uint16
+	// counts holds the number of codes of each length, and symbols the symbols sorted by code
+	counts  [maxCodeBits + 1]uint16
+	symbols []uint16
+}
+
+// init builds the code from the code length of each symbol, where a length of 0 means the symbol is not used.
+// Incomplete codes are allowed, as deflate uses them for single distance codes.
+func (h *huffman) init(lengths []uint8) error {
+	clear(h.counts[:])
+	clear(h.fast[:])
+	for _, length := range lengths {
+		h.counts[length]++
+	}
+	h.counts[0] = 0
+	left := 1
+	for length := 1; length <= maxCodeBits; length++ {
+		left = left<<1 - int(h.counts[length])
+		if left < 0 {
+			return errCorruptDeflate
+		}
+	}
+	var offsets [maxCodeBits + 2]uint16
+	for length := 1; length <= maxCodeBits; length++ {
+		offsets[length+1] = offsets[length] + h.counts[length]
+	}
+	h.symbols = append(h.symbols[:0], make([]uint16, offsets[maxCodeBits+1])...)
+	for symbol, length := range lengths {
+		if length != 0 {
+			h.symbols[offsets[length]] = uint16(symbol)
+			offsets[length]++
+		}
+	}
+	// The codes are read from the least significant bit, so the table is indexed by their reversed bits
+	code, index := 0, 0
+	for length := 1; length <= fastBits; length++ {
+		for range h.counts[length] {
+			entry := h.symbols[index]<<4 | uint16(length)
+			for reversed := int(bits.Reverse16(uint16(code)) >> (16 - length)); reversed < len(h.fast); reversed += 1 << length {
+				h.fast[reversed] = entry
+			}
+			code++
+			index++
+		}
+		code <<= 1
+	}
+	return nil
+}
+
+// initFixedHuffman builds the Huffman codes of the fixed Huffman blocks.
+func initFixedHuffman() {
+	var lengths [288]uint8
+	for symbol := range lengths {
+		switch {
+		case symbol < 144:
+			lengths[symbol] = 8
+		case symbol < 256:
+			lengths[symbol] = 9
+		case symbol < 280:
+			lengths[symbol] = 7
+		default:
+			lengths[symbol] = 8
+		}
+	}
+	_ = fixedLiterals.init(lengths[:])
+	var distances [30]uint8
+	for symbol := range distances {
+		distances[symbol] = 5
+	}
+	_ = fixedDistances.init(distances[:])
+}
+
+// inflater decompresses the gzip members of a file from the beginning of the file or from an access point,
+// reporting the beginning of each deflate block, from which decompression can resume, to record access points.
+// The bits are read from the least significant bit of each byte, and the decompressed data is kept in a buffer
+// holding the 32 KiB window referenced by the back-references besides the data not read yet.
+type inflater struct {
+	reader *bufio.Reader
+	// offset is the offset of the compressed file of the next byte read, and bits holds the nbits bits read ahead
+	offset int64
+	bits   uint64
+	nbits  uint
+	// readErr is the error reading the compressed file, besides its end
+	readErr error
+
+	state inflateState
+	final bool
+	// stored is the number of bytes left in the stored block
+	stored             int
+	literals           *huffman
+	distances          *huffman
+	dynamicLiterals    huffman
+	dynamicDistances   huffman
+	codeLengthsHuffman huffman
+
+	// out holds the window followed by the decompressed data, read up to read,
+	// and total is the offset of the decompressed content at its end
+	out   []byte
+	read  int
+	total int64
+	// members is the number of gzip members whose header was read
+	members int
+	// memberStart is set at the first block of a member, which cannot reference the data decompressed before it
+	memberStart bool
+	// checksum holds the CRC-32 of the member decompressed from its header, up to checksummed in out,
+	// and memberSize its size. Members decompressed from an access point are not verified.
+	checksum    hash.Hash32
+	checksummed int
+	verify      bool
+	memberSize  uint32
+	err         error
+
+	// onBlock is called with the bit offset of the compressed file, the offset of the decompressed content and the
+	// window at the beginning of each deflate block, if set
+	onBlock func(bit int64, offset int64, window []byte) error
+}
+
+// newInflater creates an inflater of the compressed file from its beginning, or from the access point if not nil.
+func newInflater(file io.ReaderAt, accessPoint *AccessPoint) (*inflater, error) {
+	fixedOnce.Do(initFixedHuffman)
+	f := &inflater{
+		out:      make([]byte, 0, windowSize+inflateChunkSize+maxMatchLength),
+		checksum: crc32.NewIEEE(),
+		state:    stateMemberHeader,
+	}
+	var bit int64
+	if accessPoint != nil {
+		window, err := accessPoint.window()
+		if err != nil {
+			return nil, err
+		}
+		bit = accessPoint.Bit
+		f.out = append(f.out, window...)
+		f.read = len(f.out)
+		f.total = accessPoint.Offset
+		f.members = 1
+		f.state = stateBlockHeader
+	}
+	f.offset = bit / 8
+	f.reader = bufio.NewReaderSize(newSectionReaderFrom(file, f.offset), readBufferSize/16)
+	if skip := uint(bit % 8); skip > 0 {
+		if err := f.need(skip); err != nil {
+			return nil, err
+		}
+		f.take(skip)
+	}
+	return f, nil
+}
+
+// Read reads the decompressed content, decompressing the next chunk once the decompressed data is read.
+func (f *inflater) Read(p []byte) (int, error) {
+	for f.read == len(f.out) {
+		if f.err != nil {
+			return 0, f.err
+		}
+		// The data read is discarded, keeping the window referenced by the following back-references
+		f.updateChecksum()
+		if f.read > windowSize {
+			f.out = f.out[:copy(f.out, f.out[f.read-windowSize:])]
+			f.read = windowSize
+			f.checksummed = windowSize
+		}
+		f.err = f.inflate()
+	}
+	n := copy(p, f.out[f.read:])
+	f.read += n
+	return n, nil
+}
+
+// Close releases the inflater, which cannot be used anymore.
+func (f *inflater) Close() error {
+	f.reader = nil
+	f.out = nil
+	return nil
+}
+
+// inflate decompresses the next chunk of data, returning io.EOF once the last gzip member is decompressed.
+func (f *inflater) inflate() error {
+	for len(f.out)-f.read < inflateChunkSize {
+		var err error
+		switch f.state {
+		case stateMemberHeader:
+			err = f.readMemberHeader()
+		case stateBlockHeader:
+			err = f.readBlockHeader()
+		case stateStoredBlock:
+			err = f.copyStored()
+		case stateHuffmanBlock:
+			err = f.decodeHuffman()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readMemberHeader reads the header of the next gzip member. Once a member was read,
+// the end of the file or data that is not a gzip member ends the content, as gzip ignores trailing garbage.
+func (f *inflater) readMemberHeader() error {
+	f.align()
+	var header [10]byte
+	for i := range header {
+		if err := f.need(8); err != nil {
+			if f.members > 0 && i == 0 && err == io.ErrUnexpectedEOF {
+				return io.EOF
+			}
+			return err
+		}
+		header[i] = byte(f.take(8))
+		if i == 1 && (header[0] != gzipMagic&0xff || header[1] != gzipMagic>>8) {
+			if f.members > 0 {
+				return io.EOF
+			}
+			return errors.New("invalid gzip header")
+		}
+	}
+	if header[2] != 8 {
+		return errors.New("unsupported gzip compression method")
+	}
+	flags := header[3]
+	if flags&0x04 != 0 {
+		// The extra field is skipped
+		if err := f.need(16); err != nil {
+			return err
+		}
+		if err := f.skipBytes(int(f.take(16))); err != nil {
+			return err
+		}
+	}
+	for _, flag := range []byte{0x08, 0x10} {
+		if flags&flag == 0 {
+			continue
+		}
+		// The file name and the comment are zero-terminated
+		for {
+			if err := f.need(8); err != nil {
+				return err
+			}
+			if f.take(8) == 0 {
+				break
+			}
+		}
+	}
+	if flags&0x02 != 0 {
+		if err := f.skipBytes(2); err != nil {
+			return err
+		}
+	}
+	f.members++
+	f.memberStart = true
+	f.verify = true
+	f.checksum.Reset()
+	f.checksummed = len(f.out)
+	f.memberSize = 0
+	f.state = stateBlockHeader
+	return nil
+}
+
+// readBlockHeader reads the header of the next deflate block, and of its Huffman codes for a dynamic block.
+func (f *inflater) readBlockHeader() error {
+	if f.onBlock != nil {
+		var window []byte
+		if !f.memberStart {
+			window = f.out[max(len(f.out)-windowSize, 0):]
+		}
+		if err := f.onBlock(f.offset*8-int64(f.nbits), f.total, window); err != nil {
+			return err
+		}
+	}
+	f.memberStart = false
+	if err := f.need(3); err != nil {
+		return err
+	}
+	f.final = f.take(1) == 1
+	switch f.take(2) {
+	case 0:
+		f.align()
+		if err := f.need(32); err != nil {
+			return err
+		}
+		length, complement := f.take(16), f.take(16)
+		if length != ^complement&0xffff {
+			return errCorruptDeflate
+		}
+		f.stored = int(length)
+		f.state = stateStoredBlock
+	case 1:
+		f.literals, f.distances = &fixedLiterals, &fixedDistances
+		f.state = stateHuffmanBlock
+	case 2:
+		if err := f.readDynamicCodes(); err != nil {
+			return err
+		}
+		f.literals, f.distances = &f.dynamicLiterals, &f.dynamicDistances
+		f.state = stateHuffmanBlock
+	default:
+		return errCorruptDeflate
+	}
+	return nil
+}
+
+// readDynamicCodes reads the Huffman codes of a dynamic block, which are themselves Huffman coded.
+func (f *inflater) readDynamicCodes() error {
+	if err := f.need(14); err != nil {
+		return err
+	}
+	literalsCount := int(f.take(5)) + 257
+	distancesCount := int(f.take(5)) + 1
+	codeLengthsCount := int(f.take(4)) + 4
+	if literalsCount > 286 || distancesCount > 30 {
+		return errCorruptDeflate
+	}
+	var codeLengths [19]uint8
+	for i := range codeLengthsCount {
+		if err := f.need(3); err != nil {
+			return err
+		}
+		codeLengths[codeLengthOrder[i]] = uint8(f.take(3))
+	}
+	if err := f.codeLengthsHuffman.init(codeLengths[:]); err != nil {
+		return err
+	}
+	var lengths [286 + 30]uint8
+	for i := 0; i < literalsCount+distancesCount; {
+		symbol, err := f.decode(&f.codeLengthsHuffman)
+		if err != nil {
+			return err
+		}
+		if symbol < 16 {
+			lengths[i] = uint8(symbol)
+			i++
+			continue
+		}
+		var length uint8
+		var repeat uint32
+		switch symbol {
+		case 16:
+			if i == 0 {
+				return errCorruptDeflate
+			}
+			length = lengths[i-1]
+			if err := f.need(2); err != nil {
+				return err
+			}
+			repeat = 3 + f.take(2)
+		case 17:
+			if err := f.need(3); err != nil {
+				return err
+			}
+			repeat = 3 + f.take(3)
+		default:
+			if err := f.need(7); err != nil {
+				return err
+			}
+			repeat = 11 + f.take(7)
+		}
+		if i+int(repeat) > literalsCount+distancesCount {
+			return errCorruptDeflate
+		}
+		for range repeat {
+			lengths[i] = length
+			i++
+		}
+	}
+	// The end of block symbol is required
+	if lengths[256] == 0 {
+		return errCorruptDeflate
+	}
+	if err := f.dynamicLiterals.init(lengths[:literalsCount]); err != nil {
+		return err
+	}
+	return f.dynamicDistances.init(lengths[literalsCount : literalsCount+distancesCount])
+}
+
+// copyStored copies the bytes of the stored block, up to the chunk size.
+func (f *inflater) copyStored() error {
+	n := min(f.stored, inflateChunkSize-(len(f.out)-f.read))
+	start := len(f.out)
+	f.out = f.out[:start+n]
+	i := start
+	// The bytes read ahead are copied first, as the stored block is byte aligned
+	for ; i < len(f.out) && f.nbits >= 8; i++ {
+		f.out[i] = byte(f.take(8))
+	}
+	read, err := io.ReadFull(f.reader, f.out[i:])
+	f.offset += int64(read)
+	if err != nil {
+		f.out = f.out[:i+read]
+		return f.readError(err)
+	}
+	f.total += int64(n)
+	f.stored -= n
+	if f.stored == 0 {
+		return f.endBlock()
+	}
+	return nil
+}
+
+// decodeHuffman decodes the symbols of the Huffman block, up to the chunk size.
+func (f *inflater) decodeHuffman() error {
+	for len(f.out)-f.read < inflateChunkSize {
+		symbol, err := f.decode(f.literals)
+		if err != nil {
+			return err
+		}
+		switch {
+		case symbol < 256:
+			f.out = append(f.out, byte(symbol))
+			f.total++
+			continue
+		case symbol == 256:
+			return f.endBlock()
+		case symbol > 285:
+			return errCorruptDeflate
+		}
+		symbol -= 257
+		if err := f.need(uint(lengthExtra[symbol])); err != nil {
+			return err
+		}
+		length := int(lengthBase[symbol]) + int(f.take(uint(lengthExtra[symbol])))
+		symbol, err = f.decode(f.distances)
+		if err != nil {
+			return err
+		}
+		if symbol >= len(distBase) {
+			return errCorruptDeflate
+		}
+		if err := f.need(uint(distExtra[symbol])); err != nil {
+			return err
+		}
+		distance := int(distBase[symbol]) + int(f.take(uint(distExtra[symbol])))
+		if distance > len(f.out) {
+			return errCorruptDeflate
+		}
+		start := len(f.out) - distance
+		if distance >= length {
+			f.out = append(f.out, f.out[start:start+length]...)
+		} else {
+			// The back-reference overlaps the data it produces, so it is copied byte by byte
+			for i := range length {
+				f.out = append(f.out, f.out[start+i])
+			}
+		}
+		f.total += int64(length)
+	}
+	return nil
+}
+
+// endBlock ends the deflate block, and the gzip member after its last block, verifying its trailer.
+func (f *inflater) endBlock() error {
+	f.state = stateBlockHeader
+	if !f.final {
+		return nil
+	}
+	f.align()
+	if err := f.need(32); err != nil {
+		return err
+	}
+	checksum := f.take(32)
+	if err := f.need(32); err != nil {
+		return err
+	}
+	size := f.take(32)
+	if f.verify {
+		f.updateChecksum()
+		if checksum != f.checksum.Sum32() || size != f.memberSize {
+			return errors.New("gzip checksum mismatch")
+		}
+	}
+	f.state = stateMemberHeader
+	return nil
+}
+
+// updateChecksum updates the checksum of the member with the data decompressed since the last update.
+func (f *inflater) updateChecksum() {
+	if f.verify && f.checksummed < len(f.out) {
+		f.checksum.Write(f.out[f.checksummed:])
+		f.memberSize += uint32(len(f.out) - f.checksummed)
+	}
+	f.checksummed = len(f.out)
+}
+
+// decode decodes the next symbol of the Huffman code.
+func (f *inflater) decode(h *huffman) (int, error) {
+	if f.nbits < maxCodeBits {
+		f.fill()
+	}
+	if entry := h.fast[f.bits&(1<<fastBits-1)]; entry != 0 {
+		length := uint(entry & 0xf)
+		if length > f.nbits {
+			return 0, f.readError(io.ErrUnexpectedEOF)
+		}
+		f.take(length)
+		return int(entry >> 4), nil
+	}
+	// The canonical codes of each length follow the codes of the previous length
+	code, first, index := 0, 0, 0
+	for length := uint(1); length <= maxCodeBits; length++ {
+		if length > f.nbits {
+			return 0, f.readError(io.ErrUnexpectedEOF)
+		}
+		code |= int(f.bits>>(length-1)) & 1
+		count := int(h.counts[length])
+		if code-first < count {
+			f.take(length)
+			return int(h.symbols[index+code-first]), nil
+		}
+		index += count
+		first = (first + count) << 1
+		code <<= 1
+	}
+	return 0, errCorruptDeflate
+}
+
+// fill reads bytes ahead until at least 57 bits are available or the file ends.
+func (f *inflater) fill() {
+	for f.nbits <= 56 {
+		c, err := f.reader.ReadByte()
+		if err != nil {
+			if err != io.EOF {
+				f.readErr = err
+			}
+			return
+		}
+		f.bits |= uint64(c) << f.nbits
+		f.nbits += 8
+		f.offset++
+	}
+}
+
+// need makes at least n bits available, returning an error if the file ends before.
+func (f *inflater) need(n uint) error {
+	if f.nbits < n {
+		f.fill()
+		if f.nbits < n {
+			return f.readError(io.ErrUnexpectedEOF)
+		}
+	}
+	return nil
+}
+
+// take consumes n available bits.
+func (f *inflater) take(n uint) uint32 {
+	value := uint32(f.bits & (1<<n - 1))
+	f.bits >>= n
+	f.nbits -= n
+	return value
+}
+
+// align discards the bits up to the next byte boundary.
+func (f *inflater) align() {
+	f.take(f.nbits % 8)
+}
+
+// skipBytes discards n bytes.
+func (f *inflater) skipBytes(n int) error {
+	for range n {
+		if err := f.need(8); err != nil {
+			return err
+		}
+		f.take(8)
+	}
+	return nil
+}
+
+// readError returns the error reading the compressed file, or err if the file ended.
+func (f *inflater) readError(err error) error {
+	if f.readErr != nil {
+		return errors.Wrap(f.readErr, "error reading file")
+	}
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
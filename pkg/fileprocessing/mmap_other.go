@@ -0,0 +1,19 @@
+//go:build !unix
+
+package fileprocessing
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// mmapFile is not supported on this platform.
+func mmapFile(_ *os.File, _ int64) ([]byte, error) {
+	return nil, errors.New("memory mapping is not supported on this platform")
+}
+
+// munmapFile is not supported on this platform.
+func munmapFile(_ []byte) error {
+	return errors.New("memory mapping is not supported on this platform")
+}
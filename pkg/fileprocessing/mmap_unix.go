@@ -0,0 +1,18 @@
+//go:build unix
+
+package fileprocessing
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the first size bytes of a file in memory as read-only.
+func mmapFile(file *os.File, size int64) ([]byte, error) {
+	return syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmapFile releases a mapping created by mmapFile.
+func munmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,207 @@
+package fileprocessing
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// readBufferSize defines the size of the buffer used by each worker to read its byte range.
+	readBufferSize = 1024 * 1024
+	// minRangeSize and maxRangeSize bound the size of the byte ranges the file is split into.
+	// Ranges are small enough to balance the work between workers and to bound the memory used
+	// by the line offsets collected for a range, and large enough to keep the reads sequential.
+	minRangeSize = 1024 * 1024
+	maxRangeSize = 16 * 1024 * 1024
+)
+
+// IndexOptions configures how a file is scanned to generate its index.
+type IndexOptions struct {
+	// Workers defines the number of workers scanning the file concurrently.
+	// If 0, the number of CPUs is used.
+	Workers int
+	// Delimiter defines how the lines of the file are terminated.
+	// If empty, lines are terminated with `\n`. DelimiterAuto must be resolved with ResolveDelimiter beforehand.
+	Delimiter Delimiter
+	// ReservedMemory is the memory in bytes reserved for other uses, such as the caches of the served lines,
+	// deducted from the memory available for the index when its size is calculated from the available memory.
+	ReservedMemory int64
+	// AccessPointSpacing defines the number of decompressed bytes between the access points of a compressed file,
+	// from which its lines are decompressed. If 0, DefaultAccessPointSpacing is used.
+	AccessPointSpacing int64
+	// TerminatedLinesOnly leaves the unterminated last line of an uncompressed file out of the index, as the file
+	// may still be written, such as an append-only log, so a partially written line is not served
+	// until its terminator is appended.
+	TerminatedLinesOnly bool
+}
+
+// workers returns the number of workers scanning the file concurrently.
+func (o IndexOptions) workers() int {
+	if o.Workers <= 0 {
+		return runtime.NumCPU()
+	}
+	return o.Workers
+}
+
+// fileRange is a byte range of a file, from start (inclusive) to end (exclusive), scanned by a worker.
+type fileRange struct {
+	start int64
+	end   int64
+}
+
+// splitRanges splits a file into byte ranges, so each worker gets several ranges to scan.
+func splitRanges(size int64, workers int) []fileRange {
+	rangeSize := min(max((size+int64(workers)*4-1)/(int64(workers)*4), minRangeSize), maxRangeSize)
+	ranges := make([]fileRange, 0, (size+rangeSize-1)/rangeSize)
+	for start := int64(0); start < size; start += rangeSize {
+		ranges = append(ranges, fileRange{start: start, end: min(start+rangeSize, size)})
+	}
+	return ranges
+}
+
+// scanRanges scans the byte ranges of a file concurrently with a pool of workers,
+// calling scan with the index of the range and a read buffer owned by the worker.
+// The results of the ranges are consumed in range order, so they can be stitched together,
+// and the number of ranges scanned ahead of the consumer is bounded to limit memory usage.
+func scanRanges[T any](ranges []fileRange, workers int,
+	scan func(index int, buffer []byte) (T, error), consume func(index int, result T) error,
+) error {
+	type rangeResult struct {
+		value T
+		err   error
+	}
+	results := make([]chan rangeResult, len(ranges))
+	for i := range results {
+		results[i] = make(chan rangeResult, 1)
+	}
+	done := make(chan struct{})
+	defer close(done)
+
+	// Dispatch the ranges to the workers, waiting for the consumer when too many ranges are pending
+	jobs := make(chan int)
+	pending := make(chan struct{}, 2*workers)
+	go func() {
+		defer close(jobs)
+		for i := range ranges {
+			select {
+			case pending <- struct{}{}:
+			case <-done:
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+	for range workers {
+		go func() {
+			buffer := make([]byte, readBufferSize)
+			for i := range jobs {
+				value, err := scan(i, buffer)
+				results[i] <- rangeResult{value: value, err: err}
+			}
+		}()
+	}
+
+	for i := range ranges {
+		result := <-results[i]
+		if result.err != nil {
+			return result.err
+		}
+		if err := consume(i, result.value); err != nil {
+			return err
+		}
+		<-pending
+	}
+	return nil
+}
+
+// readRange reads a byte range in chunks, calling fn with each chunk and its offset in the file.
+func readRange(r io.ReaderAt, fr fileRange, buffer []byte, fn func(chunk []byte, offset int64)) error {
+	for offset := fr.start; offset < fr.end; {
+		n, err := r.ReadAt(buffer[:min(int64(len(buffer)), fr.end-offset)], offset)
+		if n > 0 {
+			fn(buffer[:n], offset)
+			offset += int64(n)
+		}
+		if err != nil && (err != io.EOF || offset < fr.end) {
+			return errors.Wrap(err, "error reading file")
+		}
+	}
+	return nil
+}
+
+// forEachLineEnd calls fn with the offset following every line terminator in a byte range,
+// which is where the next line starts.
+func forEachLineEnd(r io.ReaderAt, fr fileRange, terminator byte, buffer []byte, fn func(lineEnd int64)) error {
+	return readRange(r, fr, buffer, func(chunk []byte, offset int64) {
+		for i := 0; ; {
+			next := bytes.IndexByte(chunk[i:], terminator)
+			if next < 0 {
+				return
+			}
+			i += next + 1
+			fn(offset + int64(i))
+		}
+	})
+}
+
+// collectRelativeLineEnds collects the offset following every line terminator in a byte range,
+// relative to the start of the range, which halves the memory of the offsets as ranges are smaller than 4 GiB.
+func collectRelativeLineEnds(r io.ReaderAt, fr fileRange, terminator byte, buffer []byte) ([]uint32, error) {
+	var lineEnds []uint32
+	err := forEachLineEnd(r, fr, terminator, buffer, func(lineEnd int64) {
+		lineEnds = append(lineEnds, uint32(lineEnd-fr.start))
+	})
+	return lineEnds, err
+}
+
+// checkpoints stitches the line ends of the byte ranges, consumed in range order, into the offsets of every
+// IndexOffset-th line. The number of lines is unknown until every range is scanned, so the index offset is doubled
+// whenever the checkpoints exceed maxIndexes, and the file is scanned in a single pass.
+type checkpoints struct {
+	index       []int64
+	indexOffset int
+	maxIndexes  int
+	// lineEnds counts the line terminators consumed, which is the number of the line following the last one
+	lineEnds int
+}
+
+// add stitches the line ends of the byte range starting at the offset, relative to its start.
+func (c *checkpoints) add(start int64, lineEnds []uint32) {
+	first := c.lineEnds
+	c.lineEnds += len(lineEnds)
+	for line := (first/c.indexOffset + 1) * c.indexOffset; line <= c.lineEnds; {
+		c.index = append(c.index, start+int64(lineEnds[line-first-1]))
+		// The last checkpoint may start a line that does not exist, if the file ends with it
+		if len(c.index) > c.maxIndexes+1 {
+			c.index, c.indexOffset = compactIndex(c.index, c.indexOffset)
+		}
+		line = (line/c.indexOffset + 1) * c.indexOffset
+	}
+}
+
+// finish returns the index and the index offset of the file with linesCount lines, dropping the checkpoint
+// of a line that does not exist, and compacting the index until it fits maxIndexes.
+func (c *checkpoints) finish(linesCount int) ([]int64, int) {
+	index, indexOffset := c.index[:entriesFor(linesCount, c.indexOffset)], c.indexOffset
+	for len(index) > c.maxIndexes {
+		index, indexOffset = compactIndex(index, indexOffset)
+	}
+	return index, indexOffset
+}
+
+// collectLineEnds collects the offset following every line terminator in a byte range,
+// which is where the next line starts.
+func collectLineEnds(r io.ReaderAt, fr fileRange, terminator byte, buffer []byte) ([]int64, error) {
+	var lineEnds []int64
+	err := forEachLineEnd(r, fr, terminator, buffer, func(lineEnd int64) {
+		lineEnds = append(lineEnds, lineEnd)
+	})
+	return lineEnds, err
+}
@@ -0,0 +1,132 @@
+package health
+
+import (
+	"io"
+	"iter"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/rs/zerolog"
+)
+
+// Checker reports the liveness and the readiness of the server.
+// The server is ready once its file is readable, the indexes of its datasets are loaded, deliberately disabled,
+// deferred to the first access of their file or failed, and until it starts shutting down.
+// With a failed index, lines are still served by scanning the file, so the server is ready but degraded.
+type Checker struct {
+	logger       *zerolog.Logger
+	filePath     string
+	index        fileprocessing.IndexSource
+	datasets     fileprocessing.IndexSet
+	shuttingDown atomic.Bool
+}
+
+// NewChecker creates a checker of the server serving the lines of the file with the index of the current version
+// of the file, and the lines of the datasets of the set, if any. A holder created without an index,
+// such as when the index is disabled, is ready from the start.
+func NewChecker(logger *zerolog.Logger, filePath string, index fileprocessing.IndexSource,
+	datasets fileprocessing.IndexSet,
+) *Checker {
+	if index == nil || index.Index() == nil {
+		index = fileprocessing.NewIndexHolder(nil)
+	}
+	return &Checker{logger: logger, filePath: filePath, index: index, datasets: datasets}
+}
+
+// ShuttingDown marks the server as shutting down, so it is no longer ready
+// and the orchestrator stops routing requests while the connections are drained.
+func (c *Checker) ShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Ready checks if the server is ready to serve lines, returning the reason if it is not.
+func (c *Checker) Ready() error {
+	if c.shuttingDown.Load() {
+		return errors.New("server is shutting down")
+	}
+	index := c.index.Index()
+	if !index.Ready() {
+		return errors.New("index is pending")
+	}
+	for name, datasetIndex := range c.datasetIndexes(index) {
+		if !datasetIndex.Ready() && !datasetIndex.Deferred() {
+			return errors.Errorf("index of dataset %q is pending", name)
+		}
+	}
+	file, err := os.Open(c.filePath)
+	if err != nil {
+		return errors.Wrap(err, "failed to open file")
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	// Reading the first byte checks the file is readable, while an empty file is still served
+	if _, err := file.Read(make([]byte, 1)); err != nil && err != io.EOF {
+		return errors.Wrap(err, "failed to read file")
+	}
+	return nil
+}
+
+// Degraded checks if the ready server serves lines slower than expected, returning the reason if it does.
+func (c *Checker) Degraded() error {
+	index := c.index.Index()
+	if err := index.Err(); err != nil {
+		return errors.Wrap(err, "index is unavailable, lines are served by scanning the file")
+	}
+	for name, datasetIndex := range c.datasetIndexes(index) {
+		if err := datasetIndex.Err(); err != nil {
+			return errors.Wrapf(err, "index of dataset %q is unavailable, lines are served by scanning the file", name)
+		}
+	}
+	return nil
+}
+
+// datasetIndexes returns the indexes of the datasets sorted by name, besides the index of the file.
+func (c *Checker) datasetIndexes(index *fileprocessing.IndexHolder) iter.Seq2[string, *fileprocessing.IndexHolder] {
+	return func(yield func(string, *fileprocessing.IndexHolder) bool) {
+		if c.datasets == nil {
+			return
+		}
+		indexes := c.datasets.Indexes()
+		for _, name := range slices.Sorted(maps.Keys(indexes)) {
+			if indexes[name] != index && !yield(name, indexes[name]) {
+				return
+			}
+		}
+	}
+}
+
+// Register registers the /healthz liveness and the /readyz readiness endpoints on the router.
+// Both respond with an HTTP 200 status and `ok`, or with an HTTP 503 status and the reason the server is not ready.
+// A degraded server is still ready, so /readyz responds with an HTTP 200 status and the reason it is degraded.
+func (c *Checker) Register(router *http.ServeMux) {
+	router.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		// The process is alive as long as it responds
+		writeStatus(w, http.StatusOK, "ok")
+	})
+	router.HandleFunc("GET /readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if err := c.Ready(); err != nil {
+			c.logger.Debug().Err(err).Msg("server not ready")
+			writeStatus(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if err := c.Degraded(); err != nil {
+			writeStatus(w, http.StatusOK, "degraded: "+err.Error())
+			return
+		}
+		writeStatus(w, http.StatusOK, "ok")
+	})
+}
+
+// writeStatus writes the status and the text of a health endpoint response.
+func writeStatus(w http.ResponseWriter, status int, text string) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, text+"\n")
+}
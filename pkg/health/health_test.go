@@ -0,0 +1,107 @@
+//go:build unit
+
+package health_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/health"
+	"github.com/renanrv/line-server/pkg/utils"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// indexSet is a set of index holders by dataset name.
+type indexSet map[string]*fileprocessing.IndexHolder
+
+func (s indexSet) Indexes() map[string]*fileprocessing.IndexHolder {
+	return s
+}
+
+func TestChecker(t *testing.T) {
+	logger := zerolog.New(nil)
+	file := utils.CreateTempFile(t, "line1\nline2\n")
+	emptyFile := utils.CreateTempFile(t, "")
+	failedIndex := fileprocessing.NewPendingIndexHolder()
+	failedIndex.Fail(errors.New("failed to generate index"))
+
+	tests := []struct {
+		name              string
+		filePath          string
+		index             *fileprocessing.IndexHolder
+		datasets          indexSet
+		shuttingDown      bool
+		expectedReadiness int
+		expectedBody      string
+	}{
+		{name: "Index loaded", filePath: file.Name(),
+			index: fileprocessing.NewIndexHolder(&fileprocessing.FileIndexSummary{
+				Index: []int64{0}, IndexOffset: 1, NumberOfLines: 2}),
+			expectedReadiness: http.StatusOK, expectedBody: "ok\n"},
+		{name: "Index disabled", filePath: file.Name(), expectedReadiness: http.StatusOK, expectedBody: "ok\n"},
+		{name: "Empty file", filePath: emptyFile.Name(), expectedReadiness: http.StatusOK, expectedBody: "ok\n"},
+		{name: "Index pending", filePath: file.Name(), index: fileprocessing.NewPendingIndexHolder(),
+			expectedReadiness: http.StatusServiceUnavailable, expectedBody: "index is pending\n"},
+		{name: "Index failed", filePath: file.Name(), index: failedIndex,
+			expectedReadiness: http.StatusOK,
+			expectedBody: "degraded: index is unavailable, lines are served by scanning the file: " +
+				"failed to generate index\n"},
+		{name: "Dataset index loaded", filePath: file.Name(),
+			datasets:          indexSet{"logs": fileprocessing.NewIndexHolder(nil)},
+			expectedReadiness: http.StatusOK, expectedBody: "ok\n"},
+		{name: "Dataset index pending", filePath: file.Name(),
+			datasets: indexSet{"logs": fileprocessing.NewIndexHolder(nil),
+				"orders": fileprocessing.NewPendingIndexHolder()},
+			expectedReadiness: http.StatusServiceUnavailable, expectedBody: "index of dataset \"orders\" is pending\n"},
+		{name: "Dataset index deferred", filePath: file.Name(),
+			datasets:          indexSet{"logs": fileprocessing.NewDeferredIndexHolder()},
+			expectedReadiness: http.StatusOK, expectedBody: "ok\n"},
+		{name: "Dataset index failed", filePath: file.Name(), datasets: indexSet{"logs": failedIndex},
+			expectedReadiness: http.StatusOK,
+			expectedBody: "degraded: index of dataset \"logs\" is unavailable, lines are served by scanning the file: " +
+				"failed to generate index\n"},
+		{name: "Default dataset index", filePath: file.Name(), index: failedIndex,
+			datasets:          indexSet{"default": failedIndex},
+			expectedReadiness: http.StatusOK,
+			expectedBody: "degraded: index is unavailable, lines are served by scanning the file: " +
+				"failed to generate index\n"},
+		{name: "Missing file", filePath: filepath.Join(t.TempDir(), "missing.txt"),
+			expectedReadiness: http.StatusServiceUnavailable},
+		{name: "Shutting down", filePath: file.Name(), shuttingDown: true,
+			expectedReadiness: http.StatusServiceUnavailable, expectedBody: "server is shutting down\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := health.NewChecker(&logger, tt.filePath, tt.index, tt.datasets)
+			if tt.shuttingDown {
+				checker.ShuttingDown()
+			}
+			router := http.NewServeMux()
+			checker.Register(router)
+
+			// The process is alive regardless of its readiness
+			rw := httptest.NewRecorder()
+			router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			assert.Equal(t, http.StatusOK, rw.Code)
+			assert.Equal(t, "ok\n", rw.Body.String())
+
+			rw = httptest.NewRecorder()
+			router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			assert.Equal(t, tt.expectedReadiness, rw.Code)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, rw.Body.String())
+			}
+		})
+	}
+
+	t.Run("Unreadable file", func(t *testing.T) {
+		// A directory is opened, but it cannot be read as a file
+		checker := health.NewChecker(&logger, t.TempDir(), nil, nil)
+		assert.ErrorContains(t, checker.Ready(), "failed to read file")
+	})
+}
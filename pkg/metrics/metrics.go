@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+)
+
+// namespace prefixes the names of the metrics of the line server.
+const namespace = "line_server"
+
+// Registry holds the metrics of the line server, along with the Go runtime and process metrics.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	// RequestsTotal counts the requests to the server API by route and status.
+	RequestsTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of requests to the server API by route and status.",
+	}, []string{"route", "status"})
+	// RequestDuration observes the latency of the requests to the server API by route and status.
+	RequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of the requests to the server API by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "status"})
+	// LinesServed counts the lines served by operation: line, batch or range.
+	LinesServed = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lines_served_total",
+		Help:      "Number of lines served by operation.",
+	}, []string{"operation"})
+	// DiskBytesRead counts the bytes read from the file to serve lines.
+	DiskBytesRead = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "disk_read_bytes_total",
+		Help:      "Number of bytes read from the file to serve lines.",
+	})
+	// IndexLookups counts the lookups of lines the reader is not positioned at, by result:
+	// hit if the index has a checkpoint for the line, or miss if the file is scanned without the index.
+	IndexLookups = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "index_lookups_total",
+		Help:      "Number of lookups of lines by result: hit if the index has a checkpoint for the line, or miss.",
+	}, []string{"result"})
+	// IndexScanDistance observes the number of lines scanned to reach a looked up line.
+	IndexScanDistance = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "index_scan_distance_lines",
+		Help:      "Number of lines scanned from the checkpoint or the current position to reach a looked up line.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 10),
+	})
+	// OpenFiles tracks the file handles opened to serve lines.
+	OpenFiles = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "open_files",
+		Help:      "Number of file handles opened to serve lines.",
+	})
+	// CacheRequests counts the lookups of the caches of the handler by cache (lines or blocks) and result
+	// (hit or miss), so the hit ratio of a cache is the rate of its hits over the rate of all its lookups.
+	CacheRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Number of lookups of the caches by cache and result: hit or miss.",
+	}, []string{"cache", "result"})
+	// CacheEvictions counts the entries evicted from the caches of the handler to fit their size, by cache.
+	CacheEvictions = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_evictions_total",
+		Help:      "Number of entries evicted from the caches to fit their size, by cache.",
+	}, []string{"cache"})
+	// CacheSize tracks the size in bytes of the entries of the caches of the handler, by cache.
+	CacheSize = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cache_size_bytes",
+		Help:      "Size in bytes of the entries of the caches, by cache.",
+	}, []string{"cache"})
+)
+
+// Index lookup results.
+const (
+	IndexHit  = "hit"
+	IndexMiss = "miss"
+)
+
+// Cache names and lookup results.
+const (
+	CacheLines  = "lines"
+	CacheBlocks = "blocks"
+	CacheHit    = "hit"
+	CacheMiss   = "miss"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// RegisterIndex registers the metrics describing the indexes of the current versions of the files of the datasets,
+// labeled by dataset name: their number of checkpoints, their size in bytes and the time they took to build.
+func RegisterIndex(indexes fileprocessing.IndexSet) error {
+	if err := Registry.Register(indexCollector{indexes: indexes}); err != nil {
+		return errors.Wrap(err, "failed to register index metrics")
+	}
+	return nil
+}
+
+var (
+	indexCheckpointsDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "index_checkpoints"),
+		"Number of checkpoints (indexed lines) of the index, by dataset.", []string{"dataset"}, nil)
+	indexSizeDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "index_size_bytes"),
+		"Size of the index in bytes, either allocated in memory or memory-mapped, by dataset.", []string{"dataset"}, nil)
+	indexBuildDurationDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "index_build_duration_seconds"),
+		"Time taken to load or generate the index, or elapsed so far while it is pending, by dataset.",
+		[]string{"dataset"}, nil)
+)
+
+// indexCollector collects the index metrics of the datasets, which are added and removed while the server runs.
+type indexCollector struct {
+	indexes fileprocessing.IndexSet
+}
+
+func (c indexCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- indexCheckpointsDesc
+	ch <- indexSizeDesc
+	ch <- indexBuildDurationDesc
+}
+
+func (c indexCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, index := range c.indexes.Indexes() {
+		checkpoints := 0
+		if fileIndexSummary := index.Load(); fileIndexSummary != nil {
+			checkpoints = len(fileIndexSummary.Index)
+		}
+		ch <- prometheus.MustNewConstMetric(indexCheckpointsDesc, prometheus.GaugeValue, float64(checkpoints), name)
+		// Each checkpoint is the int64 byte offset of its line
+		ch <- prometheus.MustNewConstMetric(indexSizeDesc, prometheus.GaugeValue, float64(checkpoints*8), name)
+		ch <- prometheus.MustNewConstMetric(indexBuildDurationDesc, prometheus.GaugeValue,
+			index.BuildDuration().Seconds(), name)
+	}
+}
+
+// Handler exposes the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,72 @@
+//go:build unit
+
+package metrics_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// indexSet is a set of index holders by dataset name.
+type indexSet map[string]*fileprocessing.IndexHolder
+
+func (s indexSet) Indexes() map[string]*fileprocessing.IndexHolder {
+	return s
+}
+
+func TestRegisterIndex(t *testing.T) {
+	index := fileprocessing.NewPendingIndexHolder()
+	indexes := indexSet{"default": index, "logs": fileprocessing.NewIndexHolder(nil)}
+	assert.Nil(t, metrics.RegisterIndex(indexes))
+
+	// expected returns the index metrics of the datasets with their number of checkpoints, sorted by name
+	expected := func(checkpoints ...any) string {
+		var b strings.Builder
+		b.WriteString(`
+# HELP line_server_index_checkpoints Number of checkpoints (indexed lines) of the index, by dataset.
+# TYPE line_server_index_checkpoints gauge
+`)
+		for i := 0; i < len(checkpoints); i += 2 {
+			fmt.Fprintf(&b, "line_server_index_checkpoints{dataset=%q} %d\n", checkpoints[i], checkpoints[i+1])
+		}
+		b.WriteString("# HELP line_server_index_size_bytes " +
+			"Size of the index in bytes, either allocated in memory or memory-mapped, by dataset.\n" +
+			"# TYPE line_server_index_size_bytes gauge\n")
+		for i := 0; i < len(checkpoints); i += 2 {
+			fmt.Fprintf(&b, "line_server_index_size_bytes{dataset=%q} %d\n", checkpoints[i], checkpoints[i+1].(int)*8)
+		}
+		return b.String()
+	}
+	assert.Nil(t, testutil.GatherAndCompare(metrics.Registry, strings.NewReader(expected("default", 0, "logs", 0)),
+		"line_server_index_checkpoints", "line_server_index_size_bytes"))
+
+	index.Store(&fileprocessing.FileIndexSummary{Index: []int64{0, 12, 24}, IndexOffset: 2, NumberOfLines: 6})
+	assert.Nil(t, testutil.GatherAndCompare(metrics.Registry, strings.NewReader(expected("default", 3, "logs", 0)),
+		"line_server_index_checkpoints", "line_server_index_size_bytes"))
+
+	// A dataset removed from the set is no longer reported
+	delete(indexes, "logs")
+	assert.Nil(t, testutil.GatherAndCompare(metrics.Registry, strings.NewReader(expected("default", 3)),
+		"line_server_index_checkpoints", "line_server_index_size_bytes"))
+
+	// The index metrics are registered once
+	assert.ErrorContains(t, metrics.RegisterIndex(indexes), "failed to register index metrics")
+}
+
+func TestHandler(t *testing.T) {
+	metrics.DiskBytesRead.Add(10)
+	rw := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), "line_server_disk_read_bytes_total")
+	assert.Contains(t, rw.Body.String(), "go_goroutines")
+}
@@ -0,0 +1,117 @@
+package middlewares
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/services/server"
+	"github.com/rs/zerolog"
+)
+
+// Scopes granted to the principals, which the operations of the server API require.
+const (
+	ScopeReadLines = "read-lines"
+	ScopeReadRange = "read-range"
+	ScopeSearch    = "search"
+	// ScopeAdmin grants every scope.
+	ScopeAdmin = "admin"
+)
+
+// Methods used to authenticate principals.
+const (
+	AuthMethodBasic  = "basic"
+	AuthMethodAPIKey = "api_key"
+	AuthMethodBearer = "bearer"
+)
+
+const principalKey contextKey = "Principal"
+
+// Principal is the authenticated caller of a request and the scopes it is granted.
+type Principal struct {
+	Name   string
+	Method string
+	Scopes []string
+}
+
+// HasScope checks if the principal is granted the scope, either directly or with the admin scope.
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// ParseScopes parses a comma or space separated list of scopes, validating each scope is known.
+func ParseScopes(value string) ([]string, error) {
+	scopes := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	for _, scope := range scopes {
+		switch scope {
+		case ScopeReadLines, ScopeReadRange, ScopeSearch, ScopeAdmin:
+		default:
+			return nil, errors.Errorf("unknown scope %q", scope)
+		}
+	}
+	return scopes, nil
+}
+
+// principalHolder holds the principal of a request for the middlewares wrapping the authentication,
+// such as LoggingMiddleware, as the context they pass on is not updated by the inner middlewares.
+type principalHolder struct {
+	principal *Principal
+}
+
+const principalHolderKey contextKey = "PrincipalHolder"
+
+// WithPrincipal returns a copy of the context carrying the principal,
+// which is also made available to the middlewares wrapping the authentication.
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	if holder, ok := ctx.Value(principalHolderKey).(*principalHolder); ok {
+		holder.principal = principal
+	}
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// PrincipalFromContext returns the principal authenticated for the request, or nil if authentication is disabled.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey).(*Principal)
+	return principal
+}
+
+// Authenticator authenticates the principal of a request from its credentials.
+// It returns nil if the request has no credentials for the authenticator, or an error if they are invalid.
+type Authenticator func(r *http.Request) (*Principal, error)
+
+// errInvalidCredentials is returned by the authenticators when the credentials of a request are invalid.
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// AuthMiddleware authenticates requests with the first authenticator accepting their credentials,
+// and injects the principal into the request context.
+// Requests with missing or invalid credentials get the 401 response declared in the API specification.
+func AuthMiddleware(log *zerolog.Logger, authenticators ...Authenticator) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, authenticate := range authenticators {
+				principal, err := authenticate(r)
+				if err != nil {
+					log.Debug().Err(err).Str("path", r.URL.RequestURI()).Msg("request not authenticated")
+					break
+				}
+				if principal != nil {
+					next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+					return
+				}
+			}
+			w.Header().Add("WWW-Authenticate", `Basic realm="`+authRealm+`", charset="UTF-8"`)
+			w.Header().Add("WWW-Authenticate", `Bearer realm="`+authRealm+`"`)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			err := json.NewEncoder(w).Encode(server.UnauthorizedResponse{Message: "credentials are missing or invalid"})
+			if err != nil {
+				log.Error().Err(err).Msg("failed to write unauthorized response")
+			}
+		})
+	}
+}
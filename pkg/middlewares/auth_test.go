@@ -0,0 +1,113 @@
+//go:build unit
+
+package middlewares_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/renanrv/line-server/pkg/middlewares"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		name           string
+		value          string
+		expectedScopes []string
+		expectedError  string
+	}{
+		{name: "Empty", value: "", expectedScopes: []string{}},
+		{name: "Comma separated", value: "read-lines,read-range",
+			expectedScopes: []string{middlewares.ScopeReadLines, middlewares.ScopeReadRange}},
+		{name: "Space separated", value: "search admin",
+			expectedScopes: []string{middlewares.ScopeSearch, middlewares.ScopeAdmin}},
+		{name: "Unknown scope", value: "read-lines,write", expectedError: "unknown scope \"write\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scopes, err := middlewares.ParseScopes(tt.value)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedScopes, scopes)
+		})
+	}
+}
+
+func TestPrincipal_HasScope(t *testing.T) {
+	reader := &middlewares.Principal{Scopes: []string{middlewares.ScopeReadLines}}
+	assert.True(t, reader.HasScope(middlewares.ScopeReadLines))
+	assert.False(t, reader.HasScope(middlewares.ScopeReadRange))
+
+	admin := &middlewares.Principal{Scopes: []string{middlewares.ScopeAdmin}}
+	assert.True(t, admin.HasScope(middlewares.ScopeReadRange))
+	assert.True(t, admin.HasScope(middlewares.ScopeSearch))
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	alice := &middlewares.Principal{Name: "alice", Method: middlewares.AuthMethodAPIKey}
+	authenticator := func(r *http.Request) (*middlewares.Principal, error) {
+		switch r.Header.Get(middlewares.APIKeyHeader) {
+		case "":
+			return nil, nil
+		case "alice-key":
+			return alice, nil
+		default:
+			return nil, errors.New("unknown API key")
+		}
+	}
+	noCredentials := func(r *http.Request) (*middlewares.Principal, error) {
+		return nil, nil
+	}
+	var logBuffer bytes.Buffer
+	log := zerolog.New(&logBuffer)
+	var principal *middlewares.Principal
+	handler := middlewares.LoggingMiddleware(&log)(middlewares.AuthMiddleware(&log, noCredentials, authenticator)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal = middlewares.PrincipalFromContext(r.Context())
+			w.WriteHeader(http.StatusOK)
+		})))
+
+	tests := []struct {
+		name              string
+		apiKey            string
+		expectedStatus    int
+		expectedPrincipal *middlewares.Principal
+	}{
+		{name: "Valid credentials", apiKey: "alice-key", expectedStatus: http.StatusOK, expectedPrincipal: alice},
+		{name: "Invalid credentials", apiKey: "unknown-key", expectedStatus: http.StatusUnauthorized},
+		{name: "Missing credentials", expectedStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal = nil
+			logBuffer.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/v0/lines/1", nil)
+			if tt.apiKey != "" {
+				req.Header.Set(middlewares.APIKeyHeader, tt.apiKey)
+			}
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			assert.Equal(t, tt.expectedStatus, rw.Code)
+			assert.Equal(t, tt.expectedPrincipal, principal)
+			if tt.expectedPrincipal != nil {
+				assert.Contains(t, logBuffer.String(), `"principal":"alice"`)
+				assert.Contains(t, logBuffer.String(), `"auth-method":"api_key"`)
+			} else {
+				assert.NotContains(t, logBuffer.String(), `"principal"`)
+				assert.Equal(t, []string{`Basic realm="line-server", charset="UTF-8"`, `Bearer realm="line-server"`},
+					rw.Header().Values("WWW-Authenticate"))
+				assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+				assert.JSONEq(t, `{"message":"credentials are missing or invalid"}`, rw.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package middlewares
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// authRealm is the realm of the credentials requested with the WWW-Authenticate header.
+const authRealm = "line-server"
+
+// unknownUserHash is compared with the password of unknown users,
+// so the response time does not reveal whether a user exists.
+var unknownUserHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("unknown user"), bcrypt.DefaultCost)
+	return hash
+})
+
+// Htpasswd authenticates users with the bcrypt hashed passwords of a htpasswd file,
+// with one `username:hash` entry per line.
+// The file can be reloaded at any time, atomically replacing the users while requests are authenticated.
+type Htpasswd struct {
+	path  string
+	users atomic.Pointer[htpasswdUsers]
+}
+
+// htpasswdUsers holds the users loaded from a htpasswd file.
+// Comparing bcrypt hashes is deliberately slow, so successfully authenticated credentials are cached
+// until the file is reloaded.
+type htpasswdUsers struct {
+	hashes        map[string][]byte
+	authenticated sync.Map
+}
+
+// LoadHtpasswd loads the users of a htpasswd file.
+// Only bcrypt hashes are supported, and an error is returned for any other entry.
+func LoadHtpasswd(path string) (*Htpasswd, error) {
+	if path == "" {
+		return nil, errors.New("htpasswd path cannot be empty")
+	}
+	h := &Htpasswd{path: path}
+	if err := h.Reload(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Reload loads the users of the htpasswd file again.
+// If the file cannot be loaded, the users previously loaded are kept.
+func (h *Htpasswd) Reload() error {
+	file, err := os.Open(h.path)
+	if err != nil {
+		return errors.Wrap(err, "failed to open htpasswd file")
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	hashes := map[string][]byte{}
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		username, hash, found := strings.Cut(line, ":")
+		if !found || username == "" {
+			return errors.Errorf("invalid htpasswd entry at line %d", lineNumber)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return errors.Errorf("unsupported htpasswd hash for user %q at line %d, only bcrypt is supported",
+				username, lineNumber)
+		}
+		hashes[username] = []byte(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "failed to read htpasswd file")
+	}
+	h.users.Store(&htpasswdUsers{hashes: hashes})
+	return nil
+}
+
+// Authenticate checks the password of the user.
+func (h *Htpasswd) Authenticate(username string, password string) bool {
+	users := h.users.Load()
+	key := sha256.Sum256([]byte(username + ":" + password))
+	if _, ok := users.authenticated.Load(key); ok {
+		return true
+	}
+	hash, ok := users.hashes[username]
+	if !ok {
+		_ = bcrypt.CompareHashAndPassword(unknownUserHash(), []byte(password))
+		return false
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return false
+	}
+	users.authenticated.Store(key, struct{}{})
+	return true
+}
+
+// BasicAuthenticator authenticates requests with the HTTP Basic authentication scheme,
+// checking the credentials against the htpasswd users, which are granted the given scopes.
+func (h *Htpasswd) BasicAuthenticator(scopes []string) Authenticator {
+	return func(r *http.Request) (*Principal, error) {
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			return nil, nil
+		}
+		if !h.Authenticate(username, password) {
+			return nil, errors.Wrapf(errInvalidCredentials, "user %q", username)
+		}
+		return &Principal{Name: username, Method: AuthMethodBasic, Scopes: scopes}, nil
+	}
+}
+
+// BasicAuthMiddleware authenticates requests with the HTTP Basic authentication scheme only,
+// granting every scope to the htpasswd users.
+func BasicAuthMiddleware(log *zerolog.Logger, htpasswd *Htpasswd) func(next http.Handler) http.Handler {
+	return AuthMiddleware(log, htpasswd.BasicAuthenticator([]string{ScopeAdmin}))
+}
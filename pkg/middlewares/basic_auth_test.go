@@ -0,0 +1,122 @@
+//go:build unit
+
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/renanrv/line-server/pkg/middlewares"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// writeHtpasswd writes a htpasswd file with the bcrypt hashed passwords of the users
+func writeHtpasswd(t *testing.T, path string, users map[string]string) {
+	t.Helper()
+	content := "# line server users\n\n"
+	for username, password := range users {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		assert.Nil(t, err)
+		content += username + ":" + string(hash) + "\n"
+	}
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+func TestLoadHtpasswd(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		expectedError string
+	}{
+		{name: "Invalid entry", content: "alice\n", expectedError: "invalid htpasswd entry at line 1"},
+		{name: "Missing username", content: ":$2y$05$abc\n", expectedError: "invalid htpasswd entry at line 1"},
+		{name: "Unsupported hash", content: "# comment\nalice:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n",
+			expectedError: "unsupported htpasswd hash for user \"alice\" at line 2, only bcrypt is supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "htpasswd")
+			assert.Nil(t, os.WriteFile(path, []byte(tt.content), 0o600))
+			_, err := middlewares.LoadHtpasswd(path)
+			assert.EqualError(t, err, tt.expectedError)
+		})
+	}
+
+	t.Run("Missing file", func(t *testing.T) {
+		_, err := middlewares.LoadHtpasswd(filepath.Join(t.TempDir(), "htpasswd"))
+		assert.ErrorContains(t, err, "failed to open htpasswd file")
+	})
+
+	t.Run("Empty path", func(t *testing.T) {
+		_, err := middlewares.LoadHtpasswd("")
+		assert.EqualError(t, err, "htpasswd path cannot be empty")
+	})
+}
+
+func TestHtpasswd_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	writeHtpasswd(t, path, map[string]string{"alice": "secret"})
+	htpasswd, err := middlewares.LoadHtpasswd(path)
+	assert.Nil(t, err)
+	assert.True(t, htpasswd.Authenticate("alice", "secret"))
+	assert.False(t, htpasswd.Authenticate("bob", "password"))
+
+	// The reloaded users replace the users previously loaded, including the authenticated credentials
+	writeHtpasswd(t, path, map[string]string{"alice": "changed", "bob": "password"})
+	assert.Nil(t, htpasswd.Reload())
+	assert.False(t, htpasswd.Authenticate("alice", "secret"))
+	assert.True(t, htpasswd.Authenticate("alice", "changed"))
+	assert.True(t, htpasswd.Authenticate("bob", "password"))
+
+	// An invalid file keeps the users previously loaded
+	assert.Nil(t, os.WriteFile(path, []byte("invalid\n"), 0o600))
+	assert.NotNil(t, htpasswd.Reload())
+	assert.True(t, htpasswd.Authenticate("bob", "password"))
+}
+
+func TestBasicAuthMiddleware(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	writeHtpasswd(t, path, map[string]string{"alice": "secret"})
+	htpasswd, err := middlewares.LoadHtpasswd(path)
+	assert.Nil(t, err)
+	log := zerolog.New(nil)
+	handler := middlewares.BasicAuthMiddleware(&log, htpasswd)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+	tests := []struct {
+		name           string
+		username       string
+		password       string
+		withoutAuth    bool
+		expectedStatus int
+	}{
+		{name: "Valid credentials", username: "alice", password: "secret", expectedStatus: http.StatusOK},
+		{name: "Invalid password", username: "alice", password: "wrong", expectedStatus: http.StatusUnauthorized},
+		{name: "Unknown user", username: "bob", password: "secret", expectedStatus: http.StatusUnauthorized},
+		{name: "Missing credentials", withoutAuth: true, expectedStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v0/lines/1", nil)
+			if !tt.withoutAuth {
+				req.SetBasicAuth(tt.username, tt.password)
+			}
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			assert.Equal(t, tt.expectedStatus, rw.Code)
+			if tt.expectedStatus == http.StatusUnauthorized {
+				assert.Equal(t, `Basic realm="line-server", charset="UTF-8"`, rw.Header().Get("WWW-Authenticate"))
+				assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+				assert.JSONEq(t, `{"message":"credentials are missing or invalid"}`, rw.Body.String())
+			}
+		})
+	}
+}
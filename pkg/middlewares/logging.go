@@ -29,19 +29,23 @@ func LoggingMiddleware(log *zerolog.Logger) func(next http.Handler) http.Handler
 				requestTraceID = uuid.New().String()
 			}
 
-			// Inject trace-id into context
+			// Inject trace-id into context, along with a holder for the principal authenticated by inner middlewares
+			holder := &principalHolder{}
 			ctx := context.WithValue(r.Context(), RequestTraceIDKey, requestTraceID)
+			ctx = context.WithValue(ctx, principalHolderKey, holder)
 			r = r.WithContext(ctx)
 
 			pathsToIgnoreLogging := []string{
 				"/metrics", // to avoid log pollution with /metrics endpoint being hit
+				"/healthz", // as well as the health endpoints probed by the orchestrator
+				"/readyz",
 			}
 
 			// skip unwanted paths
 			if !slices.Contains(pathsToIgnoreLogging, r.URL.RequestURI()) {
 				// log the endpoint call metrics
 				defer func() {
-					log.Info().Fields(map[string]interface{}{
+					fields := map[string]interface{}{
 						"method":      r.Method,
 						"requester":   r.RemoteAddr,
 						"trace-id":    requestTraceID,
@@ -51,7 +55,12 @@ func LoggingMiddleware(log *zerolog.Logger) func(next http.Handler) http.Handler
 						"resp-status": rw.Status,
 						"resp-bytes":  rw.BytesWritten,
 						"duration-ms": time.Since(start).Milliseconds(),
-					}).Msg(
+					}
+					if holder.principal != nil {
+						fields["principal"] = holder.principal.Name
+						fields["auth-method"] = holder.principal.Method
+					}
+					log.Info().Fields(fields).Msg(
 						"endpoint call",
 					)
 				}()
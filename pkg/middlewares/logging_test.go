@@ -28,6 +28,13 @@ func TestLoggingMiddleware(t *testing.T) {
 			expectedStatus: http.StatusOK,
 			expectedLog:    "",
 		},
+		{
+			name:           "GET request to readiness endpoint",
+			method:         "GET",
+			url:            "/readyz",
+			expectedStatus: http.StatusOK,
+			expectedLog:    "",
+		},
 		{
 			name:           "GET request to lines endpoint",
 			method:         "GET",
@@ -0,0 +1,42 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/renanrv/line-server/pkg/metrics"
+	"github.com/renanrv/line-server/pkg/utils"
+)
+
+// unmatchedRoute labels the requests not matching any route of the server API,
+// so unknown paths do not create new label values.
+const unmatchedRoute = "unmatched"
+
+// MetricsMiddleware counts the requests and observes their latency by route and status.
+// The route is the pattern of the router matching the request, such as `GET /v0/lines/{line_index}`,
+// resolved before the request is handled, so requests rejected by other middlewares are labelled too.
+func MetricsMiddleware(routes *http.ServeMux) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := utils.WrapResponseWriter(w)
+			start := time.Now()
+			_, route := routes.Handler(r)
+			if route == "" {
+				route = unmatchedRoute
+			}
+			defer func() {
+				status := rw.Status
+				// The status is implicit if the handler wrote the body without writing the header
+				if status == 0 {
+					status = http.StatusOK
+				}
+				labels := []string{route, strconv.Itoa(status)}
+				metrics.RequestsTotal.WithLabelValues(labels...).Inc()
+				metrics.RequestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+			}()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
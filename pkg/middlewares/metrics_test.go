@@ -0,0 +1,48 @@
+//go:build unit
+
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/renanrv/line-server/pkg/metrics"
+	"github.com/renanrv/line-server/pkg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	routes := http.NewServeMux()
+	routes.HandleFunc("GET /v0/lines/{line_index}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("line_index") == "100" {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		_, _ = w.Write([]byte(`{"text":"line"}`))
+	})
+	handler := middlewares.MetricsMiddleware(routes)(routes)
+
+	tests := []struct {
+		name          string
+		path          string
+		expectedRoute string
+		expectedCode  string
+	}{
+		{name: "Implicit status", path: "/v0/lines/1", expectedRoute: "GET /v0/lines/{line_index}",
+			expectedCode: "200"},
+		{name: "Written status", path: "/v0/lines/100", expectedRoute: "GET /v0/lines/{line_index}",
+			expectedCode: "413"},
+		{name: "Unmatched route", path: "/unknown/1", expectedRoute: "unmatched", expectedCode: "404"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := metrics.RequestsTotal.WithLabelValues(tt.expectedRoute, tt.expectedCode)
+			before := testutil.ToFloat64(requests)
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assert.Equal(t, before+1, testutil.ToFloat64(requests))
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package middlewares
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// APIKeyHeader is the header carrying the API key of a request.
+const APIKeyHeader = "X-API-Key"
+
+// minBearerKeySize is the minimum size in bytes of the secret of a bearer token signing key.
+const minBearerKeySize = 32
+
+// bearerTokenLeeway is the clock skew tolerated when validating the expiration and not before times of a token.
+const bearerTokenLeeway = time.Minute
+
+// bearerAlgorithms maps the supported HMAC algorithms of the bearer tokens to their hash functions.
+var bearerAlgorithms = map[string]func() hash.Hash{
+	"HS256": sha256.New,
+	"HS384": sha512.New384,
+	"HS512": sha512.New,
+}
+
+// ServiceKeys holds the API keys and the bearer token signing keys of the service consumers,
+// loaded from a JSON file that can be reloaded at any time.
+// API keys are stored as the hex encoded SHA-256 of the key, so the file does not hold usable keys.
+type ServiceKeys struct {
+	path string
+	keys atomic.Pointer[serviceKeys]
+}
+
+// serviceKeysFile is the content of a service keys file.
+type serviceKeysFile struct {
+	APIKeys []struct {
+		Name   string   `json:"name"`
+		SHA256 string   `json:"sha256"`
+		Scopes []string `json:"scopes"`
+	} `json:"api_keys"`
+	BearerKeys []struct {
+		ID        string `json:"id"`
+		Algorithm string `json:"algorithm"`
+		Secret    string `json:"secret"`
+	} `json:"bearer_keys"`
+}
+
+// serviceKeys holds the keys loaded from a service keys file.
+type serviceKeys struct {
+	apiKeys    map[[sha256.Size]byte]*Principal
+	bearerKeys []bearerKey
+}
+
+// bearerKey is a key verifying the HMAC signature of bearer tokens.
+type bearerKey struct {
+	id        string
+	algorithm string
+	secret    []byte
+}
+
+// LoadServiceKeys loads the API keys and the bearer token signing keys of a service keys file.
+func LoadServiceKeys(path string) (*ServiceKeys, error) {
+	if path == "" {
+		return nil, errors.New("service keys path cannot be empty")
+	}
+	k := &ServiceKeys{path: path}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload loads the keys of the service keys file again.
+// If the file cannot be loaded, the keys previously loaded are kept.
+func (k *ServiceKeys) Reload() error {
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return errors.Wrap(err, "failed to read service keys file")
+	}
+	var file serviceKeysFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return errors.Wrap(err, "failed to parse service keys file")
+	}
+	keys := &serviceKeys{apiKeys: map[[sha256.Size]byte]*Principal{}}
+	for i, apiKey := range file.APIKeys {
+		digest, err := hex.DecodeString(apiKey.SHA256)
+		if apiKey.Name == "" || err != nil || len(digest) != sha256.Size {
+			return errors.Errorf("invalid API key at position %d, a name and a hex encoded SHA-256 are required", i)
+		}
+		scopes, err := ParseScopes(strings.Join(apiKey.Scopes, ","))
+		if err != nil {
+			return errors.Wrapf(err, "invalid scopes of API key %q", apiKey.Name)
+		}
+		keys.apiKeys[[sha256.Size]byte(digest)] = &Principal{
+			Name:   apiKey.Name,
+			Method: AuthMethodAPIKey,
+			Scopes: scopes,
+		}
+	}
+	for i, key := range file.BearerKeys {
+		secret, err := base64.StdEncoding.DecodeString(key.Secret)
+		if err != nil || len(secret) < minBearerKeySize {
+			return errors.Errorf("invalid bearer key at position %d, a base64 encoded secret of at least %d bytes "+
+				"is required", i, minBearerKeySize)
+		}
+		if _, ok := bearerAlgorithms[key.Algorithm]; !ok {
+			return errors.Errorf("unsupported algorithm %q of bearer key at position %d, "+
+				"it must be HS256, HS384 or HS512", key.Algorithm, i)
+		}
+		keys.bearerKeys = append(keys.bearerKeys, bearerKey{id: key.ID, algorithm: key.Algorithm, secret: secret})
+	}
+	k.keys.Store(keys)
+	return nil
+}
+
+// APIKeyAuthenticator authenticates requests with the API key of the X-API-Key header.
+func (k *ServiceKeys) APIKeyAuthenticator() Authenticator {
+	return func(r *http.Request) (*Principal, error) {
+		apiKey := r.Header.Get(APIKeyHeader)
+		if apiKey == "" {
+			return nil, nil
+		}
+		principal, ok := k.keys.Load().apiKeys[sha256.Sum256([]byte(apiKey))]
+		if !ok {
+			return nil, errors.Wrap(errInvalidCredentials, "unknown API key")
+		}
+		return principal, nil
+	}
+}
+
+// BearerAuthenticator authenticates requests with the bearer token of the Authorization header.
+// The token is a JWT signed with HMAC by one of the bearer keys, selected by the `kid` header if present.
+// The principal is the `sub` claim, and its scopes are the space separated scopes of the `scope` claim.
+func (k *ServiceKeys) BearerAuthenticator() Authenticator {
+	return func(r *http.Request) (*Principal, error) {
+		scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") {
+			return nil, nil
+		}
+		principal, err := k.verifyBearerToken(strings.TrimSpace(token), time.Now())
+		if err != nil {
+			return nil, errors.Wrap(errInvalidCredentials, err.Error())
+		}
+		return principal, nil
+	}
+}
+
+// bearerTokenHeader is the JOSE header of a bearer token.
+type bearerTokenHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// bearerTokenClaims are the claims of a bearer token.
+type bearerTokenClaims struct {
+	Subject   string   `json:"sub"`
+	Scope     string   `json:"scope"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+}
+
+// verifyBearerToken verifies the signature and the claims of a bearer token, returning its principal.
+func (k *ServiceKeys) verifyBearerToken(token string, now time.Time) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed bearer token")
+	}
+	var header bearerTokenHeader
+	if err := decodeTokenPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed bearer token signature")
+	}
+	// The algorithm of the token must match the algorithm of the key, so tokens cannot downgrade it
+	verified := false
+	for _, key := range k.keys.Load().bearerKeys {
+		if key.algorithm != header.Algorithm || (header.KeyID != "" && key.id != header.KeyID) {
+			continue
+		}
+		mac := hmac.New(bearerAlgorithms[key.algorithm], key.secret)
+		mac.Write([]byte(parts[0] + "." + parts[1]))
+		if hmac.Equal(mac.Sum(nil), signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.New("invalid bearer token signature")
+	}
+
+	var claims bearerTokenClaims
+	if err := decodeTokenPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	// Tokens without expiration would grant access until their key is rotated, so the expiration is required
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("bearer token expiration is required")
+	}
+	if now.After(time.Unix(int64(*claims.ExpiresAt), 0).Add(bearerTokenLeeway)) {
+		return nil, errors.New("bearer token expired")
+	}
+	if claims.NotBefore != nil && now.Before(time.Unix(int64(*claims.NotBefore), 0).Add(-bearerTokenLeeway)) {
+		return nil, errors.New("bearer token not valid yet")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("bearer token subject is required")
+	}
+	scopes, err := ParseScopes(claims.Scope)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid bearer token scope")
+	}
+	return &Principal{Name: claims.Subject, Method: AuthMethodBearer, Scopes: scopes}, nil
+}
+
+// decodeTokenPart decodes a base64url encoded JSON part of a bearer token.
+func decodeTokenPart(part string, value any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errors.New("malformed bearer token")
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return errors.New("malformed bearer token")
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+//go:build unit
+
+package middlewares_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/renanrv/line-server/pkg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+var bearerSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// writeServiceKeys writes a service keys file with an API key for the etl consumer and a HS256 bearer key
+func writeServiceKeys(t *testing.T, path string, apiKey string) {
+	t.Helper()
+	digest := sha256.Sum256([]byte(apiKey))
+	content := `{
+  "api_keys": [{"name": "etl", "sha256": "` + hex.EncodeToString(digest[:]) + `", "scopes": ["read-lines"]}],
+  "bearer_keys": [{"id": "2025-01", "algorithm": "HS256", "secret": "` +
+		base64.StdEncoding.EncodeToString(bearerSecret) + `"}]
+}`
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+// signToken signs a JWT with HS256 and the given header and claims
+func signToken(t *testing.T, header map[string]any, claims map[string]any, secret []byte) string {
+	t.Helper()
+	encode := func(value map[string]any) string {
+		data, err := json.Marshal(value)
+		assert.Nil(t, err)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signingInput := encode(header) + "." + encode(claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestLoadServiceKeys(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		expectedError string
+	}{
+		{name: "Invalid JSON", content: "{", expectedError: "failed to parse service keys file"},
+		{name: "Missing API key name", content: `{"api_keys": [{"sha256": "` + strings.Repeat("a", 64) + `"}]}`,
+			expectedError: "invalid API key at position 0, a name and a hex encoded SHA-256 are required"},
+		{name: "Invalid API key hash", content: `{"api_keys": [{"name": "etl", "sha256": "abc"}]}`,
+			expectedError: "invalid API key at position 0, a name and a hex encoded SHA-256 are required"},
+		{name: "Unknown API key scope",
+			content: `{"api_keys": [{"name": "etl", "sha256": "` + strings.Repeat("a", 64) +
+				`", "scopes": ["write"]}]}`,
+			expectedError: "invalid scopes of API key \"etl\": unknown scope \"write\""},
+		{name: "Short bearer key secret", content: `{"bearer_keys": [{"algorithm": "HS256", "secret": "c2hvcnQ="}]}`,
+			expectedError: "invalid bearer key at position 0, a base64 encoded secret of at least 32 bytes " +
+				"is required"},
+		{name: "Unsupported bearer key algorithm", content: `{"bearer_keys": [{"algorithm": "RS256", "secret": "` +
+			base64.StdEncoding.EncodeToString(bearerSecret) + `"}]}`,
+			expectedError: "unsupported algorithm \"RS256\" of bearer key at position 0, " +
+				"it must be HS256, HS384 or HS512"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys.json")
+			assert.Nil(t, os.WriteFile(path, []byte(tt.content), 0o600))
+			_, err := middlewares.LoadServiceKeys(path)
+			assert.ErrorContains(t, err, tt.expectedError)
+		})
+	}
+
+	t.Run("Missing file", func(t *testing.T) {
+		_, err := middlewares.LoadServiceKeys(filepath.Join(t.TempDir(), "keys.json"))
+		assert.ErrorContains(t, err, "failed to read service keys file")
+	})
+
+	t.Run("Empty path", func(t *testing.T) {
+		_, err := middlewares.LoadServiceKeys("")
+		assert.EqualError(t, err, "service keys path cannot be empty")
+	})
+}
+
+func TestServiceKeys_APIKeyAuthenticator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeServiceKeys(t, path, "etl-key")
+	keys, err := middlewares.LoadServiceKeys(path)
+	assert.Nil(t, err)
+	authenticate := keys.APIKeyAuthenticator()
+
+	req := httptest.NewRequest(http.MethodGet, "/v0/lines/1", nil)
+	principal, err := authenticate(req)
+	assert.Nil(t, err)
+	assert.Nil(t, principal)
+
+	req.Header.Set(middlewares.APIKeyHeader, "etl-key")
+	principal, err = authenticate(req)
+	assert.Nil(t, err)
+	assert.Equal(t, &middlewares.Principal{Name: "etl", Method: middlewares.AuthMethodAPIKey,
+		Scopes: []string{middlewares.ScopeReadLines}}, principal)
+
+	req.Header.Set(middlewares.APIKeyHeader, "unknown-key")
+	_, err = authenticate(req)
+	assert.ErrorContains(t, err, "unknown API key")
+
+	// The reloaded keys replace the keys previously loaded
+	writeServiceKeys(t, path, "rotated-key")
+	assert.Nil(t, keys.Reload())
+	req.Header.Set(middlewares.APIKeyHeader, "etl-key")
+	_, err = authenticate(req)
+	assert.ErrorContains(t, err, "unknown API key")
+}
+
+func TestServiceKeys_BearerAuthenticator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeServiceKeys(t, path, "etl-key")
+	keys, err := middlewares.LoadServiceKeys(path)
+	assert.Nil(t, err)
+	authenticate := keys.BearerAuthenticator()
+
+	header := map[string]any{"alg": "HS256", "typ": "JWT", "kid": "2025-01"}
+	now := time.Now().Unix()
+	tests := []struct {
+		name              string
+		authorization     string
+		expectedPrincipal *middlewares.Principal
+		expectedError     string
+	}{
+		{name: "Missing token"},
+		{name: "Basic credentials", authorization: "Basic YWxpY2U6c2VjcmV0"},
+		{name: "Valid token",
+			authorization: "Bearer " + signToken(t, header,
+				map[string]any{"sub": "reporting", "scope": "read-lines read-range", "exp": now + 60}, bearerSecret),
+			expectedPrincipal: &middlewares.Principal{Name: "reporting", Method: middlewares.AuthMethodBearer,
+				Scopes: []string{middlewares.ScopeReadLines, middlewares.ScopeReadRange}}},
+		{name: "Valid token without key id",
+			authorization: "bearer " + signToken(t, map[string]any{"alg": "HS256"},
+				map[string]any{"sub": "reporting", "nbf": now, "exp": now + 60}, bearerSecret),
+			expectedPrincipal: &middlewares.Principal{Name: "reporting", Method: middlewares.AuthMethodBearer,
+				Scopes: []string{}}},
+		{name: "Malformed token", authorization: "Bearer abc.def", expectedError: "malformed bearer token"},
+		{name: "Invalid signature",
+			authorization: "Bearer " + signToken(t, header, map[string]any{"sub": "reporting"},
+				[]byte("fedcba9876543210fedcba9876543210")),
+			expectedError: "invalid bearer token signature"},
+		{name: "Unknown key id",
+			authorization: "Bearer " + signToken(t, map[string]any{"alg": "HS256", "kid": "2024-01"},
+				map[string]any{"sub": "reporting"}, bearerSecret),
+			expectedError: "invalid bearer token signature"},
+		{name: "Algorithm mismatch",
+			authorization: "Bearer " + signToken(t, map[string]any{"alg": "none"},
+				map[string]any{"sub": "reporting"}, bearerSecret),
+			expectedError: "invalid bearer token signature"},
+		{name: "Expired token",
+			authorization: "Bearer " + signToken(t, header, map[string]any{"sub": "reporting", "exp": now - 3600},
+				bearerSecret),
+			expectedError: "bearer token expired"},
+		{name: "Missing expiration",
+			authorization: "Bearer " + signToken(t, header, map[string]any{"sub": "reporting"}, bearerSecret),
+			expectedError: "bearer token expiration is required"},
+		{name: "Token not valid yet",
+			authorization: "Bearer " + signToken(t, header,
+				map[string]any{"sub": "reporting", "nbf": now + 3600, "exp": now + 7200}, bearerSecret),
+			expectedError: "bearer token not valid yet"},
+		{name: "Missing subject",
+			authorization: "Bearer " + signToken(t, header, map[string]any{"scope": "read-lines", "exp": now + 60},
+				bearerSecret),
+			expectedError: "bearer token subject is required"},
+		{name: "Unknown scope",
+			authorization: "Bearer " + signToken(t, header,
+				map[string]any{"sub": "reporting", "scope": "write", "exp": now + 60}, bearerSecret),
+			expectedError: "invalid bearer token scope: unknown scope \"write\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v0/lines/1", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			principal, err := authenticate(req)
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedPrincipal, principal)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package source
+
+import (
+	"io"
+	"io/fs"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// FS is a line source of a file of an io/fs.FS, such as an embedded file system or a directory.
+// The files are read with positional reads if they implement io.ReaderAt, such as the files of os.DirFS,
+// embed.FS and fstest.MapFS, or by seeking them otherwise, serializing the reads of an opened file.
+type FS struct {
+	fsys fs.FS
+	name string
+}
+
+// NewFS creates a line source of the file of the file system with the name, a slash-separated path.
+func NewFS(fsys fs.FS, name string) *FS {
+	return &FS{fsys: fsys, name: name}
+}
+
+// Name returns the name of the file in the file system.
+func (f *FS) Name() string {
+	return f.name
+}
+
+// Stat returns the info of the file.
+func (f *FS) Stat() (Info, error) {
+	info, err := fs.Stat(f.fsys, f.name)
+	if err != nil {
+		return Info{}, err
+	}
+	return f.info(info), nil
+}
+
+// Open opens the file, which must support positional reads or seeking.
+func (f *FS) Open() (File, error) {
+	file, err := f.fsys.Open(f.name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	opened := fsFile{File: file, info: f.info(info)}
+	switch r := file.(type) {
+	case io.ReaderAt:
+		opened.ReaderAt = r
+	case io.ReadSeeker:
+		opened.ReaderAt = &seekingReaderAt{file: r}
+	default:
+		_ = file.Close()
+		return nil, errors.Errorf("file %q does not support positional reads", f.name)
+	}
+	return opened, nil
+}
+
+// info describes the file, identified by its name, as the file systems do not identify their files otherwise.
+func (f *FS) info(info fs.FileInfo) Info {
+	return Info{Size: info.Size(), ModTime: info.ModTime(), tag: f.name}
+}
+
+// fsFile is an opened file of a file system.
+type fsFile struct {
+	fs.File
+	io.ReaderAt
+	info Info
+}
+
+// Stat returns the info of the opened file.
+func (f fsFile) Stat() (Info, error) {
+	return f.info, nil
+}
+
+// seekingReaderAt serves the positional reads of a file without them by seeking it before each read.
+type seekingReaderAt struct {
+	mu   sync.Mutex
+	file io.ReadSeeker
+}
+
+func (r *seekingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.file.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r.file, p)
+	if err == io.ErrUnexpectedEOF {
+		// The file ends before the buffer is filled
+		err = io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,282 @@
+package source
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/cache"
+)
+
+const (
+	// DefaultHTTPBlockSize is the size in bytes of the blocks fetched from a remote file, if not configured.
+	DefaultHTTPBlockSize = 1024 * 1024
+	// DefaultHTTPRetryBackoff is the delay before the first retry of a failed request, if not configured.
+	DefaultHTTPRetryBackoff = 100 * time.Millisecond
+	// DefaultHTTPTimeout limits the duration of the requests of the default client.
+	DefaultHTTPTimeout = 30 * time.Second
+)
+
+// ErrRemoteFileChanged is returned when a remote file changed since its version was opened,
+// so the blocks of the version cannot be fetched anymore.
+var ErrRemoteFileChanged = errors.New("remote file changed")
+
+// HTTPOptions holds the optional settings of a remote file.
+type HTTPOptions struct {
+	// Client sends the requests. If nil, a client with DefaultHTTPTimeout is used.
+	Client *http.Client
+	// BlockSize is the size in bytes of the blocks fetched with range requests. If 0, DefaultHTTPBlockSize is used.
+	BlockSize int64
+	// CacheSize limits the size in bytes of the cache of the most recently fetched blocks. If 0, it is disabled.
+	CacheSize int64
+	// Retries is the number of times a request failing with a network error or a transient status is retried.
+	Retries int
+	// RetryBackoff is the delay before the first retry, doubled on every retry. If 0, DefaultHTTPRetryBackoff is used.
+	RetryBackoff time.Duration
+}
+
+// HTTP is a line source of a remote file served by an HTTP server supporting range requests,
+// such as a static file server. The file is fetched in blocks, cached by the version of the file,
+// and its versions are identified by their ETag, or by their size and modification time if the server has no ETags.
+// A remote file is never considered as grown, as its ETag changes once it is modified, so it is reloaded instead.
+type HTTP struct {
+	url  string
+	opts HTTPOptions
+	// blocks caches the fetched blocks, keyed by the version of the file
+	blocks *cache.LRU[httpBlock, []byte]
+}
+
+// httpBlock identifies a block of a version of a remote file.
+type httpBlock struct {
+	tag   string
+	index int64
+}
+
+// NewHTTP creates a line source of the remote file of the http or https URL.
+func NewHTTP(rawURL string, opts HTTPOptions) (*HTTP, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid URL")
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, errors.Errorf("invalid URL %q, an http or https URL is required", rawURL)
+	}
+	if opts.BlockSize < 0 || opts.CacheSize < 0 || opts.Retries < 0 || opts.RetryBackoff < 0 {
+		return nil, errors.New("block size, cache size, retries and retry backoff cannot be negative")
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: DefaultHTTPTimeout}
+	}
+	if opts.BlockSize == 0 {
+		opts.BlockSize = DefaultHTTPBlockSize
+	}
+	if opts.RetryBackoff == 0 {
+		opts.RetryBackoff = DefaultHTTPRetryBackoff
+	}
+	h := &HTTP{url: rawURL, opts: opts}
+	if opts.CacheSize > 0 {
+		h.blocks = cache.NewLRU[httpBlock, []byte](opts.CacheSize)
+	}
+	return h, nil
+}
+
+// Name returns the URL of the remote file.
+func (h *HTTP) Name() string {
+	return h.url
+}
+
+// Stat returns the info of the current version of the remote file, requested with a HEAD request.
+func (h *HTTP) Stat() (Info, error) {
+	var info Info
+	err := h.retry(func() (bool, error) {
+		request, err := http.NewRequest(http.MethodHead, h.url, nil)
+		if err != nil {
+			return false, errors.Wrap(err, "failed to create request")
+		}
+		response, err := h.opts.Client.Do(request)
+		if err != nil {
+			return true, errors.Wrap(err, "failed to request remote file")
+		}
+		_ = response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return transient(response.StatusCode), statusError(response)
+		}
+		if response.ContentLength < 0 {
+			return false, errors.New("remote file has no content length")
+		}
+		info = httpInfo(response.ContentLength, response.Header)
+		return false, nil
+	})
+	return info, err
+}
+
+// Open opens the current version of the remote file, whose blocks are fetched as they are read.
+func (h *HTTP) Open() (File, error) {
+	info, err := h.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return httpFile{src: h, info: info}, nil
+}
+
+// block returns the block of the version of the remote file, from the cache or fetched with a range request.
+func (h *HTTP) block(info Info, index int64) ([]byte, error) {
+	key := httpBlock{tag: info.tag, index: index}
+	if h.blocks != nil {
+		if data, ok := h.blocks.Get(key); ok {
+			return data, nil
+		}
+	}
+	start := index * h.opts.BlockSize
+	end := min(start+h.opts.BlockSize, info.Size)
+	var data []byte
+	err := h.retry(func() (bool, error) {
+		var retryable bool
+		var err error
+		data, retryable, err = h.fetch(info, start, end)
+		return retryable, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if h.blocks != nil {
+		h.blocks.Add(key, data, int64(len(data)))
+	}
+	return data, nil
+}
+
+// fetch fetches the bytes from start to end of the version of the remote file with a range request,
+// conditioned on its ETag, so the bytes of another version are not mixed with the bytes of the version.
+// It reports whether the request failed with a network error or a transient status, so it may be retried.
+func (h *HTTP) fetch(info Info, start int64, end int64) ([]byte, bool, error) {
+	request, err := http.NewRequest(http.MethodGet, h.url, nil)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to create request")
+	}
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	etag := info.etag()
+	// Weak ETags never match the If-Match condition, so they are only compared with the ETag of the response
+	if etag != "" && !strings.HasPrefix(etag, "W/") {
+		request.Header.Set("If-Match", etag)
+	}
+	response, err := h.opts.Client.Do(request)
+	if err != nil {
+		return nil, true, errors.Wrap(err, "failed to request remote file")
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	switch response.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusPreconditionFailed, http.StatusRequestedRangeNotSatisfiable:
+		return nil, false, ErrRemoteFileChanged
+	case http.StatusOK:
+		return nil, false, errors.New("remote server does not support range requests")
+	default:
+		return nil, transient(response.StatusCode), statusError(response)
+	}
+	if size, ok := contentRangeSize(response.Header.Get("Content-Range")); !ok || size != info.Size ||
+		response.Header.Get("ETag") != etag {
+		return nil, false, ErrRemoteFileChanged
+	}
+	data := make([]byte, end-start)
+	if _, err := io.ReadFull(response.Body, data); err != nil {
+		return nil, true, errors.Wrap(err, "failed to read remote file")
+	}
+	return data, false, nil
+}
+
+// retry calls fn until it succeeds or fails with an error that is not retryable, retrying up to the number of retries
+// with an exponential backoff.
+func (h *HTTP) retry(fn func() (bool, error)) error {
+	for attempt := 0; ; attempt++ {
+		retryable, err := fn()
+		if err == nil || !retryable || attempt >= h.opts.Retries {
+			return err
+		}
+		time.Sleep(h.opts.RetryBackoff << attempt)
+	}
+}
+
+// transient reports whether a request failing with the status may succeed if retried.
+func transient(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// statusError describes the unexpected status of the response.
+func statusError(response *http.Response) error {
+	return errors.Errorf("unexpected status of remote file: %s", response.Status)
+}
+
+// httpInfo describes the version of a remote file, identified by its ETag,
+// or by its size and modification time if the server has no ETags.
+func httpInfo(size int64, header http.Header) Info {
+	modTime, _ := http.ParseTime(header.Get("Last-Modified"))
+	tag := "etag:" + header.Get("ETag")
+	if header.Get("ETag") == "" {
+		tag = "size:" + strconv.FormatInt(size, 10) + ":" + header.Get("Last-Modified")
+	}
+	return Info{Size: size, ModTime: modTime, tag: tag}
+}
+
+// etag returns the ETag identifying the version of a remote file, or an empty string if the server has no ETags.
+func (i Info) etag() string {
+	if etag, ok := strings.CutPrefix(i.tag, "etag:"); ok {
+		return etag
+	}
+	return ""
+}
+
+// contentRangeSize parses the complete length of the file from the Content-Range header of a partial response.
+func contentRangeSize(contentRange string) (int64, bool) {
+	_, size, ok := strings.Cut(contentRange, "/")
+	if !ok || !strings.HasPrefix(contentRange, "bytes ") {
+		return 0, false
+	}
+	parsed, err := strconv.ParseInt(size, 10, 64)
+	return parsed, err == nil
+}
+
+// httpFile is an opened version of a remote file.
+type httpFile struct {
+	src  *HTTP
+	info Info
+}
+
+// ReadAt reads the version of the remote file from the offset, block by block.
+func (f httpFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+	end := min(off+int64(len(p)), f.info.Size)
+	n := 0
+	for position := off; position < end; {
+		index := position / f.src.opts.BlockSize
+		data, err := f.src.block(f.info, index)
+		if err != nil {
+			return n, err
+		}
+		copied := copy(p[n:end-off], data[position-index*f.src.opts.BlockSize:])
+		n += copied
+		position += int64(copied)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Stat returns the info of the opened version.
+func (f httpFile) Stat() (Info, error) {
+	return f.info, nil
+}
+
+// Close does nothing, as the remote file is requested for each block.
+func (f httpFile) Close() error {
+	return nil
+}
@@ -0,0 +1,231 @@
+//go:build unit
+
+package source_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/renanrv/line-server/pkg/source"
+	"github.com/stretchr/testify/assert"
+)
+
+// remoteFile serves a file with range requests and ETags, like a static file server
+type remoteFile struct {
+	mu      sync.Mutex
+	content string
+	etag    string
+	// failures is the number of the next requests failing with a transient status
+	failures int
+	// ranges counts the range requests
+	ranges int
+	// noRanges serves the whole file to the range requests
+	noRanges bool
+}
+
+func (f *remoteFile) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if r.Header.Get("Range") != "" {
+		f.ranges++
+		if f.noRanges {
+			r.Header.Del("Range")
+		}
+	}
+	if f.etag != "" {
+		w.Header().Set("ETag", f.etag)
+	}
+	http.ServeContent(w, r, "lines.txt", time.Unix(1700000000, 0), strings.NewReader(f.content))
+}
+
+// replace replaces the content of the file, with a new ETag
+func (f *remoteFile) replace(content string, etag string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.content = content
+	f.etag = etag
+}
+
+func TestHTTP(t *testing.T) {
+	content := "line1\nline2\nline3\nline4\n"
+	tests := []struct {
+		name           string
+		etag           string
+		opts           source.HTTPOptions
+		expectedRanges int
+	}{
+		{
+			name:           "Blocks cached",
+			etag:           `"v1"`,
+			opts:           source.HTTPOptions{BlockSize: 8, CacheSize: 1024},
+			expectedRanges: 3,
+		},
+		{
+			name:           "Blocks not cached",
+			etag:           `"v1"`,
+			opts:           source.HTTPOptions{BlockSize: 8},
+			expectedRanges: 7,
+		},
+		{
+			name:           "Weak ETag",
+			etag:           `W/"v1"`,
+			opts:           source.HTTPOptions{BlockSize: 8, CacheSize: 1024},
+			expectedRanges: 3,
+		},
+		{
+			name:           "No ETag",
+			opts:           source.HTTPOptions{BlockSize: 1024, CacheSize: 1024},
+			expectedRanges: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote := &remoteFile{content: content, etag: tt.etag}
+			server := httptest.NewServer(remote)
+			defer server.Close()
+			src, err := source.NewHTTP(server.URL+"/lines.txt", tt.opts)
+			assert.Nil(t, err)
+			assert.Equal(t, server.URL+"/lines.txt", src.Name())
+
+			info, err := src.Stat()
+			assert.Nil(t, err)
+			assert.Equal(t, int64(len(content)), info.Size)
+			assert.Equal(t, time.Unix(1700000000, 0).UTC(), info.ModTime)
+			opened, err := src.Open()
+			assert.Nil(t, err)
+
+			// The whole file is read twice, across the blocks, and then past its end
+			for range 2 {
+				read, err := io.ReadAll(io.NewSectionReader(opened, 0, 1024))
+				assert.Nil(t, err)
+				assert.Equal(t, content, string(read))
+			}
+			buffer := make([]byte, 10)
+			n, err := opened.ReadAt(buffer, int64(len(content))-3)
+			assert.Equal(t, io.EOF, err)
+			assert.Equal(t, "e4\n", string(buffer[:n]))
+			assert.Equal(t, tt.expectedRanges, remote.ranges)
+			assert.Nil(t, opened.Close())
+		})
+	}
+}
+
+func TestHTTP_Changed(t *testing.T) {
+	remote := &remoteFile{content: "line1\nline2\n", etag: `"v1"`}
+	server := httptest.NewServer(remote)
+	defer server.Close()
+	src, err := source.NewHTTP(server.URL, source.HTTPOptions{BlockSize: 6, CacheSize: 1024})
+	assert.Nil(t, err)
+	opened, err := src.Open()
+	assert.Nil(t, err)
+	info, err := opened.Stat()
+	assert.Nil(t, err)
+	buffer := make([]byte, 6)
+	_, err = opened.ReadAt(buffer, 0)
+	assert.Nil(t, err)
+
+	// The remote file is replaced, so it is another file, whose blocks are not mixed with the opened version
+	remote.replace("new line1\nnew line2\n", `"v2"`)
+	replaced, err := src.Stat()
+	assert.Nil(t, err)
+	assert.False(t, info.SameFile(replaced))
+	_, err = opened.ReadAt(buffer, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "line1\n", string(buffer))
+	_, err = opened.ReadAt(buffer, 6)
+	assert.Equal(t, source.ErrRemoteFileChanged, err)
+
+	reopened, err := src.Open()
+	assert.Nil(t, err)
+	read, err := io.ReadAll(io.NewSectionReader(reopened, 0, 1024))
+	assert.Nil(t, err)
+	assert.Equal(t, "new line1\nnew line2\n", string(read))
+}
+
+func TestHTTP_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		remote        *remoteFile
+		opts          source.HTTPOptions
+		expectedError string
+	}{
+		{
+			name:   "Transient failures retried",
+			remote: &remoteFile{content: "line1\n", failures: 2},
+			opts:   source.HTTPOptions{Retries: 2, RetryBackoff: time.Millisecond},
+		},
+		{
+			name:          "Transient failures exceeding the retries",
+			remote:        &remoteFile{content: "line1\n", failures: 2},
+			opts:          source.HTTPOptions{Retries: 1, RetryBackoff: time.Millisecond},
+			expectedError: "unexpected status of remote file: 503 Service Unavailable",
+		},
+		{
+			name:          "Range requests not supported",
+			remote:        &remoteFile{content: "line1\n", noRanges: true},
+			expectedError: "remote server does not support range requests",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.remote)
+			defer server.Close()
+			src, err := source.NewHTTP(server.URL, tt.opts)
+			assert.Nil(t, err)
+			var read bytes.Buffer
+			opened, err := src.Open()
+			if err == nil {
+				_, err = io.Copy(&read, io.NewSectionReader(opened, 0, 1024))
+			}
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.remote.content, read.String())
+		})
+	}
+}
+
+func TestNewHTTP(t *testing.T) {
+	tests := []struct {
+		name          string
+		url           string
+		opts          source.HTTPOptions
+		expectedError string
+	}{
+		{
+			name:          "Local path",
+			url:           "/data/lines.txt",
+			expectedError: `invalid URL "/data/lines.txt", an http or https URL is required`,
+		},
+		{
+			name:          "Other scheme",
+			url:           "ftp://files.example.com/lines.txt",
+			expectedError: `invalid URL "ftp://files.example.com/lines.txt", an http or https URL is required`,
+		},
+		{
+			name:          "Negative retries",
+			url:           "https://files.example.com/lines.txt",
+			opts:          source.HTTPOptions{Retries: -1},
+			expectedError: "block size, cache size, retries and retry backoff cannot be negative",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := source.NewHTTP(tt.url, tt.opts)
+			assert.EqualError(t, err, tt.expectedError)
+		})
+	}
+}
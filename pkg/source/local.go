@@ -0,0 +1,58 @@
+package source
+
+import (
+	"os"
+)
+
+// Local is a line source of a file of the local file system, which is served from its path,
+// so the file replacing it is served once the line source is opened again.
+type Local struct {
+	path string
+}
+
+// NewLocal creates a line source of the file of the local file system.
+func NewLocal(path string) *Local {
+	return &Local{path: path}
+}
+
+// Name returns the path of the file.
+func (l *Local) Name() string {
+	return l.path
+}
+
+// Stat returns the info of the file the path currently names.
+func (l *Local) Stat() (Info, error) {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return Info{}, err
+	}
+	return localInfo(info), nil
+}
+
+// Open opens the file the path currently names.
+func (l *Local) Open() (File, error) {
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	return localFile{File: file}, nil
+}
+
+// localFile is an opened local file, whose positional reads are served by pread.
+type localFile struct {
+	*os.File
+}
+
+// Stat returns the info of the opened file, which may not be the one the path names anymore.
+func (f localFile) Stat() (Info, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return Info{}, err
+	}
+	return localInfo(info), nil
+}
+
+// localInfo describes a local file, identified by its inode.
+func localInfo(info os.FileInfo) Info {
+	return Info{Size: info.Size(), ModTime: info.ModTime(), file: info}
+}
@@ -0,0 +1,121 @@
+package source
+
+import (
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Memory is a line source of an in-memory buffer, such as the files of tests.
+// Its content can be replaced, like a file replaced by another, or appended to, like a growing file.
+// As with local files, the opened files keep reading the content they were opened with once it is replaced,
+// and read the lines appended to it.
+type Memory struct {
+	name string
+
+	mu       sync.Mutex
+	current  *memoryContent
+	replaced int
+}
+
+// memoryContent is a version of the content of a buffer, shared by the files opening it.
+type memoryContent struct {
+	mu      sync.RWMutex
+	data    []byte
+	modTime time.Time
+	tag     string
+}
+
+// NewMemory creates a line source of the content, named after the name in logs.
+func NewMemory(name string, content []byte) *Memory {
+	m := &Memory{name: name}
+	m.current = m.newContent(content)
+	return m
+}
+
+// Name returns the name of the buffer.
+func (m *Memory) Name() string {
+	return m.name
+}
+
+// Stat returns the info of the current content.
+func (m *Memory) Stat() (Info, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current.info(), nil
+}
+
+// Open opens the current content.
+func (m *Memory) Open() (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return memoryFile{content: m.current}, nil
+}
+
+// Replace replaces the content, as if the file was replaced by another one.
+func (m *Memory) Replace(content []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.replaced++
+	m.current = m.newContent(content)
+}
+
+// Append appends to the content, as if the file grew.
+func (m *Memory) Append(content []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.current.mu.Lock()
+	defer m.current.mu.Unlock()
+	m.current.data = append(m.current.data, content...)
+	m.current.modTime = time.Now()
+}
+
+// newContent creates a version of the content, identified by the number of times the content was replaced.
+// The content is copied, so the caller may modify it.
+func (m *Memory) newContent(content []byte) *memoryContent {
+	return &memoryContent{
+		data:    append([]byte(nil), content...),
+		modTime: time.Now(),
+		tag:     strconv.Itoa(m.replaced),
+	}
+}
+
+// info describes the version of the content.
+func (c *memoryContent) info() Info {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return Info{Size: int64(len(c.data)), ModTime: c.modTime, tag: c.tag}
+}
+
+// memoryFile is an opened version of the content of a buffer.
+type memoryFile struct {
+	content *memoryContent
+}
+
+// ReadAt reads the version of the content from the offset.
+func (f memoryFile) ReadAt(p []byte, off int64) (int, error) {
+	f.content.mu.RLock()
+	defer f.content.mu.RUnlock()
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+	if off >= int64(len(f.content.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.content.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Stat returns the info of the opened version, which grows as the content is appended to.
+func (f memoryFile) Stat() (Info, error) {
+	return f.content.info(), nil
+}
+
+// Close does nothing, as the content is released once it is not referenced anymore.
+func (f memoryFile) Close() error {
+	return nil
+}
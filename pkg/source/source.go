@@ -0,0 +1,53 @@
+package source
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// errNegativeOffset is returned by the positional reads of a negative offset.
+var errNegativeOffset = errors.New("negative offset")
+
+// LineSource is the file the lines are served from, such as a local file, an in-memory buffer,
+// a file of an io/fs.FS or a remote file.
+// The file may be replaced or modified while it is served, so each opened File is a version of the file.
+type LineSource interface {
+	// Name identifies the file in logs, such as the path of a local file.
+	Name() string
+	// Stat returns the info of the current version of the file.
+	Stat() (Info, error)
+	// Open opens the current version of the file for positional reads.
+	Open() (File, error)
+}
+
+// File is an opened version of the file of a line source, read with positional reads,
+// so it has no read position shared by its readers and can be read concurrently.
+type File interface {
+	io.ReaderAt
+	io.Closer
+	// Stat returns the info of the opened version of the file.
+	Stat() (Info, error)
+}
+
+// Info describes a version of the file of a line source.
+type Info struct {
+	Size    int64
+	ModTime time.Time
+
+	// file identifies a local file by its inode, and tag the files of the other line sources,
+	// so a replaced file is told apart from the file it replaces, regardless of its size and modification time
+	file os.FileInfo
+	tag  string
+}
+
+// SameFile reports whether both infos describe the same file, which may have been modified or grown since,
+// rather than another file replacing it.
+func (i Info) SameFile(other Info) bool {
+	if i.file != nil || other.file != nil {
+		return os.SameFile(i.file, other.file)
+	}
+	return i.tag == other.tag
+}
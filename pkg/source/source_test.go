@@ -0,0 +1,205 @@
+//go:build unit
+
+package source_test
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/source"
+	"github.com/renanrv/line-server/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// seekingFS serves the files of the file system without positional reads, so they are read by seeking them
+type seekingFS struct {
+	fstest.MapFS
+}
+
+func (f seekingFS) Open(name string) (fs.File, error) {
+	file, err := f.MapFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return seekingFile{readOnlyFile{file: file}}, nil
+}
+
+type seekingFile struct {
+	readOnlyFile
+}
+
+func (f seekingFile) Seek(offset int64, whence int) (int64, error) {
+	return f.file.(io.Seeker).Seek(offset, whence)
+}
+
+func TestLineSource(t *testing.T) {
+	content := "line1\nline2\nline3\n"
+	file := utils.CreateTempFile(t, content)
+	fsys := fstest.MapFS{"data/lines.txt": &fstest.MapFile{Data: []byte(content)}}
+	tests := []struct {
+		name         string
+		src          source.LineSource
+		expectedName string
+	}{
+		{
+			name:         "Local file",
+			src:          source.NewLocal(file.Name()),
+			expectedName: file.Name(),
+		},
+		{
+			name:         "Memory buffer",
+			src:          source.NewMemory("lines", []byte(content)),
+			expectedName: "lines",
+		},
+		{
+			name:         "File system file",
+			src:          source.NewFS(fsys, "data/lines.txt"),
+			expectedName: "data/lines.txt",
+		},
+		{
+			name:         "File system file without positional reads",
+			src:          source.NewFS(seekingFS{MapFS: fsys}, "data/lines.txt"),
+			expectedName: "data/lines.txt",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedName, tt.src.Name())
+			info, err := tt.src.Stat()
+			assert.Nil(t, err)
+			assert.Equal(t, int64(len(content)), info.Size)
+
+			opened, err := tt.src.Open()
+			assert.Nil(t, err)
+			openedInfo, err := opened.Stat()
+			assert.Nil(t, err)
+			assert.True(t, openedInfo.SameFile(info))
+
+			// Positional reads do not depend on the previous reads
+			buffer := make([]byte, 5)
+			n, err := opened.ReadAt(buffer, 6)
+			assert.Nil(t, err)
+			assert.Equal(t, "line2", string(buffer[:n]))
+			n, err = opened.ReadAt(buffer, 0)
+			assert.Nil(t, err)
+			assert.Equal(t, "line1", string(buffer[:n]))
+			// Reads past the end of the file are short
+			n, err = opened.ReadAt(buffer, int64(len(content))-3)
+			assert.Equal(t, io.EOF, err)
+			assert.Equal(t, "e3\n", string(buffer[:n]))
+			assert.Nil(t, opened.Close())
+		})
+	}
+}
+
+func TestLocal_Replaced(t *testing.T) {
+	file := utils.CreateTempFile(t, "line1\n")
+	src := source.NewLocal(file.Name())
+	opened, err := src.Open()
+	assert.Nil(t, err)
+	defer func() {
+		assert.Nil(t, opened.Close())
+	}()
+	info, err := opened.Stat()
+	assert.Nil(t, err)
+
+	// The opened file keeps reading the replaced file
+	newFilePath := filepath.Join(filepath.Dir(file.Name()), "new-"+filepath.Base(file.Name()))
+	assert.Nil(t, os.WriteFile(newFilePath, []byte("new line1\n"), 0o600))
+	assert.Nil(t, os.Rename(newFilePath, file.Name()))
+	replaced, err := src.Stat()
+	assert.Nil(t, err)
+	assert.False(t, info.SameFile(replaced))
+	content, err := io.ReadAll(io.NewSectionReader(opened, 0, 1024))
+	assert.Nil(t, err)
+	assert.Equal(t, "line1\n", string(content))
+}
+
+func TestMemory(t *testing.T) {
+	src := source.NewMemory("lines", []byte("line1\n"))
+	opened, err := src.Open()
+	assert.Nil(t, err)
+	info, err := src.Stat()
+	assert.Nil(t, err)
+
+	// The appended content is read by the opened files, which are still the same file
+	src.Append([]byte("line2\n"))
+	appended, err := src.Stat()
+	assert.Nil(t, err)
+	assert.True(t, info.SameFile(appended))
+	assert.Equal(t, int64(12), appended.Size)
+	content, err := io.ReadAll(io.NewSectionReader(opened, 0, 1024))
+	assert.Nil(t, err)
+	assert.Equal(t, "line1\nline2\n", string(content))
+
+	// The replaced content is another file, so the opened files keep reading their content
+	src.Replace([]byte("new line1\n"))
+	replaced, err := src.Stat()
+	assert.Nil(t, err)
+	assert.False(t, info.SameFile(replaced))
+	content, err = io.ReadAll(io.NewSectionReader(opened, 0, 1024))
+	assert.Nil(t, err)
+	assert.Equal(t, "line1\nline2\n", string(content))
+	reopened, err := src.Open()
+	assert.Nil(t, err)
+	content, err = io.ReadAll(io.NewSectionReader(reopened, 0, 1024))
+	assert.Nil(t, err)
+	assert.Equal(t, "new line1\n", string(content))
+}
+
+func TestFS_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		fsys          fs.FS
+		expectedError error
+	}{
+		{
+			name:          "Missing file",
+			fsys:          fstest.MapFS{},
+			expectedError: errors.New("open lines.txt: file does not exist"),
+		},
+		{
+			name:          "File without positional reads nor seeking",
+			fsys:          readOnlyFS{},
+			expectedError: errors.New(`file "lines.txt" does not support positional reads`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := source.NewFS(tt.fsys, "lines.txt").Open()
+			assert.Equal(t, tt.expectedError.Error(), err.Error())
+		})
+	}
+}
+
+// readOnlyFS serves files that can only be read sequentially
+type readOnlyFS struct{}
+
+func (readOnlyFS) Open(name string) (fs.File, error) {
+	file, err := fstest.MapFS{name: &fstest.MapFile{Data: []byte("line1\n")}}.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return readOnlyFile{file: file}, nil
+}
+
+type readOnlyFile struct {
+	file fs.File
+}
+
+func (f readOnlyFile) Stat() (fs.FileInfo, error) {
+	return f.file.Stat()
+}
+
+func (f readOnlyFile) Read(p []byte) (int, error) {
+	return f.file.Read(p)
+}
+
+func (f readOnlyFile) Close() error {
+	return f.file.Close()
+}
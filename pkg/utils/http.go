@@ -23,6 +23,12 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// Unwrap returns the wrapped response writer, so http.ResponseController can reach its optional interfaces,
+// such as http.Flusher for streamed responses.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // WrapResponseWriter wraps the http response wrapper if not wrapped
 func WrapResponseWriter(w http.ResponseWriter) (sw *responseWriter) {
 	var ok bool
@@ -74,3 +74,16 @@ func TestResponseWriter(t *testing.T) {
 		})
 	}
 }
+
+func TestWrapResponseWriter_Flush(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	wrappedWriter := utils.WrapResponseWriter(recorder)
+
+	// The wrapped response writer is reachable, so streamed responses can be flushed
+	if err := http.NewResponseController(wrappedWriter).Flush(); err != nil {
+		t.Errorf("unexpected error while flushing: %v", err)
+	}
+	if !recorder.Flushed {
+		t.Errorf("expected response to be flushed")
+	}
+}
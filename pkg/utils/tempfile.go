@@ -7,7 +7,7 @@ import (
 
 // CreateTempFile creates a temporary file for tests with the given content and returns the file handle.
 // It also schedules the file for deletion after the test completes.
-func CreateTempFile(t *testing.T, content string) *os.File {
+func CreateTempFile(t testing.TB, content string) *os.File {
 	// Marks test as a helper for better test failure logs
 	t.Helper()
 
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/metrics"
+	"github.com/renanrv/line-server/services/server"
+)
+
+// DefaultMaxBatchSize is the maximum number of line indices of a batch request, if not configured.
+const DefaultMaxBatchSize = 1000
+
+// PostV0LinesBatch returns the lines for the given line indices, in the order requested.
+// The line indices are sorted, so the file is opened once and read in a single forward pass.
+// Lines beyond the end of the file or exceeding the maximum line size are reported with their status.
+func (h Handler) PostV0LinesBatch(ctx context.Context, request server.PostV0LinesBatchRequestObject,
+) (server.PostV0LinesBatchResponseObject, error) {
+	if request.Body == nil || len(request.Body.LineIndices) == 0 || len(request.Body.LineIndices) > h.MaxBatchSize {
+		return server.PostV0LinesBatch400TextResponse(
+			fmt.Sprintf("the number of line indices must be between 1 and %d", h.MaxBatchSize)), nil
+	}
+	lines, err := h.readLines(ctx, request.Body.LineIndices)
+	if err != nil {
+		return nil, err
+	}
+	return server.PostV0LinesBatch200JSONResponse{
+		BatchLinesResponseJSONResponse: server.BatchLinesResponseJSONResponse{
+			Lines: lines,
+		},
+	}, nil
+}
+
+// readLines method reads the file once and returns the lines according the provided line indices.
+func (h Handler) readLines(ctx context.Context, lineIndices []int) ([]server.BatchLine, error) {
+	version, err := h.Dataset.Acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer version.Release()
+	reader, err := h.newLineReader(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.close()
+
+	// Lines are ordered by their offsets in the file, so sorting the line indices keeps the reader moving forward
+	order := make([]int, len(lineIndices))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return lineIndices[order[a]] < lineIndices[order[b]]
+	})
+	lines := make([]server.BatchLine, len(lineIndices))
+	served := 0
+	for position, i := range order {
+		lineIndex := lineIndices[i]
+		// Repeated line indices are read once
+		if position > 0 && lineIndices[order[position-1]] == lineIndex {
+			lines[i] = lines[order[position-1]]
+			if lines[i].Status == server.Found {
+				served++
+			}
+			continue
+		}
+		lines[i] = server.BatchLine{LineIndex: lineIndex}
+		text, ok := h.lines.get(version.ID, lineIndex)
+		var err error
+		if !ok {
+			text, err = reader.readLine(lineIndex)
+		}
+		switch {
+		case err == nil:
+			if !ok && reader.cacheable(lineIndex) {
+				h.lines.add(version.ID, lineIndex, text)
+			}
+			lines[i].Status = server.Found
+			lines[i].Text = &text
+			served++
+		case err == io.EOF:
+			lines[i].Status = server.OutOfRange
+		case errors.Is(err, ErrLineTooLong):
+			lines[i].Status = server.LineTooLong
+		default:
+			return nil, err
+		}
+	}
+	metrics.LinesServed.WithLabelValues("batch").Add(float64(served))
+	return lines, nil
+}
@@ -0,0 +1,119 @@
+//go:build unit
+
+package handler_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/utils"
+	"github.com/renanrv/line-server/services/handler"
+	"github.com/renanrv/line-server/services/server"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_PostV0LinesBatch(t *testing.T) {
+	longLine := strings.Repeat("a", 2048)
+	content := "line0\nline1\n" + longLine + "\nline3\nline4\nline5\nline6\n"
+	logger := zerolog.New(nil)
+	file := utils.CreateTempFile(t, content)
+	sparseIndex, err := fileprocessing.GenerateIndex(&logger, file.Name(), 3, fileprocessing.IndexOptions{})
+	assert.Nil(t, err)
+	denseIndex, err := fileprocessing.GenerateIndex(&logger, file.Name(), len(content), fileprocessing.IndexOptions{})
+	assert.Nil(t, err)
+
+	found := func(lineIndex int, text string) server.BatchLine {
+		return server.BatchLine{LineIndex: lineIndex, Status: server.Found, Text: &text}
+	}
+	tests := []struct {
+		name          string
+		lineIndices   []int
+		expectedLines []server.BatchLine
+	}{
+		{
+			name:          "Lines in order",
+			lineIndices:   []int{0, 1, 3},
+			expectedLines: []server.BatchLine{found(0, "line0"), found(1, "line1"), found(3, "line3")},
+		},
+		{
+			name:          "Scattered lines are returned in the order requested",
+			lineIndices:   []int{6, 0, 4, 1},
+			expectedLines: []server.BatchLine{found(6, "line6"), found(0, "line0"), found(4, "line4"), found(1, "line1")},
+		},
+		{
+			name:          "Repeated lines",
+			lineIndices:   []int{5, 3, 5},
+			expectedLines: []server.BatchLine{found(5, "line5"), found(3, "line3"), found(5, "line5")},
+		},
+		{
+			name:        "Lines beyond the end of the file",
+			lineIndices: []int{7, 1, -1, 100},
+			expectedLines: []server.BatchLine{
+				{LineIndex: 7, Status: server.OutOfRange},
+				found(1, "line1"),
+				{LineIndex: -1, Status: server.OutOfRange},
+				{LineIndex: 100, Status: server.OutOfRange},
+			},
+		},
+		{
+			name:        "Line exceeding the max line size",
+			lineIndices: []int{3, 2, 1},
+			expectedLines: []server.BatchLine{
+				found(3, "line3"),
+				{LineIndex: 2, Status: server.LineTooLong},
+				found(1, "line1"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		for _, index := range []struct {
+			name             string
+			fileIndexSummary *fileprocessing.FileIndexSummary
+		}{
+			{name: "without file index summary"},
+			{name: "with sparse file index summary", fileIndexSummary: sparseIndex},
+			{name: "with dense file index summary", fileIndexSummary: denseIndex},
+		} {
+			t.Run(tt.name+" "+index.name, func(t *testing.T) {
+				h, err := handler.New(&logger, file.Name(), fileprocessing.NewIndexHolder(index.fileIndexSummary),
+					handler.Options{MaxLineSize: 1024})
+				assert.Nil(t, err)
+				response, err := h.PostV0LinesBatch(context.Background(), server.PostV0LinesBatchRequestObject{
+					Body: &server.BatchLinesRequest{LineIndices: tt.lineIndices},
+				})
+				assert.Nil(t, err)
+				assert.Equal(t, server.PostV0LinesBatch200JSONResponse{
+					BatchLinesResponseJSONResponse: server.BatchLinesResponseJSONResponse{Lines: tt.expectedLines},
+				}, response)
+			})
+		}
+	}
+}
+
+func TestHandler_PostV0LinesBatch_InvalidRequest(t *testing.T) {
+	logger := zerolog.New(nil)
+	file := utils.CreateTempFile(t, "line0\nline1\n")
+	h, err := handler.New(&logger, file.Name(), nil, handler.Options{MaxBatchSize: 2})
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name string
+		body *server.BatchLinesRequest
+	}{
+		{name: "Missing body"},
+		{name: "No line indices", body: &server.BatchLinesRequest{}},
+		{name: "Too many line indices", body: &server.BatchLinesRequest{LineIndices: []int{0, 1, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := h.PostV0LinesBatch(context.Background(),
+				server.PostV0LinesBatchRequestObject{Body: tt.body})
+			assert.Nil(t, err)
+			assert.Equal(t, server.PostV0LinesBatch400TextResponse(
+				"the number of line indices must be between 1 and 2"), response)
+		})
+	}
+}
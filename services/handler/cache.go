@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"io"
+
+	"github.com/renanrv/line-server/pkg/cache"
+	"github.com/renanrv/line-server/pkg/metrics"
+)
+
+// blockSize is the size in bytes of the blocks of the file held by the block cache, aligned on their size.
+const blockSize = readerBufferSize
+
+// cacheEntryOverhead approximates the memory in bytes used by a cache entry besides its value,
+// such as its list element and its map slot, so the size of the cache accounts for many small lines.
+const cacheEntryOverhead = 128
+
+// lineCache holds the most recently served lines by line index, so hot lines are served without reading the file.
+// A nil line cache is disabled.
+type lineCache struct {
+	lines *cache.LRU[lineKey, string]
+}
+
+// lineKey identifies a line of a version of the file, so the lines of the previous versions are no longer served
+// once the file is reloaded, and they are evicted as the least recently used.
+type lineKey struct {
+	version   uint64
+	lineIndex int
+}
+
+// newLineCache creates a line cache of maxBytes, or a disabled one if maxBytes is 0.
+func newLineCache(maxBytes int64) *lineCache {
+	if maxBytes == 0 {
+		return nil
+	}
+	return &lineCache{lines: cache.NewLRU[lineKey, string](maxBytes)}
+}
+
+// get returns the cached line of the line index of the version, and whether it was found.
+func (c *lineCache) get(version uint64, lineIndex int) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	text, ok := c.lines.Get(lineKey{version: version, lineIndex: lineIndex})
+	recordLookup(metrics.CacheLines, ok)
+	return text, ok
+}
+
+// add caches the line of the line index of the version.
+func (c *lineCache) add(version uint64, lineIndex int, text string) {
+	if c == nil {
+		return
+	}
+	key := lineKey{version: version, lineIndex: lineIndex}
+	evicted := c.lines.Add(key, text, int64(len(text))+cacheEntryOverhead)
+	recordAdd(metrics.CacheLines, evicted, c.lines.Size())
+}
+
+// blockCache holds the most recently read blocks of the file by block number, so the scans from the same
+// checkpoints, such as the lines around a hot line or a range read again, are served without reading the file.
+// A nil block cache is disabled.
+type blockCache struct {
+	blocks *cache.LRU[blockKey, []byte]
+}
+
+// blockKey identifies a block of a version of the file.
+type blockKey struct {
+	version uint64
+	number  int64
+}
+
+// newBlockCache creates a block cache of maxBytes, or a disabled one if maxBytes is 0.
+func newBlockCache(maxBytes int64) *blockCache {
+	if maxBytes == 0 {
+		return nil
+	}
+	return &blockCache{blocks: cache.NewLRU[blockKey, []byte](maxBytes)}
+}
+
+// readerAt returns a reader of the version of the file reading its blocks through the cache,
+// or the file itself if the cache is disabled.
+func (c *blockCache) readerAt(version uint64, file io.ReaderAt) io.ReaderAt {
+	if c == nil {
+		return file
+	}
+	return cachedFile{file: file, version: version, cache: c}
+}
+
+// cachedFile reads a version of a file through the block cache.
+type cachedFile struct {
+	file    io.ReaderAt
+	version uint64
+	cache   *blockCache
+}
+
+// ReadAt reads the blocks overlapping the requested bytes, from the cache or otherwise from the file.
+func (f cachedFile) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		position := off + int64(n)
+		block, err := f.block(position / blockSize)
+		if err != nil {
+			return n, err
+		}
+		start := position % blockSize
+		if start >= int64(len(block)) {
+			return n, io.EOF
+		}
+		n += copy(p[n:], block[start:])
+		// Only the last block of the file is shorter than the block size
+		if len(block) < blockSize && n < len(p) {
+			return n, io.EOF
+		}
+	}
+	return n, nil
+}
+
+// block returns the block of the block number, reading and caching it if it is not cached.
+func (f cachedFile) block(number int64) ([]byte, error) {
+	key := blockKey{version: f.version, number: number}
+	if block, ok := f.cache.blocks.Get(key); ok {
+		recordLookup(metrics.CacheBlocks, true)
+		return block, nil
+	}
+	recordLookup(metrics.CacheBlocks, false)
+	block := make([]byte, blockSize)
+	n, err := f.file.ReadAt(block, number*blockSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	block = block[:n]
+	// The last block of the file grows as lines are appended, so only full blocks are cached
+	if n == blockSize {
+		evicted := f.cache.blocks.Add(key, block, int64(cap(block))+cacheEntryOverhead)
+		recordAdd(metrics.CacheBlocks, evicted, f.cache.blocks.Size())
+	}
+	return block, nil
+}
+
+// recordLookup records the lookup of the cache as a hit or a miss.
+func recordLookup(name string, hit bool) {
+	result := metrics.CacheMiss
+	if hit {
+		result = metrics.CacheHit
+	}
+	metrics.CacheRequests.WithLabelValues(name, result).Inc()
+}
+
+// recordAdd records the entries evicted by adding an entry to the cache, and the resulting size of the cache.
+func recordAdd(name string, evicted int, size int64) {
+	metrics.CacheEvictions.WithLabelValues(name).Add(float64(evicted))
+	metrics.CacheSize.WithLabelValues(name).Set(float64(size))
+}
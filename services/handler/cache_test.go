@@ -0,0 +1,151 @@
+//go:build unit
+
+package handler_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/metrics"
+	"github.com/renanrv/line-server/services/handler"
+	"github.com/renanrv/line-server/services/server"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_LineCache(t *testing.T) {
+	logger := zerolog.New(nil)
+	file := createLinesFile(t, 1000)
+	fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), 10, fileprocessing.IndexOptions{})
+	assert.Nil(t, err)
+	hits := metrics.CacheRequests.WithLabelValues(metrics.CacheLines, metrics.CacheHit)
+	misses := metrics.CacheRequests.WithLabelValues(metrics.CacheLines, metrics.CacheMiss)
+	evictions := metrics.CacheEvictions.WithLabelValues(metrics.CacheLines)
+
+	t.Run("Hot lines", func(t *testing.T) {
+		h, err := handler.New(&logger, file.Name(), fileprocessing.NewIndexHolder(fileIndexSummary),
+			handler.Options{LineCacheSize: 1024 * 1024})
+		assert.Nil(t, err)
+		hitsBefore, missesBefore := testutil.ToFloat64(hits), testutil.ToFloat64(misses)
+
+		_, err = h.GetV0LinesLineIndex(context.Background(), server.GetV0LinesLineIndexRequestObject{LineIndex: 500})
+		assert.Nil(t, err)
+		assert.Equal(t, missesBefore+1, testutil.ToFloat64(misses))
+
+		// The cached line is served without reading the file
+		diskBytesReadBefore := testutil.ToFloat64(metrics.DiskBytesRead)
+		response, err := h.GetV0LinesLineIndex(context.Background(),
+			server.GetV0LinesLineIndexRequestObject{LineIndex: 500})
+		assert.Nil(t, err)
+		assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+			LineResponseJSONResponse: server.LineResponseJSONResponse{Text: "line 500"},
+		}, response)
+		assert.Equal(t, hitsBefore+1, testutil.ToFloat64(hits))
+		assert.Equal(t, diskBytesReadBefore, testutil.ToFloat64(metrics.DiskBytesRead))
+
+		// Batches are served from and populate the same cache
+		body := server.PostV0LinesBatchJSONRequestBody{LineIndices: []int{501, 500}}
+		batchResponse, err := h.PostV0LinesBatch(context.Background(), server.PostV0LinesBatchRequestObject{Body: &body})
+		assert.Nil(t, err)
+		lines := batchResponse.(server.PostV0LinesBatch200JSONResponse).Lines
+		assert.Equal(t, "line 501", *lines[0].Text)
+		assert.Equal(t, "line 500", *lines[1].Text)
+		assert.Equal(t, hitsBefore+2, testutil.ToFloat64(hits))
+		assert.Equal(t, missesBefore+2, testutil.ToFloat64(misses))
+		_, err = h.GetV0LinesLineIndex(context.Background(), server.GetV0LinesLineIndexRequestObject{LineIndex: 501})
+		assert.Nil(t, err)
+		assert.Equal(t, hitsBefore+3, testutil.ToFloat64(hits))
+
+		// Lines out of range are not cached
+		_, err = h.GetV0LinesLineIndex(context.Background(), server.GetV0LinesLineIndexRequestObject{LineIndex: 1000})
+		assert.Nil(t, err)
+		_, err = h.GetV0LinesLineIndex(context.Background(), server.GetV0LinesLineIndexRequestObject{LineIndex: 1000})
+		assert.Nil(t, err)
+		assert.Equal(t, missesBefore+4, testutil.ToFloat64(misses))
+	})
+
+	t.Run("Least recently used lines are evicted", func(t *testing.T) {
+		// The cache only fits two lines, accounted with the overhead of their entries
+		h, err := handler.New(&logger, file.Name(), fileprocessing.NewIndexHolder(fileIndexSummary),
+			handler.Options{LineCacheSize: 300})
+		assert.Nil(t, err)
+		evictionsBefore, hitsBefore := testutil.ToFloat64(evictions), testutil.ToFloat64(hits)
+		for _, lineIndex := range []int{100, 200, 100, 300, 100, 200} {
+			response, err := h.GetV0LinesLineIndex(context.Background(),
+				server.GetV0LinesLineIndexRequestObject{LineIndex: lineIndex})
+			assert.Nil(t, err)
+			assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+				LineResponseJSONResponse: server.LineResponseJSONResponse{Text: fmt.Sprintf("line %d", lineIndex)},
+			}, response)
+		}
+		// Line 200 is evicted by line 300, which is evicted when line 200 is read again
+		assert.Equal(t, hitsBefore+2, testutil.ToFloat64(hits))
+		assert.Equal(t, evictionsBefore+2, testutil.ToFloat64(evictions))
+	})
+
+	t.Run("Negative cache size", func(t *testing.T) {
+		_, err := handler.New(&logger, file.Name(), nil, handler.Options{LineCacheSize: -1})
+		assert.EqualError(t, err, "cache size cannot be negative")
+		_, err = handler.New(&logger, file.Name(), nil, handler.Options{BlockCacheSize: -1})
+		assert.EqualError(t, err, "cache size cannot be negative")
+	})
+}
+
+func TestHandler_BlockCache(t *testing.T) {
+	logger := zerolog.New(nil)
+	// The file spans several blocks, so lines cross the boundaries of the blocks
+	numberOfLines := 50000
+	file := createLinesFile(t, numberOfLines)
+	fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), numberOfLines/100,
+		fileprocessing.IndexOptions{})
+	assert.Nil(t, err)
+	h, err := handler.New(&logger, file.Name(), fileprocessing.NewIndexHolder(fileIndexSummary),
+		handler.Options{BlockCacheSize: 64 * 1024 * 1024})
+	assert.Nil(t, err)
+	hits := metrics.CacheRequests.WithLabelValues(metrics.CacheBlocks, metrics.CacheHit)
+	misses := metrics.CacheRequests.WithLabelValues(metrics.CacheBlocks, metrics.CacheMiss)
+
+	// The lines are read from the full blocks of the file, as the last block may grow and it is not cached
+	readLines := func() {
+		for lineIndex := 0; lineIndex < 40000; lineIndex += 97 {
+			response, err := h.GetV0LinesLineIndex(context.Background(),
+				server.GetV0LinesLineIndexRequestObject{LineIndex: lineIndex})
+			assert.Nil(t, err)
+			assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+				LineResponseJSONResponse: server.LineResponseJSONResponse{Text: fmt.Sprintf("line %d", lineIndex)},
+			}, response)
+		}
+	}
+	missesBefore := testutil.ToFloat64(misses)
+	readLines()
+	assert.Greater(t, testutil.ToFloat64(misses), missesBefore)
+
+	// Scans from the same checkpoints are served from the cached blocks, without reading the file
+	hitsBefore, missesBefore := testutil.ToFloat64(hits), testutil.ToFloat64(misses)
+	diskBytesReadBefore := testutil.ToFloat64(metrics.DiskBytesRead)
+	readLines()
+	assert.Greater(t, testutil.ToFloat64(hits), hitsBefore)
+	assert.Equal(t, missesBefore, testutil.ToFloat64(misses))
+	assert.Equal(t, diskBytesReadBefore, testutil.ToFloat64(metrics.DiskBytesRead))
+
+	// The last block is read from the file every time
+	missesBefore = testutil.ToFloat64(misses)
+	for range 2 {
+		response, err := h.GetV0LinesLineIndex(context.Background(),
+			server.GetV0LinesLineIndexRequestObject{LineIndex: numberOfLines - 1})
+		assert.Nil(t, err)
+		assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+			LineResponseJSONResponse: server.LineResponseJSONResponse{Text: fmt.Sprintf("line %d", numberOfLines-1)},
+		}, response)
+	}
+	assert.Equal(t, missesBefore+2, testutil.ToFloat64(misses))
+
+	// Beyond the last block, lines are out of range
+	response, err := h.GetV0LinesLineIndex(context.Background(),
+		server.GetV0LinesLineIndexRequestObject{LineIndex: numberOfLines})
+	assert.Nil(t, err)
+	assert.Equal(t, server.GetV0LinesLineIndex413Response{}, response)
+}
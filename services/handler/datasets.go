@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/services/server"
+)
+
+// GetV0Datasets returns the datasets served by name, with their number of lines and the status of their index.
+// The number of lines of a dataset is only known once its index is ready.
+func (h Handler) GetV0Datasets(_ context.Context, _ server.GetV0DatasetsRequestObject,
+) (server.GetV0DatasetsResponseObject, error) {
+	datasets := []server.DatasetSummary{}
+	if h.Datasets != nil {
+		for _, name := range h.Datasets.Names() {
+			d := h.Datasets.Get(name)
+			if d == nil {
+				continue
+			}
+			holder := d.Index()
+			fileIndexSummary := holder.Load()
+			summary := server.DatasetSummary{
+				Name:  name,
+				Index: indexDetails(holder, fileIndexSummary),
+			}
+			if fileIndexSummary != nil {
+				summary.NumberOfLines = &fileIndexSummary.NumberOfLines
+			}
+			datasets = append(datasets, summary)
+		}
+	}
+	return server.GetV0Datasets200JSONResponse{
+		DatasetsResponseJSONResponse: server.DatasetsResponseJSONResponse{
+			Datasets: datasets,
+		},
+	}, nil
+}
+
+// GetV0DatasetsNameLinesLineIndex returns a line of the dataset of the name for a given line index
+func (h Handler) GetV0DatasetsNameLinesLineIndex(ctx context.Context,
+	request server.GetV0DatasetsNameLinesLineIndexRequestObject,
+) (server.GetV0DatasetsNameLinesLineIndexResponseObject, error) {
+	handler, ok := h.forDataset(request.Name)
+	if !ok {
+		return server.GetV0DatasetsNameLinesLineIndex404TextResponse(
+			fmt.Sprintf("dataset %q not found", request.Name)), nil
+	}
+	response, err := handler.GetV0LinesLineIndex(ctx,
+		server.GetV0LinesLineIndexRequestObject{LineIndex: request.LineIndex})
+	if err != nil {
+		return nil, err
+	}
+	switch response := response.(type) {
+	case server.GetV0LinesLineIndex200JSONResponse:
+		return server.GetV0DatasetsNameLinesLineIndex200JSONResponse(response), nil
+	case server.GetV0LinesLineIndex413Response:
+		return server.GetV0DatasetsNameLinesLineIndex413Response{}, nil
+	case server.GetV0LinesLineIndex422TextResponse:
+		return server.GetV0DatasetsNameLinesLineIndex422TextResponse(response), nil
+	default:
+		return nil, errors.Errorf("unexpected response type: %T", response)
+	}
+}
+
+// forDataset returns a handler serving the dataset of the name with the line delimiter of the dataset,
+// sharing the caches of the handler, as their entries are keyed by the versions of the datasets.
+// It returns false if the dataset does not exist.
+func (h Handler) forDataset(name string) (Handler, bool) {
+	if h.Datasets == nil {
+		return Handler{}, false
+	}
+	d := h.Datasets.Get(name)
+	if d == nil {
+		return Handler{}, false
+	}
+	h.Dataset = d
+	if delimiter := d.Delimiter(); delimiter != "" {
+		h.Delimiter = delimiter
+	}
+	return h, true
+}
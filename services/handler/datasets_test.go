@@ -0,0 +1,109 @@
+//go:build unit
+
+package handler_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/renanrv/line-server/pkg/dataset"
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/utils"
+	"github.com/renanrv/line-server/services/handler"
+	"github.com/renanrv/line-server/services/server"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_Datasets(t *testing.T) {
+	logger := zerolog.New(nil)
+	registry := dataset.NewRegistry()
+	defer registry.Close()
+
+	file := utils.CreateTempFile(t, "line1\nline2\n")
+	fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), 10, fileprocessing.IndexOptions{})
+	assert.Nil(t, err)
+	defaultDataset, err := dataset.New(&logger, file.Name(), fileprocessing.NewIndexHolder(fileIndexSummary),
+		dataset.Options{})
+	assert.Nil(t, err)
+	assert.Nil(t, registry.Add(dataset.DefaultName, defaultDataset))
+	// The dataset has another line delimiter than the handler, and its index is still generated
+	nulFile := utils.CreateTempFile(t, "nul line1\x00nul line2\x00nul line3\x00")
+	nulDataset, err := dataset.New(&logger, nulFile.Name(), fileprocessing.NewPendingIndexHolder(),
+		dataset.Options{Delimiter: fileprocessing.DelimiterNUL})
+	assert.Nil(t, err)
+	assert.Nil(t, registry.Add("nul", nulDataset))
+
+	h, err := handler.NewForDataset(&logger, defaultDataset, handler.Options{
+		LineCacheSize: 1024,
+		Datasets:      registry,
+	})
+	assert.Nil(t, err)
+
+	t.Run("List datasets", func(t *testing.T) {
+		response, err := h.GetV0Datasets(context.Background(), server.GetV0DatasetsRequestObject{})
+		assert.Nil(t, err)
+		datasets := response.(server.GetV0Datasets200JSONResponse).Datasets
+		assert.Len(t, datasets, 2)
+		assert.Equal(t, dataset.DefaultName, datasets[0].Name)
+		assert.Equal(t, 2, *datasets[0].NumberOfLines)
+		assert.Equal(t, server.Ready, datasets[0].Index.Status)
+		assert.Equal(t, "nul", datasets[1].Name)
+		assert.Nil(t, datasets[1].NumberOfLines)
+		assert.Equal(t, server.Pending, datasets[1].Index.Status)
+	})
+
+	tests := []struct {
+		name             string
+		request          server.GetV0DatasetsNameLinesLineIndexRequestObject
+		expectedResponse server.GetV0DatasetsNameLinesLineIndexResponseObject
+	}{
+		{
+			name:    "Line of the default dataset",
+			request: server.GetV0DatasetsNameLinesLineIndexRequestObject{Name: dataset.DefaultName, LineIndex: 1},
+			expectedResponse: server.GetV0DatasetsNameLinesLineIndex200JSONResponse{
+				LineResponseJSONResponse: server.LineResponseJSONResponse{Text: "line2"},
+			},
+		},
+		{
+			name:    "Line with the delimiter of the dataset",
+			request: server.GetV0DatasetsNameLinesLineIndexRequestObject{Name: "nul", LineIndex: 1},
+			expectedResponse: server.GetV0DatasetsNameLinesLineIndex200JSONResponse{
+				LineResponseJSONResponse: server.LineResponseJSONResponse{Text: "nul line2"},
+			},
+		},
+		{
+			name:             "Line beyond the end of the file",
+			request:          server.GetV0DatasetsNameLinesLineIndexRequestObject{Name: "nul", LineIndex: 3},
+			expectedResponse: server.GetV0DatasetsNameLinesLineIndex413Response{},
+		},
+		{
+			name:             "Unknown dataset",
+			request:          server.GetV0DatasetsNameLinesLineIndexRequestObject{Name: "unknown", LineIndex: 0},
+			expectedResponse: server.GetV0DatasetsNameLinesLineIndex404TextResponse(`dataset "unknown" not found`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The second request is served from the line cache shared by the datasets
+			for range 2 {
+				response, err := h.GetV0DatasetsNameLinesLineIndex(context.Background(), tt.request)
+				assert.Nil(t, err)
+				assert.Equal(t, tt.expectedResponse, response)
+			}
+		})
+	}
+
+	t.Run("Without datasets", func(t *testing.T) {
+		h, err := handler.NewForDataset(&logger, defaultDataset, handler.Options{})
+		assert.Nil(t, err)
+		response, err := h.GetV0Datasets(context.Background(), server.GetV0DatasetsRequestObject{})
+		assert.Nil(t, err)
+		assert.Empty(t, response.(server.GetV0Datasets200JSONResponse).Datasets)
+		lineResponse, err := h.GetV0DatasetsNameLinesLineIndex(context.Background(),
+			server.GetV0DatasetsNameLinesLineIndexRequestObject{Name: dataset.DefaultName, LineIndex: 0})
+		assert.Nil(t, err)
+		assert.Equal(t, server.GetV0DatasetsNameLinesLineIndex404TextResponse(`dataset "default" not found`),
+			lineResponse)
+	})
+}
@@ -0,0 +1,161 @@
+//go:build unit
+
+package handler_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/utils"
+	"github.com/renanrv/line-server/services/handler"
+	"github.com/renanrv/line-server/services/server"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// createLinesFile creates a temporary file with the given number of lines, such as `line 42`
+func createLinesFile(tb testing.TB, numberOfLines int) *os.File {
+	tb.Helper()
+	var content strings.Builder
+	for i := 0; i < numberOfLines; i++ {
+		_, _ = fmt.Fprintf(&content, "line %d\n", i)
+	}
+	return utils.CreateTempFile(tb, content.String())
+}
+
+func TestHandler_FileDescriptors(t *testing.T) {
+	logger := zerolog.New(nil)
+	file := createLinesFile(t, 1000)
+	fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), 10, fileprocessing.IndexOptions{})
+	assert.Nil(t, err)
+
+	t.Run("Concurrent requests", func(t *testing.T) {
+		// Requests share the descriptors without sharing a seek position
+		h, err := handler.New(&logger, file.Name(), fileprocessing.NewIndexHolder(fileIndexSummary),
+			handler.Options{MaxOpenFiles: 4})
+		assert.Nil(t, err)
+		var wg sync.WaitGroup
+		for worker := 0; worker < 16; worker++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := worker; i < 1000; i += 16 {
+					response, err := h.GetV0LinesLineIndex(context.Background(),
+						server.GetV0LinesLineIndexRequestObject{LineIndex: i})
+					assert.Nil(t, err)
+					assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+						LineResponseJSONResponse: server.LineResponseJSONResponse{Text: fmt.Sprintf("line %d", i)},
+					}, response)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("All descriptors in use", func(t *testing.T) {
+		h, err := handler.New(&logger, file.Name(), fileprocessing.NewIndexHolder(fileIndexSummary),
+			handler.Options{MaxOpenFiles: 1})
+		assert.Nil(t, err)
+		count := 10
+		// The descriptor is held until the range is streamed
+		rangeResponse, err := h.GetV0Lines(context.Background(),
+			server.GetV0LinesRequestObject{Params: server.GetV0LinesParams{Start: 0, Count: &count}})
+		assert.Nil(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = h.GetV0LinesLineIndex(ctx, server.GetV0LinesLineIndexRequestObject{LineIndex: 1})
+		assert.ErrorContains(t, err, "failed to acquire file descriptor: context canceled")
+
+		// Once the range is streamed, the descriptor is released
+		assert.Nil(t, rangeResponse.VisitGetV0LinesResponse(httptest.NewRecorder()))
+		response, err := h.GetV0LinesLineIndex(ctx, server.GetV0LinesLineIndexRequestObject{LineIndex: 1})
+		assert.Nil(t, err)
+		assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+			LineResponseJSONResponse: server.LineResponseJSONResponse{Text: "line 1"},
+		}, response)
+	})
+
+	t.Run("Negative max open files", func(t *testing.T) {
+		_, err := handler.New(&logger, file.Name(), nil, handler.Options{MaxOpenFiles: -1})
+		assert.EqualError(t, err, "max open files cannot be negative")
+	})
+}
+
+// BenchmarkHandler_GetV0LinesLineIndex compares serving lines from the long-lived descriptors of the handler
+// with opening the file and seeking the checkpoint of the line on every request, as the handler used to.
+func BenchmarkHandler_GetV0LinesLineIndex(b *testing.B) {
+	logger := zerolog.New(nil)
+	numberOfLines := 100000
+	file := createLinesFile(b, numberOfLines)
+	fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), numberOfLines/100,
+		fileprocessing.IndexOptions{})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("Open and seek per request", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				lineIndex := (i * 7919) % numberOfLines
+				if _, err := openAndSeekLine(file.Name(), fileIndexSummary, lineIndex); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+
+	b.Run("Pooled descriptors", func(b *testing.B) {
+		h, err := handler.New(&logger, file.Name(), fileprocessing.NewIndexHolder(fileIndexSummary),
+			handler.Options{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				lineIndex := (i * 7919) % numberOfLines
+				_, err := h.GetV0LinesLineIndex(context.Background(),
+					server.GetV0LinesLineIndexRequestObject{LineIndex: lineIndex})
+				if err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
+
+// openAndSeekLine reads a line by opening the file, seeking the checkpoint of the line and scanning to the line
+func openAndSeekLine(filePath string, fileIndexSummary *fileprocessing.FileIndexSummary, lineIndex int,
+) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	checkpoint, offset, _ := fileIndexSummary.Checkpoint(lineIndex)
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	reader := bufio.NewReaderSize(file, 64*1024)
+	for line := checkpoint; ; line++ {
+		text, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if line == lineIndex {
+			return strings.TrimSuffix(text, "\n"), nil
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/services/server"
+)
+
+// GetV0File returns the metadata of the file and the status of its index.
+// The number of lines is only known once the index is ready, as counting them requires scanning the file.
+func (h Handler) GetV0File(_ context.Context, _ server.GetV0FileRequestObject,
+) (server.GetV0FileResponseObject, error) {
+	version, err := h.Dataset.Acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer version.Release()
+	holder := version.Index
+	fileIndexSummary := holder.Load()
+	index := indexDetails(holder, fileIndexSummary)
+	var fileInfo fileprocessing.FileInfo
+	var compression fileprocessing.Compression
+	var numberOfLines *int
+	switch {
+	case fileIndexSummary != nil:
+		// The file info of the index identifies the version of the file the lines are served from
+		fileInfo = fileIndexSummary.FileInfo
+		compression = fileIndexSummary.Compression
+		numberOfLines = &fileIndexSummary.NumberOfLines
+	default:
+		fileInfo, err = fileprocessing.ReadFileInfoFrom(h.Dataset.Source())
+		if err != nil {
+			return nil, err
+		}
+		compression, err = fileprocessing.DetectCompressionFrom(h.Dataset.Source())
+		if err != nil {
+			return nil, err
+		}
+		// An empty file has no index, but its number of lines is known
+		if holder.Ready() && fileInfo.Size == 0 {
+			numberOfLines = new(int)
+		}
+	}
+	return server.GetV0File200JSONResponse{
+		FileResponseJSONResponse: server.FileResponseJSONResponse{
+			NumberOfLines:    numberOfLines,
+			Size:             fileInfo.Size,
+			ModificationTime: fileInfo.ModTime,
+			Fingerprint:      fileInfo.Fingerprint,
+			Compression:      compression.String(),
+			Index:            index,
+		},
+	}, nil
+}
+
+// indexDetails describes the status of the index of the holder, whose file index summary was loaded by the caller.
+func indexDetails(holder *fileprocessing.IndexHolder, fileIndexSummary *fileprocessing.FileIndexSummary,
+) server.IndexDetails {
+	index := server.IndexDetails{
+		Status:          server.Pending,
+		BuildDurationMs: holder.BuildDuration().Milliseconds(),
+	}
+	switch {
+	case fileIndexSummary != nil:
+		mode := string(fileIndexSummary.Mode)
+		checkpoints := len(fileIndexSummary.Index)
+		index.Status = server.Ready
+		index.Mode = &mode
+		index.IndexOffset = &fileIndexSummary.IndexOffset
+		index.Checkpoints = &checkpoints
+	case holder.Ready():
+		index.Status = server.Unavailable
+	}
+	return index
+}
@@ -0,0 +1,158 @@
+//go:build unit
+
+package handler_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/utils"
+	"github.com/renanrv/line-server/services/handler"
+	"github.com/renanrv/line-server/services/server"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_GetV0File(t *testing.T) {
+	logger := zerolog.New(nil)
+	intPtr := func(value int) *int {
+		return &value
+	}
+	mode := string(fileprocessing.IndexModeMemory)
+
+	tests := []struct {
+		name                  string
+		content               string
+		index                 func(filePath string) *fileprocessing.IndexHolder
+		expectedNumberOfLines *int
+		expectedCompression   string
+		expectedIndex         server.IndexDetails
+	}{
+		{
+			name:    "Ready index",
+			content: "line1\nline2\nline3\n",
+			index: func(filePath string) *fileprocessing.IndexHolder {
+				fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, filePath, 2,
+					fileprocessing.IndexOptions{})
+				assert.Nil(t, err)
+				return fileprocessing.NewIndexHolder(fileIndexSummary)
+			},
+			expectedNumberOfLines: intPtr(3),
+			expectedCompression:   "none",
+			expectedIndex: server.IndexDetails{
+				Status:      server.Ready,
+				Mode:        &mode,
+				IndexOffset: intPtr(2),
+				Checkpoints: intPtr(2),
+			},
+		},
+		{
+			name:    "Ready index of a compressed file",
+			content: gzipContent(t, "line1\nline2\nline3\n"),
+			index: func(filePath string) *fileprocessing.IndexHolder {
+				fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, filePath, 2,
+					fileprocessing.IndexOptions{})
+				assert.Nil(t, err)
+				return fileprocessing.NewIndexHolder(fileIndexSummary)
+			},
+			expectedNumberOfLines: intPtr(3),
+			expectedCompression:   "gzip",
+			expectedIndex: server.IndexDetails{
+				Status:      server.Ready,
+				Mode:        &mode,
+				IndexOffset: intPtr(2),
+				Checkpoints: intPtr(2),
+			},
+		},
+		{
+			name:    "Pending index of a compressed file",
+			content: gzipContent(t, "line1\nline2\nline3\n"),
+			index: func(string) *fileprocessing.IndexHolder {
+				return fileprocessing.NewPendingIndexHolder()
+			},
+			expectedCompression: "gzip",
+			expectedIndex:       server.IndexDetails{Status: server.Pending},
+		},
+		{
+			name:    "Pending index",
+			content: "line1\nline2\nline3\n",
+			index: func(string) *fileprocessing.IndexHolder {
+				return fileprocessing.NewPendingIndexHolder()
+			},
+			expectedCompression: "none",
+			expectedIndex:       server.IndexDetails{Status: server.Pending},
+		},
+		{
+			name:    "Unavailable index",
+			content: "line1\nline2\nline3\n",
+			index: func(string) *fileprocessing.IndexHolder {
+				return fileprocessing.NewIndexHolder(nil)
+			},
+			expectedCompression: "none",
+			expectedIndex:       server.IndexDetails{Status: server.Unavailable},
+		},
+		{
+			name:    "Empty file",
+			content: "",
+			index: func(string) *fileprocessing.IndexHolder {
+				return fileprocessing.NewIndexHolder(nil)
+			},
+			expectedNumberOfLines: intPtr(0),
+			expectedCompression:   "none",
+			expectedIndex:         server.IndexDetails{Status: server.Unavailable},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := utils.CreateTempFile(t, tt.content)
+			h, err := handler.New(&logger, file.Name(), tt.index(file.Name()), handler.Options{})
+			assert.Nil(t, err)
+			fileInfo, err := fileprocessing.ReadFileInfo(file.Name())
+			assert.Nil(t, err)
+
+			response, err := h.GetV0File(context.Background(), server.GetV0FileRequestObject{})
+			assert.Nil(t, err)
+			fileResponse, ok := response.(server.GetV0File200JSONResponse)
+			assert.True(t, ok)
+			// The build duration is only checked to be measured while the index is pending
+			if tt.expectedIndex.Status == server.Pending {
+				assert.GreaterOrEqual(t, fileResponse.Index.BuildDurationMs, int64(0))
+			}
+			fileResponse.Index.BuildDurationMs = 0
+			assert.Equal(t, server.GetV0File200JSONResponse{
+				FileResponseJSONResponse: server.FileResponseJSONResponse{
+					NumberOfLines:    tt.expectedNumberOfLines,
+					Size:             int64(len(tt.content)),
+					ModificationTime: fileInfo.ModTime,
+					Fingerprint:      fileInfo.Fingerprint,
+					Compression:      tt.expectedCompression,
+					Index:            tt.expectedIndex,
+				},
+			}, fileResponse)
+		})
+	}
+
+	t.Run("Missing file", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line1\n")
+		h, err := handler.New(&logger, file.Name(), nil, handler.Options{})
+		assert.Nil(t, err)
+		assert.Nil(t, os.Remove(file.Name()))
+		_, err = h.GetV0File(context.Background(), server.GetV0FileRequestObject{})
+		assert.NotNil(t, err)
+	})
+}
+
+// gzipContent compresses the content into a gzip member.
+func gzipContent(t *testing.T, content string) string {
+	t.Helper()
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write([]byte(content))
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+	return compressed.String()
+}
@@ -1,46 +1,120 @@
 package handler
 
 import (
-	"bufio"
 	"context"
+	"fmt"
 	"io"
-	"os"
 
 	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/dataset"
 	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/metrics"
 	"github.com/renanrv/line-server/pkg/utils"
 	"github.com/renanrv/line-server/services/server"
 	"github.com/rs/zerolog"
 )
 
 type Handler struct {
-	Logger           *zerolog.Logger
-	FilePath         string
-	FileIndexSummary *fileprocessing.FileIndexSummary
+	Logger       *zerolog.Logger
+	Dataset      *dataset.Dataset
+	MaxLineSize  int
+	Delimiter    fileprocessing.Delimiter
+	MaxBatchSize int
+	// Datasets holds the datasets served by name, besides the dataset of the handler
+	Datasets *dataset.Registry
+
+	lines  *lineCache
+	blocks *blockCache
+}
+
+// Options holds the optional settings of the handler.
+type Options struct {
+	// MaxLineSize limits the size in bytes of a served line. If 0, DefaultMaxLineSize is used.
+	MaxLineSize int
+	// Delimiter defines how the lines of the file are terminated, excluded from the served lines.
+	// If empty, lines are terminated with `\n`, and with fileprocessing.DelimiterAuto, it is detected from the file.
+	Delimiter fileprocessing.Delimiter
+	// MaxBatchSize limits the number of line indices of a batch request. If 0, DefaultMaxBatchSize is used.
+	MaxBatchSize int
+	// MaxOpenFiles limits the number of descriptors of the file opened to serve lines, which are kept open
+	// and shared by the requests. If 0, dataset.DefaultMaxOpenFiles is used. It is ignored by NewForDataset.
+	MaxOpenFiles int
+	// LineCacheSize limits the size in bytes of the cache of the most recently served lines. If 0, it is disabled.
+	LineCacheSize int64
+	// BlockCacheSize limits the size in bytes of the cache of the most recently read blocks of the file.
+	// If 0, it is disabled.
+	BlockCacheSize int64
+	// Datasets holds the datasets served by name, sharing the caches of the handler. If nil, none is served.
+	Datasets *dataset.Registry
 }
 
-// New function instantiates a handler, checking if all dependencies are valid
-func New(l *zerolog.Logger, filePath string, fileIndexSummary *fileprocessing.FileIndexSummary,
+// New function instantiates a handler, checking if all dependencies are valid.
+// The file is served without being reloaded, with the index published by the index holder.
+func New(l *zerolog.Logger, filePath string, index *fileprocessing.IndexHolder, opts Options,
 ) (server.StrictServerInterface, error) {
 	// Validates the handler's dependencies.
-	// FilePath index summary is optional, but if provided,
-	// it is validated by validateFileIndexSummary function before being used.
+	// Index is optional, and its file index summary may still be generated in background.
+	// If available, the summary is validated by validateFileIndexSummary function before being used.
 	err := validate(l, filePath)
 	if err != nil {
 		return nil, err
 	}
+	d, err := dataset.New(l, filePath, index, dataset.Options{MaxOpenFiles: opts.MaxOpenFiles})
+	if err != nil {
+		return nil, err
+	}
+	return NewForDataset(l, d, opts)
+}
+
+// NewForDataset instantiates a handler serving the current version of the file of the dataset,
+// checking if all dependencies are valid.
+func NewForDataset(l *zerolog.Logger, d *dataset.Dataset, opts Options) (server.StrictServerInterface, error) {
+	if l == nil {
+		return nil, errors.New("logger is required")
+	}
+	if d == nil {
+		return nil, errors.New("dataset is required")
+	}
+	if opts.MaxLineSize < 0 {
+		return nil, errors.New("max line size cannot be negative")
+	}
+	if opts.MaxLineSize == 0 {
+		opts.MaxLineSize = DefaultMaxLineSize
+	}
+	if opts.MaxBatchSize < 0 {
+		return nil, errors.New("max batch size cannot be negative")
+	}
+	if opts.MaxBatchSize == 0 {
+		opts.MaxBatchSize = DefaultMaxBatchSize
+	}
+	if opts.LineCacheSize < 0 || opts.BlockCacheSize < 0 {
+		return nil, errors.New("cache size cannot be negative")
+	}
+	delimiter, err := fileprocessing.ResolveDelimiterFrom(opts.Delimiter, d.Source())
+	if err != nil {
+		return nil, err
+	}
 	return Handler{
-		Logger:           l,
-		FilePath:         filePath,
-		FileIndexSummary: fileIndexSummary,
+		Logger:       l,
+		Dataset:      d,
+		MaxLineSize:  opts.MaxLineSize,
+		Delimiter:    delimiter,
+		MaxBatchSize: opts.MaxBatchSize,
+		Datasets:     opts.Datasets,
+		lines:        newLineCache(opts.LineCacheSize),
+		blocks:       newBlockCache(opts.BlockCacheSize),
 	}, nil
 }
 
 // GetV0LinesLineIndex returns a line for a given line index
-func (h Handler) GetV0LinesLineIndex(_ context.Context, request server.GetV0LinesLineIndexRequestObject,
+func (h Handler) GetV0LinesLineIndex(ctx context.Context, request server.GetV0LinesLineIndexRequestObject,
 ) (server.GetV0LinesLineIndexResponseObject, error) {
 	// Obtain the result from the file according the requested line index
-	text, err := h.readLine(request.LineIndex)
+	text, err := h.readLine(ctx, request.LineIndex)
+	if errors.Is(err, ErrLineTooLong) {
+		return server.GetV0LinesLineIndex422TextResponse(
+			fmt.Sprintf("%s of %d bytes", ErrLineTooLong.Error(), h.MaxLineSize)), nil
+	}
 	if err != nil && err.Error() != io.EOF.Error() {
 		return nil, err
 	}
@@ -49,6 +123,7 @@ func (h Handler) GetV0LinesLineIndex(_ context.Context, request server.GetV0Line
 		return server.GetV0LinesLineIndex413Response{}, nil
 	}
 	// Returns successful response
+	metrics.LinesServed.WithLabelValues("line").Inc()
 	return server.GetV0LinesLineIndex200JSONResponse{
 		LineResponseJSONResponse: server.LineResponseJSONResponse{
 			Text: text,
@@ -56,136 +131,49 @@ func (h Handler) GetV0LinesLineIndex(_ context.Context, request server.GetV0Line
 	}, nil
 }
 
-// readLine method reads the file and returns the line according the provided line index
-func (h Handler) readLine(lineIndex int) (string, error) {
-	file, err := os.Open(h.FilePath)
-	if err != nil {
-		return "", errors.Wrap(err, "failed to open file")
-	}
-	defer func() {
-		err = file.Close()
-		if err != nil {
-			h.Logger.Error().Err(err).Msg("failed to close file")
-		}
-	}()
-	// If no file index summary is available, read the file line by line
-	if h.FileIndexSummary == nil {
-		currentLine := 0
-		return scanFile(lineIndex, file, currentLine)
-	}
-	// If file index summary is available, seek the line index in the index map
-	return h.seekFileLine(file, lineIndex)
-}
-
-// seekFileLine function seeks the line index in the file by using the file index map.
-// It uses the file index map to find the starting position of the line in the file.
-// If the line index is not found in the map, it finds the closest indexed line and seeks to that position.
-// It then reads line by line from that position in the file and returns the line when the request index is found.
-func (h Handler) seekFileLine(file *os.File, lineIndex int) (string, error) {
-	// Validate the file index summary
-	err := h.validateFileIndexSummary()
+// readLine method reads the file and returns the line according the provided line index.
+// Hot lines are served from the line cache, without reading the file.
+func (h Handler) readLine(ctx context.Context, lineIndex int) (string, error) {
+	version, err := h.Dataset.Acquire()
 	if err != nil {
 		return "", err
 	}
-	// Check if the line index is negative or greater than the number of lines in the file
-	if lineIndex < 0 || lineIndex >= h.FileIndexSummary.NumberOfLines {
-		return "", io.EOF
-	}
-	start := int64(0)
-	start, ok := h.FileIndexSummary.Index[lineIndex]
-	if !ok {
-		h.Logger.Info().Int("index", lineIndex).Msg("no index available in index map")
-		// Retrieve the closest index for the line index value,
-		// in order to identify the best indexed starting point to seek the line
-		currentLine, err := h.closestIndexedFileLine(lineIndex)
-		if err != nil {
-			return "", err
-		}
-		h.Logger.Debug().
-			Int("index", lineIndex).
-			Int("closest_index", currentLine).
-			Msg("closest index available in index map")
-		start, ok = h.FileIndexSummary.Index[currentLine]
-		if !ok {
-			h.Logger.Warn().Int("index", lineIndex).Msg("no closest index available in index map")
-			// If no closest index is available, read the file line by line from the beginning
-			_, err = file.Seek(0, 0)
-			if err != nil {
-				return "", errors.Wrap(err, "failed to seek to beginning of file")
-			}
-			return scanFile(lineIndex, file, currentLine)
-		}
-		h.Logger.Debug().Int("index", lineIndex).Int64("start", start).Msg("Position in file")
-		_, err = file.Seek(start, 0)
-		if err != nil {
-			return "", errors.Wrap(err, "failed to seek to index position")
-		}
-		return scanFile(lineIndex, file, currentLine)
-	}
-	// If the line index is found in the index map, seek to that position
-	_, err = file.Seek(start, 0)
+	defer version.Release()
+	if text, ok := h.lines.get(version.ID, lineIndex); ok {
+		return text, nil
+	}
+	reader, err := h.newLineReader(ctx, version)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to seek to index position")
+		return "", err
 	}
-	reader := bufio.NewReader(file)
-	line, err := reader.ReadString('\n')
+	defer reader.close()
+	text, err := reader.readLine(lineIndex)
 	if err != nil {
-		return "", errors.Wrap(err, "error reading file")
+		return "", err
 	}
-	// Return the line value without the `\n` character
-	if len(line) > 0 && line[len(line)-1] == '\n' {
-		line = line[:len(line)-1]
+	if reader.cacheable(lineIndex) {
+		h.lines.add(version.ID, lineIndex, text)
 	}
-	return line, nil
-}
-
-// closestIndexedFileLine fetches the closest index for the requested line index
-func (h Handler) closestIndexedFileLine(lineIndex int) (int, error) {
-	// FileIndexSummary has been validated before,
-	// so we can safely use it here
-	numberOfLines := h.FileIndexSummary.NumberOfLines
-	indexOffset := h.FileIndexSummary.IndexOffset
-	for indexedFileLine := 0; indexedFileLine < numberOfLines; indexedFileLine += indexOffset {
-		if (indexedFileLine <= lineIndex) && (indexedFileLine+indexOffset > lineIndex) {
-			return indexedFileLine, nil
-		}
-	}
-	return 0, errors.New("no file index found")
+	return text, nil
 }
 
 // validateFileIndexSummary validates the file index summary
-func (h Handler) validateFileIndexSummary() error {
-	if h.FileIndexSummary == nil {
+func validateFileIndexSummary(fileIndexSummary *fileprocessing.FileIndexSummary) error {
+	if fileIndexSummary == nil {
 		return errors.New("file index summary is required")
 	}
-	if h.FileIndexSummary.Index == nil {
+	if fileIndexSummary.Index == nil {
 		return errors.New("file index is required")
 	}
-	if h.FileIndexSummary.IndexOffset <= 0 {
+	if fileIndexSummary.IndexOffset <= 0 {
 		return errors.New("file index offset must be greater than 0")
 	}
-	if h.FileIndexSummary.NumberOfLines <= 0 {
+	if fileIndexSummary.NumberOfLines <= 0 {
 		return errors.New("file number of lines must be greater than 0")
 	}
 	return nil
 }
 
-// scanFile function uses a scanner to read a file line by line and return the line from the provided line index
-func scanFile(lineIndex int, file *os.File, currentLine int) (string, error) {
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		if currentLine == lineIndex {
-			return scanner.Text(), nil
-		}
-		currentLine++
-	}
-	if err := scanner.Err(); err != nil {
-		return "", errors.Wrap(err, "error reading file")
-	}
-	// Line index out of range
-	return "", io.EOF
-}
-
 // validate function validates the dependencies to instantiate a new handler
 func validate(logger *zerolog.Logger, filePath string) error {
 	if logger == nil {
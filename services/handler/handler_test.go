@@ -4,11 +4,22 @@ package handler_test
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/renanrv/line-server/pkg/dataset"
 	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/metrics"
+	"github.com/renanrv/line-server/pkg/source"
 	"github.com/renanrv/line-server/pkg/utils"
 	"github.com/renanrv/line-server/services/handler"
 	"github.com/renanrv/line-server/services/server"
@@ -25,6 +36,7 @@ func TestNew(t *testing.T) {
 		logger           *zerolog.Logger
 		filePath         string
 		fileIndexSummary *fileprocessing.FileIndexSummary
+		opts             handler.Options
 		expectedError    error
 	}{
 		{
@@ -57,10 +69,33 @@ func TestNew(t *testing.T) {
 			logger:   &zerolog.Logger{},
 			filePath: file.Name(),
 		},
+		{
+			name:          "negative max line size",
+			logger:        &zerolog.Logger{},
+			filePath:      file.Name(),
+			opts:          handler.Options{MaxLineSize: -1},
+			expectedError: errors.New("max line size cannot be negative"),
+		},
+		{
+			name:          "negative max batch size",
+			logger:        &zerolog.Logger{},
+			filePath:      file.Name(),
+			opts:          handler.Options{MaxBatchSize: -1},
+			expectedError: errors.New("max batch size cannot be negative"),
+		},
+		{
+			name:     "invalid delimiter",
+			logger:   &zerolog.Logger{},
+			filePath: file.Name(),
+			opts:     handler.Options{Delimiter: "tab"},
+			expectedError: errors.New(`invalid line delimiter "tab", ` +
+				"it must be auto, lf, crlf, nul or a single byte"),
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := handler.New(tt.logger, tt.filePath, tt.fileIndexSummary)
+			_, err := handler.New(tt.logger, tt.filePath, fileprocessing.NewIndexHolder(tt.fileIndexSummary),
+				tt.opts)
 			if tt.expectedError != nil || err != nil {
 				assert.Equal(t, tt.expectedError.Error(), err.Error())
 			}
@@ -95,11 +130,7 @@ func TestHandler_GetV0LinesLineIndex(t *testing.T) {
 		{
 			name: "Get existing line with indexed line from file index summary",
 			fileIndexSummary: &fileprocessing.FileIndexSummary{
-				Index: map[int]int64{
-					0: 0,
-					1: 6,
-					2: 12,
-				},
+				Index:         []int64{0, 6, 12},
 				IndexOffset:   1,
 				NumberOfLines: 3,
 			},
@@ -114,12 +145,27 @@ func TestHandler_GetV0LinesLineIndex(t *testing.T) {
 			expectedError: nil,
 		},
 		{
-			name: "Get existing line without indexed line from file index summary",
+			name: "Get existing line with memory-mapped file index summary",
 			fileIndexSummary: &fileprocessing.FileIndexSummary{
-				Index: map[int]int64{
-					0: 0,
-					2: 12,
+				Index:         []int64{0, 6, 12},
+				IndexOffset:   1,
+				NumberOfLines: 3,
+				Mode:          fileprocessing.IndexModeMmap,
+			},
+			request: server.GetV0LinesLineIndexRequestObject{
+				LineIndex: 2,
+			},
+			expectedResponse: server.GetV0LinesLineIndex200JSONResponse{
+				LineResponseJSONResponse: server.LineResponseJSONResponse{
+					Text: "line3",
 				},
+			},
+			expectedError: nil,
+		},
+		{
+			name: "Get existing line without indexed line from file index summary",
+			fileIndexSummary: &fileprocessing.FileIndexSummary{
+				Index:         []int64{0, 12},
 				IndexOffset:   2,
 				NumberOfLines: 3,
 			},
@@ -136,10 +182,7 @@ func TestHandler_GetV0LinesLineIndex(t *testing.T) {
 		{
 			name: "No closest index in file index summary",
 			fileIndexSummary: &fileprocessing.FileIndexSummary{
-				Index: map[int]int64{
-					4: 12,
-					5: 18,
-				},
+				Index:         []int64{},
 				IndexOffset:   2,
 				NumberOfLines: 3,
 			},
@@ -154,20 +197,21 @@ func TestHandler_GetV0LinesLineIndex(t *testing.T) {
 			expectedError: nil,
 		},
 		{
-			name: "Invalid file path",
+			name: "Removed file served from its opened descriptor",
 			fileIndexSummary: &fileprocessing.FileIndexSummary{
-				Index: map[int]int64{
-					4: 12,
-					5: 18,
-				},
+				Index:         []int64{12, 18},
 				IndexOffset:   1,
 				NumberOfLines: 1,
 			},
 			request: server.GetV0LinesLineIndexRequestObject{
-				LineIndex: 1,
+				LineIndex: 0,
 			},
-			expectedResponse: nil,
-			expectedError:    errors.New("failed to open file"),
+			expectedResponse: server.GetV0LinesLineIndex200JSONResponse{
+				LineResponseJSONResponse: server.LineResponseJSONResponse{
+					Text: "line3",
+				},
+			},
+			expectedError: nil,
 		},
 		{
 			name: "Invalid line index with negative value",
@@ -180,11 +224,7 @@ func TestHandler_GetV0LinesLineIndex(t *testing.T) {
 		{
 			name: "Invalid line index with negative value with file index summary",
 			fileIndexSummary: &fileprocessing.FileIndexSummary{
-				Index: map[int]int64{
-					0: 0,
-					1: 6,
-					2: 12,
-				},
+				Index:         []int64{0, 6, 12},
 				IndexOffset:   1,
 				NumberOfLines: 3,
 			},
@@ -205,11 +245,7 @@ func TestHandler_GetV0LinesLineIndex(t *testing.T) {
 		{
 			name: "Invalid line index with value greater than number of lines with file index summary",
 			fileIndexSummary: &fileprocessing.FileIndexSummary{
-				Index: map[int]int64{
-					0: 0,
-					1: 6,
-					2: 12,
-				},
+				Index:         []int64{0, 6, 12},
 				IndexOffset:   1,
 				NumberOfLines: 3,
 			},
@@ -235,11 +271,7 @@ func TestHandler_GetV0LinesLineIndex(t *testing.T) {
 		{
 			name: "Invalid index offset in file index summary",
 			fileIndexSummary: &fileprocessing.FileIndexSummary{
-				Index: map[int]int64{
-					0: 0,
-					1: 6,
-					2: 12,
-				},
+				Index:         []int64{0, 6, 12},
 				IndexOffset:   0,
 				NumberOfLines: 3,
 			},
@@ -252,11 +284,7 @@ func TestHandler_GetV0LinesLineIndex(t *testing.T) {
 		{
 			name: "Invalid number of lines in file index summary",
 			fileIndexSummary: &fileprocessing.FileIndexSummary{
-				Index: map[int]int64{
-					0: 0,
-					1: 6,
-					2: 12,
-				},
+				Index:         []int64{0, 6, 12},
 				IndexOffset:   1,
 				NumberOfLines: 0,
 			},
@@ -269,11 +297,7 @@ func TestHandler_GetV0LinesLineIndex(t *testing.T) {
 		{
 			name: "Invalid index position in file index summary",
 			fileIndexSummary: &fileprocessing.FileIndexSummary{
-				Index: map[int]int64{
-					0: 0,
-					1: 24,
-					2: 12,
-				},
+				Index:         []int64{0, 24, 12},
 				IndexOffset:   1,
 				NumberOfLines: 3,
 			},
@@ -289,10 +313,11 @@ func TestHandler_GetV0LinesLineIndex(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			file := utils.CreateTempFile(t, content)
-			h, err := handler.New(&logger, file.Name(), tt.fileIndexSummary)
+			h, err := handler.New(&logger, file.Name(), fileprocessing.NewIndexHolder(tt.fileIndexSummary),
+				handler.Options{})
 			assert.Nil(t, err)
 			ctx := context.Background()
-			if tt.name == "Invalid file path" {
+			if tt.name == "Removed file served from its opened descriptor" {
 				os.Remove(file.Name())
 			}
 			response, err := h.GetV0LinesLineIndex(ctx, tt.request)
@@ -303,3 +328,536 @@ func TestHandler_GetV0LinesLineIndex(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_GetV0LinesLineIndex_PendingIndex(t *testing.T) {
+	content := "line1\nline2\nline3\n"
+	file := utils.CreateTempFile(t, content)
+	logger := zerolog.New(nil)
+	index := fileprocessing.NewPendingIndexHolder()
+	h, err := handler.New(&logger, file.Name(), index, handler.Options{})
+	assert.Nil(t, err)
+	request := server.GetV0LinesLineIndexRequestObject{LineIndex: 1}
+
+	// While the index is generated, the line is read by scanning the file
+	response, err := h.GetV0LinesLineIndex(context.Background(), request)
+	assert.Nil(t, err)
+	assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+		LineResponseJSONResponse: server.LineResponseJSONResponse{Text: "line2"},
+	}, response)
+
+	// Once stored, the index is used to seek the line,
+	// which is verified with an index pointing every line to the beginning of the file
+	index.Store(&fileprocessing.FileIndexSummary{
+		Index:         []int64{0, 0, 0},
+		IndexOffset:   1,
+		NumberOfLines: 3,
+	})
+	response, err = h.GetV0LinesLineIndex(context.Background(), request)
+	assert.Nil(t, err)
+	assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+		LineResponseJSONResponse: server.LineResponseJSONResponse{Text: "line1"},
+	}, response)
+}
+
+func TestHandler_GetV0LinesLineIndex_LongLines(t *testing.T) {
+	// Lines longer than the 64 KB token limit of bufio.Scanner
+	longLine := strings.Repeat("a", 200*1024)
+	content := "line1\n" + longLine + "\nline3\n"
+	lineEnd := int64(6 + len(longLine) + 1)
+
+	tests := []struct {
+		name             string
+		fileIndexSummary *fileprocessing.FileIndexSummary
+		opts             handler.Options
+		lineIndex        int
+		expectedResponse server.GetV0LinesLineIndexResponseObject
+	}{
+		{
+			name:      "Get long line without file index summary",
+			lineIndex: 1,
+			expectedResponse: server.GetV0LinesLineIndex200JSONResponse{
+				LineResponseJSONResponse: server.LineResponseJSONResponse{Text: longLine},
+			},
+		},
+		{
+			name: "Get long line with indexed line from file index summary",
+			fileIndexSummary: &fileprocessing.FileIndexSummary{
+				Index:         []int64{0, 6, lineEnd},
+				IndexOffset:   1,
+				NumberOfLines: 3,
+			},
+			lineIndex: 1,
+			expectedResponse: server.GetV0LinesLineIndex200JSONResponse{
+				LineResponseJSONResponse: server.LineResponseJSONResponse{Text: longLine},
+			},
+		},
+		{
+			name:      "Get line after long line without file index summary",
+			lineIndex: 2,
+			expectedResponse: server.GetV0LinesLineIndex200JSONResponse{
+				LineResponseJSONResponse: server.LineResponseJSONResponse{Text: "line3"},
+			},
+		},
+		{
+			name: "Get line after long line with file index summary",
+			fileIndexSummary: &fileprocessing.FileIndexSummary{
+				Index:         []int64{0, lineEnd},
+				IndexOffset:   2,
+				NumberOfLines: 3,
+			},
+			lineIndex: 2,
+			expectedResponse: server.GetV0LinesLineIndex200JSONResponse{
+				LineResponseJSONResponse: server.LineResponseJSONResponse{Text: "line3"},
+			},
+		},
+		{
+			name:      "Line exceeding the max line size",
+			opts:      handler.Options{MaxLineSize: 1024},
+			lineIndex: 1,
+			expectedResponse: server.GetV0LinesLineIndex422TextResponse(
+				"line exceeds the maximum line size of 1024 bytes"),
+		},
+		{
+			name:      "Line after a line exceeding the max line size",
+			opts:      handler.Options{MaxLineSize: 1024},
+			lineIndex: 2,
+			expectedResponse: server.GetV0LinesLineIndex200JSONResponse{
+				LineResponseJSONResponse: server.LineResponseJSONResponse{Text: "line3"},
+			},
+		},
+	}
+
+	logger := zerolog.New(nil)
+	file := utils.CreateTempFile(t, content)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := handler.New(&logger, file.Name(), fileprocessing.NewIndexHolder(tt.fileIndexSummary), tt.opts)
+			assert.Nil(t, err)
+			response, err := h.GetV0LinesLineIndex(context.Background(),
+				server.GetV0LinesLineIndexRequestObject{LineIndex: tt.lineIndex})
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedResponse, response)
+		})
+	}
+}
+
+func TestHandler_GetV0LinesLineIndex_Delimiters(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		delimiter     fileprocessing.Delimiter
+		expectedLines []string
+	}{
+		{
+			name:          "LF line endings",
+			content:       "line1\nline2\nline3\n",
+			expectedLines: []string{"line1", "line2", "line3"},
+		},
+		{
+			name:          "Detected CRLF line endings",
+			content:       "line1\r\nline2\r\nline3\r\n",
+			delimiter:     fileprocessing.DelimiterAuto,
+			expectedLines: []string{"line1", "line2", "line3"},
+		},
+		{
+			name:          "Mixed line endings",
+			content:       "line1\r\nline2\n\r\nli\rne4\r\n",
+			delimiter:     fileprocessing.DelimiterCRLF,
+			expectedLines: []string{"line1", "line2", "", "li\rne4"},
+		},
+		{
+			name:          "Carriage returns are kept with LF line endings",
+			content:       "line1\r\nline2\n",
+			delimiter:     fileprocessing.DelimiterLF,
+			expectedLines: []string{"line1\r", "line2"},
+		},
+		{
+			name:          "Unterminated last line",
+			content:       "line1\nline2\nline3",
+			expectedLines: []string{"line1", "line2", "line3"},
+		},
+		{
+			name:          "Unterminated last line with CRLF line endings",
+			content:       "line1\r\nline2",
+			delimiter:     fileprocessing.DelimiterCRLF,
+			expectedLines: []string{"line1", "line2"},
+		},
+		{
+			name:          "Detected NUL terminated lines",
+			content:       "line1\x00line\n2\x00line3\x00",
+			delimiter:     fileprocessing.DelimiterAuto,
+			expectedLines: []string{"line1", "line\n2", "line3"},
+		},
+		{
+			name:          "Custom delimiter",
+			content:       "line1;line2;;line4",
+			delimiter:     ";",
+			expectedLines: []string{"line1", "line2", "", "line4"},
+		},
+	}
+
+	logger := zerolog.New(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := utils.CreateTempFile(t, tt.content)
+			delimiter, err := fileprocessing.ResolveDelimiter(tt.delimiter, file.Name())
+			assert.Nil(t, err)
+			fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), 10,
+				fileprocessing.IndexOptions{Delimiter: delimiter})
+			assert.Nil(t, err)
+			assert.Equal(t, len(tt.expectedLines), fileIndexSummary.NumberOfLines)
+
+			// Lines are served consistently by scanning the file and by seeking the indexed lines
+			for _, summary := range []*fileprocessing.FileIndexSummary{nil, fileIndexSummary} {
+				h, err := handler.New(&logger, file.Name(), fileprocessing.NewIndexHolder(summary),
+					handler.Options{Delimiter: tt.delimiter})
+				assert.Nil(t, err)
+				for lineIndex, expectedLine := range tt.expectedLines {
+					response, err := h.GetV0LinesLineIndex(context.Background(),
+						server.GetV0LinesLineIndexRequestObject{LineIndex: lineIndex})
+					assert.Nil(t, err)
+					assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+						LineResponseJSONResponse: server.LineResponseJSONResponse{Text: expectedLine},
+					}, response)
+				}
+				response, err := h.GetV0LinesLineIndex(context.Background(),
+					server.GetV0LinesLineIndexRequestObject{LineIndex: len(tt.expectedLines)})
+				assert.Nil(t, err)
+				assert.Equal(t, server.GetV0LinesLineIndex413Response{}, response)
+			}
+		})
+	}
+}
+
+func TestHandler_GetV0LinesLineIndex_Compressed(t *testing.T) {
+	var lines []string
+	for i := range 3000 {
+		lines = append(lines, fmt.Sprintf("line %d %s", i, strings.Repeat("x", i%50)))
+	}
+	content := strings.Join(lines, "\n") + "\n"
+	encoder, err := zstd.NewWriter(nil)
+	assert.Nil(t, err)
+	var zstdContent []byte
+	for start := 0; start < len(content); start += 16 * 1024 {
+		zstdContent = encoder.EncodeAll([]byte(content[start:min(start+16*1024, len(content))]), zstdContent)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "Gzip file",
+			content: gzipContent(t, content),
+		},
+		{
+			name:    "Zstd file",
+			content: string(zstdContent),
+		},
+	}
+	logger := zerolog.New(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := utils.CreateTempFile(t, tt.content)
+			fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), 100,
+				fileprocessing.IndexOptions{AccessPointSpacing: 8 * 1024})
+			assert.Nil(t, err)
+			assert.Greater(t, len(fileIndexSummary.AccessPoints), 1)
+
+			// Lines are served from the decompressed content by scanning the file and by seeking the indexed lines,
+			// with and without the block cache
+			for _, summary := range []*fileprocessing.FileIndexSummary{nil, fileIndexSummary} {
+				for _, blockCacheSize := range []int64{0, 1024 * 1024} {
+					h, err := handler.New(&logger, file.Name(), fileprocessing.NewIndexHolder(summary),
+						handler.Options{BlockCacheSize: blockCacheSize})
+					assert.Nil(t, err)
+					for _, lineIndex := range []int{2999, 0, 1500, 1501, 42, 2000} {
+						response, err := h.GetV0LinesLineIndex(context.Background(),
+							server.GetV0LinesLineIndexRequestObject{LineIndex: lineIndex})
+						assert.Nil(t, err)
+						assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+							LineResponseJSONResponse: server.LineResponseJSONResponse{Text: lines[lineIndex]},
+						}, response)
+					}
+					response, err := h.GetV0LinesLineIndex(context.Background(),
+						server.GetV0LinesLineIndexRequestObject{LineIndex: len(lines)})
+					assert.Nil(t, err)
+					assert.Equal(t, server.GetV0LinesLineIndex413Response{}, response)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_GetV0LinesLineIndex_Metrics(t *testing.T) {
+	content := "line1\nline2\nline3\nline4\n"
+	file := utils.CreateTempFile(t, content)
+	logger := zerolog.New(nil)
+	index := fileprocessing.NewPendingIndexHolder()
+	h, err := handler.New(&logger, file.Name(), index, handler.Options{})
+	assert.Nil(t, err)
+	hits := metrics.IndexLookups.WithLabelValues(metrics.IndexHit)
+	misses := metrics.IndexLookups.WithLabelValues(metrics.IndexMiss)
+	linesServed := metrics.LinesServed.WithLabelValues("line")
+	hitsBefore, missesBefore := testutil.ToFloat64(hits), testutil.ToFloat64(misses)
+	linesServedBefore, diskBytesReadBefore := testutil.ToFloat64(linesServed), testutil.ToFloat64(metrics.DiskBytesRead)
+	openFilesBefore := testutil.ToFloat64(metrics.OpenFiles)
+
+	// Without the index, the file is scanned from the beginning
+	_, err = h.GetV0LinesLineIndex(context.Background(), server.GetV0LinesLineIndexRequestObject{LineIndex: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, missesBefore+1, testutil.ToFloat64(misses))
+	assert.Equal(t, diskBytesReadBefore+float64(len(content)), testutil.ToFloat64(metrics.DiskBytesRead))
+
+	// With the index, the checkpoint of the line is sought
+	fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), 2, fileprocessing.IndexOptions{})
+	assert.Nil(t, err)
+	index.Store(fileIndexSummary)
+	_, err = h.GetV0LinesLineIndex(context.Background(), server.GetV0LinesLineIndexRequestObject{LineIndex: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, hitsBefore+1, testutil.ToFloat64(hits))
+	assert.Equal(t, linesServedBefore+2, testutil.ToFloat64(linesServed))
+	// The file descriptor opened with the version is kept open and reused by the requests
+	assert.Equal(t, openFilesBefore, testutil.ToFloat64(metrics.OpenFiles))
+}
+
+func TestHandler_Reload(t *testing.T) {
+	logger := zerolog.New(nil)
+	file := utils.CreateTempFile(t, "line1\nline2\n")
+	buildIndex := func(src source.LineSource) (*fileprocessing.FileIndexSummary, error) {
+		return fileprocessing.GenerateIndexFrom(&logger, src, 10, fileprocessing.IndexOptions{})
+	}
+	fileIndexSummary, err := buildIndex(source.NewLocal(file.Name()))
+	assert.Nil(t, err)
+	d, err := dataset.New(&logger, file.Name(), fileprocessing.NewIndexHolder(fileIndexSummary),
+		dataset.Options{BuildIndex: buildIndex})
+	assert.Nil(t, err)
+	h, err := handler.NewForDataset(&logger, d, handler.Options{LineCacheSize: 1024, BlockCacheSize: 1024 * 1024})
+	assert.Nil(t, err)
+	count := 2
+	rangeResponse, err := h.GetV0Lines(context.Background(),
+		server.GetV0LinesRequestObject{Params: server.GetV0LinesParams{Start: 0, Count: &count}})
+	assert.Nil(t, err)
+	response, err := h.GetV0LinesLineIndex(context.Background(), server.GetV0LinesLineIndexRequestObject{LineIndex: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+		LineResponseJSONResponse: server.LineResponseJSONResponse{Text: "line2"},
+	}, response)
+
+	newFilePath := file.Name() + ".new"
+	assert.Nil(t, os.WriteFile(newFilePath, []byte("new line1\nnew line2\nnew line3\n"), 0o600))
+	assert.Nil(t, os.Rename(newFilePath, file.Name()))
+	assert.Nil(t, d.Reload())
+
+	// The cached lines of the old version are not served anymore
+	response, err = h.GetV0LinesLineIndex(context.Background(), server.GetV0LinesLineIndexRequestObject{LineIndex: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+		LineResponseJSONResponse: server.LineResponseJSONResponse{Text: "new line2"},
+	}, response)
+	response, err = h.GetV0LinesLineIndex(context.Background(), server.GetV0LinesLineIndexRequestObject{LineIndex: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+		LineResponseJSONResponse: server.LineResponseJSONResponse{Text: "new line3"},
+	}, response)
+
+	// The range started before the reload is streamed from the old version
+	rw := httptest.NewRecorder()
+	assert.Nil(t, rangeResponse.VisitGetV0LinesResponse(rw))
+	assert.Equal(t, `["line1","line2"]`+"\n", rw.Body.String())
+}
+
+func TestHandler_Append(t *testing.T) {
+	logger := zerolog.New(nil)
+	file := utils.CreateTempFile(t, "line1\nline2\n")
+	fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), 10, fileprocessing.IndexOptions{})
+	assert.Nil(t, err)
+	d, err := dataset.New(&logger, file.Name(), fileprocessing.NewIndexHolder(fileIndexSummary), dataset.Options{
+		ExtendIndex: func(src source.LineSource, fileIndexSummary *fileprocessing.FileIndexSummary,
+		) (*fileprocessing.FileIndexSummary, error) {
+			return fileprocessing.ExtendIndexFrom(&logger, src, fileIndexSummary, 10, fileprocessing.IndexOptions{})
+		},
+	})
+	assert.Nil(t, err)
+	h, err := handler.NewForDataset(&logger, d, handler.Options{LineCacheSize: 1024, BlockCacheSize: 1024 * 1024})
+	assert.Nil(t, err)
+	response, err := h.GetV0LinesLineIndex(context.Background(), server.GetV0LinesLineIndexRequestObject{LineIndex: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+		LineResponseJSONResponse: server.LineResponseJSONResponse{Text: "line2"},
+	}, response)
+
+	appended, err := os.OpenFile(file.Name(), os.O_APPEND|os.O_WRONLY, 0)
+	assert.Nil(t, err)
+	_, err = appended.WriteString("line3\nli")
+	assert.Nil(t, err)
+	assert.Nil(t, d.Reload())
+
+	// The appended line is served, while the partially written line is not until it is terminated
+	response, err = h.GetV0LinesLineIndex(context.Background(), server.GetV0LinesLineIndexRequestObject{LineIndex: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+		LineResponseJSONResponse: server.LineResponseJSONResponse{Text: "line3"},
+	}, response)
+	response, err = h.GetV0LinesLineIndex(context.Background(), server.GetV0LinesLineIndexRequestObject{LineIndex: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, server.GetV0LinesLineIndex413Response{}, response)
+
+	_, err = appended.WriteString("ne4\n")
+	assert.Nil(t, err)
+	assert.Nil(t, appended.Close())
+	assert.Nil(t, d.Reload())
+	response, err = h.GetV0LinesLineIndex(context.Background(), server.GetV0LinesLineIndexRequestObject{LineIndex: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+		LineResponseJSONResponse: server.LineResponseJSONResponse{Text: "line4"},
+	}, response)
+}
+
+func TestHandler_AppendOnly(t *testing.T) {
+	logger := zerolog.New(nil)
+	opts := fileprocessing.IndexOptions{TerminatedLinesOnly: true}
+	tests := []struct {
+		name  string
+		index bool
+	}{
+		{name: "Indexed file", index: true},
+		{name: "File scanned without an index"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The file is indexed while its last line is partially written
+			file := utils.CreateTempFile(t, "line1\nli")
+			datasetOptions := dataset.Options{TerminatedLinesOnly: true}
+			var index *fileprocessing.IndexHolder
+			if tt.index {
+				fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), 10, opts)
+				assert.Nil(t, err)
+				assert.Equal(t, 1, fileIndexSummary.NumberOfLines)
+				index = fileprocessing.NewIndexHolder(fileIndexSummary)
+				datasetOptions.ExtendIndex = func(src source.LineSource, fileIndexSummary *fileprocessing.FileIndexSummary,
+				) (*fileprocessing.FileIndexSummary, error) {
+					return fileprocessing.ExtendIndexFrom(&logger, src, fileIndexSummary, 10, opts)
+				}
+			}
+			d, err := dataset.New(&logger, file.Name(), index, datasetOptions)
+			assert.Nil(t, err)
+			h, err := handler.NewForDataset(&logger, d, handler.Options{LineCacheSize: 1024, BlockCacheSize: 1024 * 1024})
+			assert.Nil(t, err)
+
+			// The partially written line is hidden until its terminator is appended
+			response, err := h.GetV0LinesLineIndex(context.Background(),
+				server.GetV0LinesLineIndexRequestObject{LineIndex: 1})
+			assert.Nil(t, err)
+			assert.Equal(t, server.GetV0LinesLineIndex413Response{}, response)
+
+			appended, err := os.OpenFile(file.Name(), os.O_APPEND|os.O_WRONLY, 0)
+			assert.Nil(t, err)
+			_, err = appended.WriteString("ne2\n")
+			assert.Nil(t, err)
+			assert.Nil(t, appended.Close())
+			assert.Nil(t, d.Reload())
+
+			response, err = h.GetV0LinesLineIndex(context.Background(),
+				server.GetV0LinesLineIndexRequestObject{LineIndex: 1})
+			assert.Nil(t, err)
+			assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+				LineResponseJSONResponse: server.LineResponseJSONResponse{Text: "line2"},
+			}, response)
+		})
+	}
+}
+
+func TestHandler_MemorySource(t *testing.T) {
+	logger := zerolog.New(nil)
+	src := source.NewMemory("lines", []byte("line1\nline2\n"))
+	buildIndex := func(src source.LineSource) (*fileprocessing.FileIndexSummary, error) {
+		return fileprocessing.GenerateIndexFrom(&logger, src, 10, fileprocessing.IndexOptions{})
+	}
+	fileIndexSummary, err := buildIndex(src)
+	assert.Nil(t, err)
+	d, err := dataset.NewFromSource(&logger, src, fileprocessing.NewIndexHolder(fileIndexSummary), dataset.Options{
+		BuildIndex: buildIndex,
+		ExtendIndex: func(src source.LineSource, fileIndexSummary *fileprocessing.FileIndexSummary,
+		) (*fileprocessing.FileIndexSummary, error) {
+			return fileprocessing.ExtendIndexFrom(&logger, src, fileIndexSummary, 10, fileprocessing.IndexOptions{})
+		},
+	})
+	assert.Nil(t, err)
+	h, err := handler.NewForDataset(&logger, d, handler.Options{LineCacheSize: 1024, BlockCacheSize: 1024 * 1024})
+	assert.Nil(t, err)
+	getLine := func(lineIndex int) server.GetV0LinesLineIndexResponseObject {
+		response, err := h.GetV0LinesLineIndex(context.Background(),
+			server.GetV0LinesLineIndexRequestObject{LineIndex: lineIndex})
+		assert.Nil(t, err)
+		return response
+	}
+	assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+		LineResponseJSONResponse: server.LineResponseJSONResponse{Text: "line2"},
+	}, getLine(1))
+
+	// The appended lines are served from the same version, as with a growing local file
+	version, err := d.Acquire()
+	assert.Nil(t, err)
+	version.Release()
+	src.Append([]byte("line3\n"))
+	assert.Nil(t, d.Reload())
+	current, err := d.Acquire()
+	assert.Nil(t, err)
+	assert.Equal(t, version.ID, current.ID)
+	current.Release()
+	assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+		LineResponseJSONResponse: server.LineResponseJSONResponse{Text: "line3"},
+	}, getLine(2))
+
+	// The replaced content is served from a new version
+	src.Replace([]byte("new line1\nnew line2\n"))
+	assert.Nil(t, d.Reload())
+	assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+		LineResponseJSONResponse: server.LineResponseJSONResponse{Text: "new line2"},
+	}, getLine(1))
+	assert.Equal(t, server.GetV0LinesLineIndex413Response{}, getLine(2))
+}
+
+func TestHandler_HTTPSource(t *testing.T) {
+	logger := zerolog.New(nil)
+	var mu sync.Mutex
+	content, etag := "line1\nline2\nline3\n", `"v1"`
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "lines.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer remote.Close()
+	src, err := source.NewHTTP(remote.URL+"/lines.txt", source.HTTPOptions{BlockSize: 4, CacheSize: 1024})
+	assert.Nil(t, err)
+	buildIndex := func(src source.LineSource) (*fileprocessing.FileIndexSummary, error) {
+		return fileprocessing.GenerateIndexFrom(&logger, src, 10, fileprocessing.IndexOptions{})
+	}
+	fileIndexSummary, err := buildIndex(src)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{0, 6, 12}, fileIndexSummary.Index)
+	d, err := dataset.NewFromSource(&logger, src, fileprocessing.NewIndexHolder(fileIndexSummary),
+		dataset.Options{BuildIndex: buildIndex})
+	assert.Nil(t, err)
+	h, err := handler.NewForDataset(&logger, d, handler.Options{BlockCacheSize: 1024 * 1024})
+	assert.Nil(t, err)
+	response, err := h.GetV0LinesLineIndex(context.Background(), server.GetV0LinesLineIndexRequestObject{LineIndex: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+		LineResponseJSONResponse: server.LineResponseJSONResponse{Text: "line3"},
+	}, response)
+
+	// The remote file changed, as its ETag tells, so it is reloaded with a new index
+	mu.Lock()
+	content, etag = "new line1\nnew line2\nnew line3\nnew line4\n", `"v2"`
+	mu.Unlock()
+	assert.Nil(t, d.Reload())
+	assert.Equal(t, 4, d.Index().Load().NumberOfLines)
+	response, err = h.GetV0LinesLineIndex(context.Background(), server.GetV0LinesLineIndexRequestObject{LineIndex: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, server.GetV0LinesLineIndex200JSONResponse{
+		LineResponseJSONResponse: server.LineResponseJSONResponse{Text: "new line4"},
+	}, response)
+}
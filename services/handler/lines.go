@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"math"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/dataset"
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/metrics"
+	"github.com/renanrv/line-server/pkg/source"
+	"github.com/rs/zerolog"
+)
+
+// DefaultMaxLineSize is the maximum size in bytes of a served line, if not configured.
+const DefaultMaxLineSize = 16 * 1024 * 1024
+
+// readerBufferSize defines the size of the buffer used to read the file.
+// Lines longer than the buffer are read in several chunks.
+const readerBufferSize = 64 * 1024
+
+// readerPool reuses the buffers of the line readers between requests.
+var readerPool = sync.Pool{
+	New: func() any {
+		return bufio.NewReaderSize(nil, readerBufferSize)
+	},
+}
+
+// ErrLineTooLong is returned when the requested line exceeds the maximum line size.
+var ErrLineTooLong = errors.New("line exceeds the maximum line size")
+
+// readLine reads the next line from the reader and returns it without its line terminator.
+// Lines longer than the reader buffer are accumulated in chunks, up to maxLineSize bytes.
+// The last line of the file is returned even if it is not terminated, unless terminatedOnly is set,
+// in which case it is reported with io.EOF, as it may be partially written.
+func readLine(reader *bufio.Reader, delimiter fileprocessing.Delimiter, maxLineSize int, terminatedOnly bool,
+) (string, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice(delimiter.Terminator())
+		line = append(line, chunk...)
+		switch {
+		case err == nil:
+			line = delimiter.Trim(line)
+		case err == bufio.ErrBufferFull:
+			// The carriage return of CRLF may still be trimmed, so one more byte is allowed until the terminator
+			if len(line) > maxLineSize+1 {
+				return "", ErrLineTooLong
+			}
+			continue
+		case err == io.EOF:
+			if len(line) == 0 || terminatedOnly {
+				return "", io.EOF
+			}
+		default:
+			return "", errors.Wrap(err, "error reading file")
+		}
+		if len(line) > maxLineSize {
+			return "", ErrLineTooLong
+		}
+		return string(line), nil
+	}
+}
+
+// skipLines discards the next count lines from the reader, regardless of their size.
+// It returns io.EOF if the reader ends before the lines are skipped.
+func skipLines(reader *bufio.Reader, delimiter fileprocessing.Delimiter, count int) error {
+	for count > 0 {
+		_, err := reader.ReadSlice(delimiter.Terminator())
+		switch {
+		case err == nil:
+			count--
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF:
+			return io.EOF
+		default:
+			return errors.Wrap(err, "error reading file")
+		}
+	}
+	return nil
+}
+
+// diskFile reads the file with positional reads, counting the bytes read from disk.
+type diskFile struct {
+	file io.ReaderAt
+}
+
+func (d diskFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := d.file.ReadAt(p, off)
+	metrics.DiskBytesRead.Add(float64(n))
+	return n, err
+}
+
+// newSectionReader creates a reader of the file from the offset until its end.
+func newSectionReader(file io.ReaderAt, offset int64) *io.SectionReader {
+	return io.NewSectionReader(file, offset, math.MaxInt64-offset)
+}
+
+// lineReader reads the lines of a version of the file moving forward, so several lines are read in a single pass.
+// If a file index summary is available, the reader seeks the closest indexed line (the checkpoint)
+// when it is ahead of the current position, and otherwise it keeps reading from the current position.
+// The file is read with positional reads, so the reader does not depend on the seek position of the file,
+// and through the block cache of the handler if it is enabled.
+// The content of a compressed file is decompressed from the closest access point of its index before the position.
+type lineReader struct {
+	logger *zerolog.Logger
+	// files is the pool of the version of the file, to which descriptor is released once the reader is closed
+	files      *dataset.FilePool
+	descriptor source.File
+	// content is the decompressed content of the descriptor, or the descriptor itself if the file is not compressed
+	content          io.ReaderAt
+	file             io.ReaderAt
+	reader           *bufio.Reader
+	fileIndexSummary *fileprocessing.FileIndexSummary
+	delimiter        fileprocessing.Delimiter
+	maxLineSize      int
+	// terminatedLinesOnly hides the unterminated last line of the file, read without the index
+	terminatedLinesOnly bool
+	// line is the line the reader is positioned at, or -1 if its position is unknown
+	line int
+}
+
+// newLineReader creates a line reader for the version of the file, using its file index summary if it is available.
+// The reader checks out a descriptor of the version until it is closed.
+func (h Handler) newLineReader(ctx context.Context, version *dataset.Version) (*lineReader, error) {
+	// If no file index summary is available, such as while it is generated, the file is read line by line
+	fileIndexSummary := version.Index.Load()
+	if fileIndexSummary != nil {
+		if err := validateFileIndexSummary(fileIndexSummary); err != nil {
+			return nil, err
+		}
+	}
+	descriptor, err := version.Files.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Without the index, the compression of the file is detected from its magic bytes
+	compression, accessPoints := fileprocessing.CompressionNone, []fileprocessing.AccessPoint(nil)
+	if fileIndexSummary != nil {
+		compression, accessPoints = fileIndexSummary.Compression, fileIndexSummary.AccessPoints
+	} else if compression, err = fileprocessing.DetectCompression(descriptor); err != nil {
+		version.Files.Release(descriptor)
+		return nil, err
+	}
+	content := fileprocessing.NewDecompressedReader(diskFile{file: descriptor}, compression, accessPoints)
+	file := h.blocks.readerAt(version.ID, content)
+	reader := readerPool.Get().(*bufio.Reader)
+	reader.Reset(newSectionReader(file, 0))
+	return &lineReader{
+		logger:              h.Logger,
+		files:               version.Files,
+		descriptor:          descriptor,
+		content:             content,
+		file:                file,
+		reader:              reader,
+		fileIndexSummary:    fileIndexSummary,
+		delimiter:           h.Delimiter,
+		maxLineSize:         h.MaxLineSize,
+		line:                -1,
+		terminatedLinesOnly: h.Dataset.TerminatedLinesOnly(),
+	}, nil
+}
+
+// close releases the descriptor of the reader and returns its buffer to the pool,
+// so the reader cannot be used anymore.
+func (r *lineReader) close() {
+	r.reader.Reset(nil)
+	readerPool.Put(r.reader)
+	r.reader = nil
+	if closer, ok := r.content.(io.Closer); ok {
+		_ = closer.Close()
+	}
+	r.files.Release(r.descriptor)
+}
+
+// readLine returns the line of the provided line index.
+// Line index out of range is reported with io.EOF.
+func (r *lineReader) readLine(lineIndex int) (string, error) {
+	// Check if the line index is negative or greater than the number of lines in the file
+	if lineIndex < 0 || (r.fileIndexSummary != nil && lineIndex >= r.fileIndexSummary.NumberOfLines) {
+		return "", io.EOF
+	}
+	err := r.moveTo(lineIndex)
+	var line string
+	if err == nil {
+		line, err = readLine(r.reader, r.delimiter, r.maxLineSize, r.terminatedLinesOnly)
+	}
+	if err != nil {
+		// A line too long is not read entirely, so the position of the reader is unknown
+		r.line = -1
+		if err == io.EOF && r.fileIndexSummary != nil {
+			// The indexed line must exist, so the index does not match the file
+			return "", errors.Wrap(err, "error reading file")
+		}
+		return "", err
+	}
+	r.line = lineIndex + 1
+	return line, nil
+}
+
+// cacheable reports whether the line of the provided line index, once read, can be cached.
+// The last line may be partially written while lines are appended to the file, so it is not cached,
+// nor are the lines read without the index, whose last line is unknown.
+func (r *lineReader) cacheable(lineIndex int) bool {
+	return r.fileIndexSummary != nil && lineIndex < r.fileIndexSummary.NumberOfLines-1
+}
+
+// moveTo positions the reader at the beginning of the line of the provided line index.
+// The reader seeks the checkpoint of the line index if it is closer than the current position,
+// or if the line index is behind the current position.
+func (r *lineReader) moveTo(lineIndex int) error {
+	startLine, start, hit := 0, int64(0), false
+	if r.fileIndexSummary != nil {
+		checkpoint, offset, ok := r.fileIndexSummary.Checkpoint(lineIndex)
+		if ok {
+			startLine, start, hit = checkpoint, offset, true
+		} else {
+			r.logger.Warn().Int("index", lineIndex).Msg("no closest index available in index")
+		}
+	}
+	seek := r.line < 0 || r.line > lineIndex || r.line < startLine
+	if seek {
+		if r.fileIndexSummary != nil {
+			r.logger.Debug().
+				Int("index", lineIndex).
+				Int("closest_index", startLine).
+				Int64("start", start).
+				Msg("closest index available in index")
+		}
+		r.reader.Reset(newSectionReader(r.file, start))
+		r.line = startLine
+	}
+	// Reading the line the reader is positioned at is not a lookup, such as the following lines of a range
+	if distance := lineIndex - r.line; seek || distance > 0 {
+		result := metrics.IndexMiss
+		if hit {
+			result = metrics.IndexHit
+		}
+		metrics.IndexLookups.WithLabelValues(result).Inc()
+		metrics.IndexScanDistance.Observe(float64(distance))
+	}
+	return skipLines(r.reader, r.delimiter, lineIndex-r.line)
+}
@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/dataset"
+	"github.com/renanrv/line-server/pkg/metrics"
+	"github.com/renanrv/line-server/services/server"
+	"github.com/rs/zerolog"
+)
+
+// streamBufferSize defines the size of the buffer of a streamed response,
+// which is flushed to the client whenever it is full.
+const streamBufferSize = 32 * 1024
+
+// GetV0Lines streams the contiguous range of lines from the start line index.
+// The start line is sought once, using the index if it is available, and the following lines are read forward.
+// The range is truncated at the end of the file, while a start line beyond the end of the file returns 413.
+func (h Handler) GetV0Lines(ctx context.Context, request server.GetV0LinesRequestObject,
+) (server.GetV0LinesResponseObject, error) {
+	start := request.Params.Start
+	end, err := rangeEnd(request.Params)
+	if err != nil {
+		return server.GetV0Lines400TextResponse(err.Error()), nil
+	}
+	format := server.GetV0LinesParamsFormatJson
+	if request.Params.Format != nil {
+		format = *request.Params.Format
+	}
+	switch format {
+	case server.GetV0LinesParamsFormatJson, server.GetV0LinesParamsFormatNdjson, server.GetV0LinesParamsFormatText:
+	default:
+		return server.GetV0Lines400TextResponse(fmt.Sprintf("invalid format %q", format)), nil
+	}
+
+	// The version of the file is released once the lines are streamed, unless the range cannot be streamed
+	version, err := h.Dataset.Acquire()
+	if err != nil {
+		return nil, err
+	}
+	streaming := false
+	defer func() {
+		if !streaming {
+			version.Release()
+		}
+	}()
+	reader, err := h.newLineReader(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if !streaming {
+			reader.close()
+		}
+	}()
+	// The first line is read before responding, so its errors are reported with the status of the response
+	first, err := reader.readLine(start)
+	switch {
+	case err == io.EOF:
+		return server.GetV0Lines413Response{}, nil
+	case errors.Is(err, ErrLineTooLong):
+		return server.GetV0Lines422TextResponse(
+			fmt.Sprintf("%s of %d bytes", ErrLineTooLong.Error(), h.MaxLineSize)), nil
+	case err != nil:
+		return nil, err
+	}
+	streaming = true
+	return linesRangeResponse{
+		logger:  h.Logger,
+		version: version,
+		reader:  reader,
+		format:  format,
+		first:   first,
+		start:   start,
+		end:     end,
+	}, nil
+}
+
+// rangeEnd validates the range parameters and returns the line index following the last line of the range.
+func rangeEnd(params server.GetV0LinesParams) (int, error) {
+	switch {
+	case params.Count != nil && params.End != nil:
+		return 0, errors.New("count and end cannot be used together")
+	case params.Count != nil:
+		if *params.Count <= 0 {
+			return 0, errors.New("count must be greater than 0")
+		}
+		// The range is truncated at the end of the file, so the end is clamped instead of overflowing
+		if params.Start > 0 && *params.Count > math.MaxInt-params.Start {
+			return math.MaxInt, nil
+		}
+		return params.Start + *params.Count, nil
+	case params.End != nil:
+		if *params.End <= params.Start {
+			return 0, errors.New("end must be greater than start")
+		}
+		return *params.End, nil
+	default:
+		return 0, errors.New("either count or end is required")
+	}
+}
+
+// linesRangeResponse streams the lines of a range, whose first line was already read.
+// The lines are written through a buffer that is flushed to the client whenever it is full,
+// so large ranges are not held in memory.
+type linesRangeResponse struct {
+	logger  *zerolog.Logger
+	version *dataset.Version
+	reader  *lineReader
+	format  server.GetV0LinesParamsFormat
+	first   string
+	start   int
+	end     int
+}
+
+// VisitGetV0LinesResponse writes the lines of the range in the requested format.
+// Once the response started, errors cannot be reported with its status, so the lines exceeding the maximum line size
+// are written as line_too_long markers, as in batches, and the response is aborted on the other errors,
+// or on a line too long of the text format, for the client to notice it is incomplete.
+func (response linesRangeResponse) VisitGetV0LinesResponse(w http.ResponseWriter) error {
+	defer func() {
+		response.reader.close()
+		response.version.Release()
+	}()
+	switch response.format {
+	case server.GetV0LinesParamsFormatNdjson:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	case server.GetV0LinesParamsFormatText:
+		w.Header().Set("Content-Type", "text/plain")
+	default:
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(http.StatusOK)
+
+	writer := bufio.NewWriterSize(flushWriter{writer: w, controller: http.NewResponseController(w)}, streamBufferSize)
+	if response.format == server.GetV0LinesParamsFormatJson {
+		_ = writer.WriteByte('[')
+	}
+	line, tooLong := response.first, false
+	for lineIndex := response.start; ; {
+		if err := response.writeLine(writer, lineIndex, line, tooLong); err != nil {
+			return errors.Wrap(err, "failed to write lines")
+		}
+		if !tooLong {
+			metrics.LinesServed.WithLabelValues("range").Inc()
+		}
+		lineIndex++
+		if lineIndex >= response.end {
+			break
+		}
+		var err error
+		line, err = response.reader.readLine(lineIndex)
+		if err == io.EOF {
+			break
+		}
+		// The lines of the text format are not encoded, so a marker could not be told apart from a line
+		tooLong = errors.Is(err, ErrLineTooLong) && response.format != server.GetV0LinesParamsFormatText
+		if err != nil && !tooLong {
+			response.logger.Error().Err(err).Int("index", lineIndex).Msg("failed to stream lines range")
+			panic(http.ErrAbortHandler)
+		}
+	}
+	if response.format == server.GetV0LinesParamsFormatJson {
+		_, _ = writer.WriteString("]\n")
+	}
+	if err := writer.Flush(); err != nil {
+		return errors.Wrap(err, "failed to write lines")
+	}
+	return nil
+}
+
+// writeLine writes a line of the range in the requested format, or the marker of a line too long,
+// which is a batch line object with the line_too_long status instead of the JSON encoded line.
+func (response linesRangeResponse) writeLine(writer *bufio.Writer, lineIndex int, line string, tooLong bool) error {
+	if response.format == server.GetV0LinesParamsFormatText {
+		_, _ = writer.WriteString(line)
+		return writer.WriteByte('\n')
+	}
+	if response.format == server.GetV0LinesParamsFormatJson && lineIndex > response.start {
+		_ = writer.WriteByte(',')
+	}
+	var value any = line
+	if tooLong {
+		value = server.BatchLine{LineIndex: lineIndex, Status: server.LineTooLong}
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, _ = writer.Write(encoded)
+	if response.format == server.GetV0LinesParamsFormatNdjson {
+		return writer.WriteByte('\n')
+	}
+	return nil
+}
+
+// flushWriter flushes every write to the client, if the response writer supports flushing.
+type flushWriter struct {
+	writer     io.Writer
+	controller *http.ResponseController
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.writer.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if err := f.controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return n, err
+	}
+	return n, nil
+}
@@ -0,0 +1,187 @@
+//go:build unit
+
+package handler_test
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/utils"
+	"github.com/renanrv/line-server/services/handler"
+	"github.com/renanrv/line-server/services/server"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_GetV0Lines(t *testing.T) {
+	content := "line0\nline1\n\"line2\"\nline3\nline4\n"
+	logger := zerolog.New(nil)
+	file := utils.CreateTempFile(t, content)
+	fileIndexSummary, err := fileprocessing.GenerateIndex(&logger, file.Name(), 2, fileprocessing.IndexOptions{})
+	assert.Nil(t, err)
+
+	intPtr := func(value int) *int {
+		return &value
+	}
+	formatPtr := func(format server.GetV0LinesParamsFormat) *server.GetV0LinesParamsFormat {
+		return &format
+	}
+	tests := []struct {
+		name                string
+		params              server.GetV0LinesParams
+		expectedContentType string
+		expectedBody        string
+		expectedResponse    server.GetV0LinesResponseObject
+	}{
+		{
+			name:                "Range with count as JSON",
+			params:              server.GetV0LinesParams{Start: 1, Count: intPtr(3)},
+			expectedContentType: "application/json",
+			expectedBody:        "[\"line1\",\"\\\"line2\\\"\",\"line3\"]\n",
+		},
+		{
+			name:                "Range with end as NDJSON",
+			params:              server.GetV0LinesParams{Start: 2, End: intPtr(4), Format: formatPtr("ndjson")},
+			expectedContentType: "application/x-ndjson",
+			expectedBody:        "\"\\\"line2\\\"\"\n\"line3\"\n",
+		},
+		{
+			name:                "Range as text",
+			params:              server.GetV0LinesParams{Start: 0, Count: intPtr(2), Format: formatPtr("text")},
+			expectedContentType: "text/plain",
+			expectedBody:        "line0\nline1\n",
+		},
+		{
+			name:                "Range truncated at the end of the file",
+			params:              server.GetV0LinesParams{Start: 3, Count: intPtr(10)},
+			expectedContentType: "application/json",
+			expectedBody:        "[\"line3\",\"line4\"]\n",
+		},
+		{
+			name:                "Range with the largest count truncated at the end of the file",
+			params:              server.GetV0LinesParams{Start: 3, Count: intPtr(math.MaxInt)},
+			expectedContentType: "application/json",
+			expectedBody:        "[\"line3\",\"line4\"]\n",
+		},
+		{
+			name:             "Start beyond the end of the file",
+			params:           server.GetV0LinesParams{Start: 5, Count: intPtr(1)},
+			expectedResponse: server.GetV0Lines413Response{},
+		},
+		{
+			name:             "Negative start",
+			params:           server.GetV0LinesParams{Start: -1, Count: intPtr(1)},
+			expectedResponse: server.GetV0Lines413Response{},
+		},
+		{
+			name:             "Missing count and end",
+			params:           server.GetV0LinesParams{Start: 0},
+			expectedResponse: server.GetV0Lines400TextResponse("either count or end is required"),
+		},
+		{
+			name:             "Count and end",
+			params:           server.GetV0LinesParams{Start: 0, Count: intPtr(1), End: intPtr(1)},
+			expectedResponse: server.GetV0Lines400TextResponse("count and end cannot be used together"),
+		},
+		{
+			name:             "Invalid count",
+			params:           server.GetV0LinesParams{Start: 0, Count: intPtr(0)},
+			expectedResponse: server.GetV0Lines400TextResponse("count must be greater than 0"),
+		},
+		{
+			name:             "Invalid end",
+			params:           server.GetV0LinesParams{Start: 2, End: intPtr(2)},
+			expectedResponse: server.GetV0Lines400TextResponse("end must be greater than start"),
+		},
+		{
+			name:             "Invalid format",
+			params:           server.GetV0LinesParams{Start: 0, Count: intPtr(1), Format: formatPtr("xml")},
+			expectedResponse: server.GetV0Lines400TextResponse("invalid format \"xml\""),
+		},
+	}
+	for _, tt := range tests {
+		for _, index := range []struct {
+			name             string
+			fileIndexSummary *fileprocessing.FileIndexSummary
+		}{
+			{name: "without file index summary"},
+			{name: "with file index summary", fileIndexSummary: fileIndexSummary},
+		} {
+			t.Run(tt.name+" "+index.name, func(t *testing.T) {
+				h, err := handler.New(&logger, file.Name(), fileprocessing.NewIndexHolder(index.fileIndexSummary),
+					handler.Options{})
+				assert.Nil(t, err)
+				response, err := h.GetV0Lines(context.Background(), server.GetV0LinesRequestObject{Params: tt.params})
+				assert.Nil(t, err)
+				if tt.expectedResponse != nil {
+					assert.Equal(t, tt.expectedResponse, response)
+					return
+				}
+				recorder := httptest.NewRecorder()
+				assert.Nil(t, response.VisitGetV0LinesResponse(recorder))
+				assert.Equal(t, http.StatusOK, recorder.Code)
+				assert.Equal(t, tt.expectedContentType, recorder.Header().Get("Content-Type"))
+				assert.Equal(t, tt.expectedBody, recorder.Body.String())
+				assert.True(t, recorder.Flushed)
+			})
+		}
+	}
+}
+
+func TestHandler_GetV0Lines_LineTooLong(t *testing.T) {
+	content := strings.Repeat("a", 2048) + "\nline1\n" + strings.Repeat("b", 2048) + "\nline3\n"
+	logger := zerolog.New(nil)
+	file := utils.CreateTempFile(t, content)
+	h, err := handler.New(&logger, file.Name(), nil, handler.Options{MaxLineSize: 1024})
+	assert.Nil(t, err)
+	count := 3
+
+	// A start line too long is reported with the status of the response
+	response, err := h.GetV0Lines(context.Background(), server.GetV0LinesRequestObject{
+		Params: server.GetV0LinesParams{Start: 0, Count: &count},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, server.GetV0Lines422TextResponse("line exceeds the maximum line size of 1024 bytes"), response)
+
+	// Once the response started, a line too long is written as a marker, and the following lines are still streamed
+	tests := []struct {
+		format       server.GetV0LinesParamsFormat
+		expectedBody string
+	}{
+		{
+			format:       server.GetV0LinesParamsFormatJson,
+			expectedBody: `["line1",{"line_index":2,"status":"line_too_long"},"line3"]` + "\n",
+		},
+		{
+			format:       server.GetV0LinesParamsFormatNdjson,
+			expectedBody: "\"line1\"\n" + `{"line_index":2,"status":"line_too_long"}` + "\n\"line3\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			response, err := h.GetV0Lines(context.Background(), server.GetV0LinesRequestObject{
+				Params: server.GetV0LinesParams{Start: 1, Count: &count, Format: &tt.format},
+			})
+			assert.Nil(t, err)
+			rw := httptest.NewRecorder()
+			assert.Nil(t, response.VisitGetV0LinesResponse(rw))
+			assert.Equal(t, http.StatusOK, rw.Code)
+			assert.Equal(t, tt.expectedBody, rw.Body.String())
+		})
+	}
+
+	// The lines of the text format are not encoded, so a line too long aborts the response
+	format := server.GetV0LinesParamsFormatText
+	response, err = h.GetV0Lines(context.Background(), server.GetV0LinesRequestObject{
+		Params: server.GetV0LinesParams{Start: 1, Count: &count, Format: &format},
+	})
+	assert.Nil(t, err)
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		_ = response.VisitGetV0LinesResponse(httptest.NewRecorder())
+	})
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/renanrv/line-server/pkg/middlewares"
+	"github.com/renanrv/line-server/services/server"
+	"github.com/rs/zerolog"
+)
+
+// operationScopes maps the operations of the server API to the scope they require.
+// Operations missing from the map require the admin scope.
+var operationScopes = map[string]string{
+	"GetV0LinesLineIndex":             middlewares.ScopeReadLines,
+	"PostV0LinesBatch":                middlewares.ScopeReadLines,
+	"GetV0File":                       middlewares.ScopeReadLines,
+	"GetV0Datasets":                   middlewares.ScopeReadLines,
+	"GetV0DatasetsNameLinesLineIndex": middlewares.ScopeReadLines,
+	"GetV0Lines":                      middlewares.ScopeReadRange,
+	"GetV0LinesStream":                middlewares.ScopeReadRange,
+}
+
+// ScopeMiddleware enforces the scope required by each operation, responding with an HTTP 403 status
+// if the authenticated principal is not granted it.
+// Requests without a principal are allowed, as authentication is disabled.
+func ScopeMiddleware(l *zerolog.Logger) server.StrictMiddlewareFunc {
+	return func(f server.StrictHandlerFunc, operationID string) server.StrictHandlerFunc {
+		scope, ok := operationScopes[operationID]
+		if !ok {
+			scope = middlewares.ScopeAdmin
+		}
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request, request interface{}) (interface{},
+			error,
+		) {
+			principal := middlewares.PrincipalFromContext(ctx)
+			if principal == nil || principal.HasScope(scope) {
+				return f(ctx, w, r, request)
+			}
+			l.Debug().
+				Str("principal", principal.Name).
+				Str("operation", operationID).
+				Str("scope", scope).
+				Msg("principal not granted the scope of the operation")
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = fmt.Fprintf(w, "the %s scope is required", scope)
+			return nil, nil
+		}
+	}
+}
@@ -0,0 +1,58 @@
+//go:build unit
+
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/renanrv/line-server/pkg/middlewares"
+	"github.com/renanrv/line-server/pkg/utils"
+	"github.com/renanrv/line-server/services/handler"
+	"github.com/renanrv/line-server/services/server"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopeMiddleware(t *testing.T) {
+	logger := zerolog.New(nil)
+	file := utils.CreateTempFile(t, "line1\nline2\nline3\n")
+	h, err := handler.New(&logger, file.Name(), nil, handler.Options{})
+	assert.Nil(t, err)
+	router := http.NewServeMux()
+	server.HandlerWithOptions(
+		server.NewStrictHandler(h, []server.StrictMiddlewareFunc{handler.ScopeMiddleware(&logger)}),
+		server.StdHTTPServerOptions{BaseRouter: router})
+
+	reader := &middlewares.Principal{Name: "reader", Scopes: []string{middlewares.ScopeReadLines}}
+	admin := &middlewares.Principal{Name: "admin", Scopes: []string{middlewares.ScopeAdmin}}
+	tests := []struct {
+		name           string
+		path           string
+		principal      *middlewares.Principal
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Authentication disabled", path: "/v0/lines?start=0&count=2", expectedStatus: http.StatusOK},
+		{name: "Granted scope", path: "/v0/lines/1", principal: reader, expectedStatus: http.StatusOK},
+		{name: "Missing scope", path: "/v0/lines?start=0&count=2", principal: reader,
+			expectedStatus: http.StatusForbidden, expectedBody: "the read-range scope is required"},
+		{name: "Admin scope", path: "/v0/lines?start=0&count=2", principal: admin, expectedStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.principal != nil {
+				req = req.WithContext(middlewares.WithPrincipal(req.Context(), tt.principal))
+			}
+			rw := httptest.NewRecorder()
+			router.ServeHTTP(rw, req)
+
+			assert.Equal(t, tt.expectedStatus, rw.Code)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, rw.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/metrics"
+	"github.com/renanrv/line-server/services/server"
+)
+
+// streamPollInterval defines how often a stream checks for lines appended to the file,
+// besides being notified of the reloads of the dataset.
+const streamPollInterval = time.Second
+
+// streamKeepAliveInterval defines how often a comment is sent to an idle stream,
+// so proxies do not close the connection.
+const streamKeepAliveInterval = 15 * time.Second
+
+// errFileReplaced is returned when the followed version of the file was replaced by a new one.
+var errFileReplaced = errors.New("file was replaced")
+
+// GetV0LinesStream streams the lines from the from line index as Server-Sent Events, and then keeps following
+// the file, pushing each line appended to it. The line index of each line is its event ID, so reconnecting clients
+// resume after the line of the Last-Event-ID header.
+func (h Handler) GetV0LinesStream(ctx context.Context, request server.GetV0LinesStreamRequestObject,
+) (server.GetV0LinesStreamResponseObject, error) {
+	from := 0
+	if request.Params.From != nil {
+		from = *request.Params.From
+	}
+	if request.Params.LastEventID != nil {
+		from = *request.Params.LastEventID + 1
+	}
+	if from < 0 {
+		return server.GetV0LinesStream400TextResponse("from cannot be negative"), nil
+	}
+	return linesStreamResponse{
+		ctx:  ctx,
+		tail: &lineTail{handler: h, from: from},
+	}, nil
+}
+
+// linesStreamResponse streams the lines of the file as Server-Sent Events until the client disconnects,
+// or until the file is replaced, for the client to reconnect to the new file.
+type linesStreamResponse struct {
+	ctx  context.Context
+	tail *lineTail
+}
+
+// VisitGetV0LinesStreamResponse writes the lines available in the file, and then waits for lines to be appended.
+// Once the response started, errors cannot be reported with its status,
+// so the response is aborted for the client to notice it is incomplete.
+func (response linesStreamResponse) VisitGetV0LinesStreamResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	// The headers are sent right away, as no line may be available until lines are appended
+	controller := http.NewResponseController(w)
+	if err := controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return errors.Wrap(err, "failed to write lines")
+	}
+
+	writer := bufio.NewWriterSize(flushWriter{writer: w, controller: controller}, streamBufferSize)
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+	lastWrite := time.Now()
+	for {
+		// The notification channel is taken before reading, so a change while reading is not missed
+		changed := response.tail.handler.Dataset.Changed()
+		sent, err := response.tail.follow(response.ctx, writer)
+		if errors.Is(err, errFileReplaced) {
+			return errors.Wrap(writer.Flush(), "failed to write lines")
+		}
+		if err != nil {
+			response.tail.handler.Logger.Error().Err(err).Int("index", response.tail.line).
+				Msg("failed to stream lines")
+			panic(http.ErrAbortHandler)
+		}
+		if sent == 0 && time.Since(lastWrite) >= streamKeepAliveInterval {
+			_, _ = writer.WriteString(": keep-alive\n\n")
+			sent++
+		}
+		if sent > 0 {
+			if err := writer.Flush(); err != nil {
+				return errors.Wrap(err, "failed to write lines")
+			}
+			lastWrite = time.Now()
+		}
+		select {
+		case <-response.ctx.Done():
+			return nil
+		case <-changed:
+		case <-ticker.C:
+		}
+	}
+}
+
+// lineTail follows the lines of a version of the file by their byte offset, so the lines appended to the file
+// are read from where the previous ones ended, without seeking them again.
+type lineTail struct {
+	handler Handler
+	// from is the line index of the first streamed line, the previous lines being skipped
+	from int
+	// version is the ID of the followed version of the file, once positioned
+	version    uint64
+	positioned bool
+	// line is the line index of the next line to read, which starts at the offset
+	line   int
+	offset int64
+}
+
+// follow writes the lines terminated since the previous call as events, returning the number of written events.
+// A descriptor is only checked out while reading, so idle streams do not hold the descriptors of the file.
+// It returns errFileReplaced once the followed version of the file is replaced.
+func (t *lineTail) follow(ctx context.Context, writer *bufio.Writer) (int, error) {
+	version, err := t.handler.Dataset.Acquire()
+	if err != nil {
+		return 0, err
+	}
+	defer version.Release()
+	if t.positioned && version.ID != t.version {
+		return 0, errFileReplaced
+	}
+	reader, err := t.handler.newLineReader(ctx, version)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.close()
+	if !t.positioned {
+		t.line, t.offset = seekFileLine(reader.fileIndexSummary, t.from)
+		t.version, t.positioned = version.ID, true
+	}
+	reader.reader.Reset(newSectionReader(reader.file, t.offset))
+	sent := 0
+	for {
+		line, size, err := readTerminatedLine(reader.reader, t.handler.Delimiter, t.handler.MaxLineSize, t.line < t.from)
+		if err == io.EOF {
+			// The last line may be partially written, so it is read again from its offset once it is terminated
+			return sent, nil
+		}
+		if err != nil && !errors.Is(err, ErrLineTooLong) {
+			return sent, err
+		}
+		lineIndex := t.line
+		t.line++
+		t.offset += size
+		if lineIndex < t.from {
+			continue
+		}
+		event := ""
+		if err != nil {
+			event = "line_too_long"
+			line = fmt.Sprintf("%s of %d bytes", ErrLineTooLong.Error(), t.handler.MaxLineSize)
+		}
+		if err := writeEvent(writer, event, lineIndex, line); err != nil {
+			return sent, errors.Wrap(err, "failed to write lines")
+		}
+		metrics.LinesServed.WithLabelValues("stream").Inc()
+		sent++
+	}
+}
+
+// seekFileLine returns the closest indexed line preceding the line index, and its byte offset.
+// Without a file index summary, the file is followed from its beginning.
+func seekFileLine(fileIndexSummary *fileprocessing.FileIndexSummary, lineIndex int) (int, int64) {
+	if fileIndexSummary == nil {
+		return 0, 0
+	}
+	// The line may be beyond the indexed lines, which are then followed from the last checkpoint
+	line, offset, ok := fileIndexSummary.Checkpoint(min(lineIndex, fileIndexSummary.NumberOfLines-1))
+	if !ok {
+		return 0, 0
+	}
+	return line, offset
+}
+
+// readTerminatedLine reads the next line from the reader, returning it without its line terminator
+// along with its size in bytes including the terminator.
+// A line that is not terminated yet is reported with io.EOF, as it may be partially written.
+// Lines exceeding maxLineSize are read entirely and reported with ErrLineTooLong, and skipped lines are not kept.
+func readTerminatedLine(reader *bufio.Reader, delimiter fileprocessing.Delimiter, maxLineSize int, skip bool,
+) (string, int64, error) {
+	var line []byte
+	size := int64(0)
+	tooLong := false
+	for {
+		chunk, err := reader.ReadSlice(delimiter.Terminator())
+		size += int64(len(chunk))
+		if !skip && !tooLong {
+			line = append(line, chunk...)
+			// The carriage return of CRLF may still be trimmed, so one more byte is allowed until the terminator
+			if len(line) > maxLineSize+1 {
+				line, tooLong = nil, true
+			}
+		}
+		switch {
+		case err == nil:
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF:
+			return "", 0, io.EOF
+		default:
+			return "", 0, errors.Wrap(err, "error reading file")
+		}
+		if skip {
+			return "", size, nil
+		}
+		line = delimiter.Trim(line)
+		if tooLong || len(line) > maxLineSize {
+			return "", size, ErrLineTooLong
+		}
+		return string(line), size, nil
+	}
+}
+
+// writeEvent writes an event of the type, or a message event if empty, whose ID is the line index
+// and whose data is the JSON encoded text, as lines may contain the line breaks separating the fields of the events.
+func writeEvent(writer *bufio.Writer, event string, lineIndex int, text string) error {
+	if event != "" {
+		_, _ = writer.WriteString("event: " + event + "\n")
+	}
+	encoded, err := json.Marshal(text)
+	if err != nil {
+		return err
+	}
+	_, _ = writer.WriteString("id: " + strconv.Itoa(lineIndex) + "\ndata: ")
+	_, _ = writer.Write(encoded)
+	_, err = writer.WriteString("\n\n")
+	return err
+}
@@ -0,0 +1,173 @@
+//go:build unit
+
+package handler_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/renanrv/line-server/pkg/dataset"
+	"github.com/renanrv/line-server/pkg/fileprocessing"
+	"github.com/renanrv/line-server/pkg/source"
+	"github.com/renanrv/line-server/pkg/utils"
+	"github.com/renanrv/line-server/services/handler"
+	"github.com/renanrv/line-server/services/server"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// newStreamServer serves the handler of the dataset of the file, whose appended lines are indexed incrementally
+func newStreamServer(t *testing.T, filePath string, opts handler.Options) (*httptest.Server, *dataset.Dataset) {
+	t.Helper()
+	logger := zerolog.New(nil)
+	indexOptions := fileprocessing.IndexOptions{Delimiter: opts.Delimiter}
+	buildIndex := func(src source.LineSource) (*fileprocessing.FileIndexSummary, error) {
+		return fileprocessing.GenerateIndexFrom(&logger, src, 2, indexOptions)
+	}
+	fileIndexSummary, err := buildIndex(source.NewLocal(filePath))
+	assert.Nil(t, err)
+	d, err := dataset.New(&logger, filePath, fileprocessing.NewIndexHolder(fileIndexSummary), dataset.Options{
+		BuildIndex: buildIndex,
+		ExtendIndex: func(src source.LineSource, fileIndexSummary *fileprocessing.FileIndexSummary,
+		) (*fileprocessing.FileIndexSummary, error) {
+			return fileprocessing.ExtendIndexFrom(&logger, src, fileIndexSummary, 2, indexOptions)
+		},
+	})
+	assert.Nil(t, err)
+	h, err := handler.NewForDataset(&logger, d, opts)
+	assert.Nil(t, err)
+	s := httptest.NewServer(server.Handler(server.NewStrictHandler(h, nil)))
+	t.Cleanup(s.Close)
+	return s, d
+}
+
+// openStream opens a stream of the lines, returning a reader of its events
+func openStream(t *testing.T, ctx context.Context, url string, lastEventID string) (*http.Response, func() string) {
+	t.Helper()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	assert.Nil(t, err)
+	if lastEventID != "" {
+		request.Header.Set("Last-Event-ID", lastEventID)
+	}
+	response, err := http.DefaultClient.Do(request)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_ = response.Body.Close()
+	})
+	reader := bufio.NewReader(response.Body)
+	// nextEvent reads the lines of the next event, or returns an empty string once the stream ends
+	nextEvent := func() string {
+		var event []string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return strings.Join(event, "\n")
+			}
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				return strings.Join(event, "\n")
+			}
+			event = append(event, line)
+		}
+	}
+	return response, nextEvent
+}
+
+func TestHandler_GetV0LinesStream(t *testing.T) {
+	t.Run("Appended lines", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line0\nline1\nline2\n")
+		s, d := newStreamServer(t, file.Name(), handler.Options{})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		response, nextEvent := openStream(t, ctx, s.URL+"/v0/lines/stream?from=1", "")
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+		assert.Equal(t, "id: 1\ndata: \"line1\"", nextEvent())
+		assert.Equal(t, "id: 2\ndata: \"line2\"", nextEvent())
+
+		// The partially written line is pushed once it is terminated
+		appended, err := os.OpenFile(file.Name(), os.O_APPEND|os.O_WRONLY, 0)
+		assert.Nil(t, err)
+		defer func() {
+			_ = appended.Close()
+		}()
+		_, err = appended.WriteString("\"line3\"\nli")
+		assert.Nil(t, err)
+		assert.Nil(t, d.Reload())
+		assert.Equal(t, "id: 3\ndata: \"\\\"line3\\\"\"", nextEvent())
+		_, err = appended.WriteString("ne4\n")
+		assert.Nil(t, err)
+		assert.Nil(t, d.Reload())
+		assert.Equal(t, "id: 4\ndata: \"line4\"", nextEvent())
+	})
+
+	t.Run("Reconnection with the last event ID", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line0\nline1\nline2\nline3\n")
+		s, _ := newStreamServer(t, file.Name(), handler.Options{})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, nextEvent := openStream(t, ctx, s.URL+"/v0/lines/stream?from=0", "2")
+		assert.Equal(t, "id: 3\ndata: \"line3\"", nextEvent())
+	})
+
+	t.Run("Start beyond the end of the file", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line0\nline1\n")
+		s, d := newStreamServer(t, file.Name(), handler.Options{})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, nextEvent := openStream(t, ctx, s.URL+"/v0/lines/stream?from=3", "")
+
+		appended, err := os.OpenFile(file.Name(), os.O_APPEND|os.O_WRONLY, 0)
+		assert.Nil(t, err)
+		_, err = appended.WriteString("line2\nline3\n")
+		assert.Nil(t, err)
+		assert.Nil(t, appended.Close())
+		assert.Nil(t, d.Reload())
+		assert.Equal(t, "id: 3\ndata: \"line3\"", nextEvent())
+	})
+
+	t.Run("Line too long", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line0\nlong line1\nline2\n")
+		s, _ := newStreamServer(t, file.Name(), handler.Options{MaxLineSize: 5})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, nextEvent := openStream(t, ctx, s.URL+"/v0/lines/stream", "")
+		assert.Equal(t, "id: 0\ndata: \"line0\"", nextEvent())
+		assert.Equal(t,
+			"event: line_too_long\nid: 1\ndata: \"line exceeds the maximum line size of 5 bytes\"", nextEvent())
+		assert.Equal(t, "id: 2\ndata: \"line2\"", nextEvent())
+	})
+
+	t.Run("Replaced file", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line0\n")
+		s, d := newStreamServer(t, file.Name(), handler.Options{})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, nextEvent := openStream(t, ctx, s.URL+"/v0/lines/stream", "")
+		assert.Equal(t, "id: 0\ndata: \"line0\"", nextEvent())
+
+		// The stream ends, for the client to reconnect to the new file
+		newFilePath := filepath.Join(filepath.Dir(file.Name()), "new-"+filepath.Base(file.Name()))
+		assert.Nil(t, os.WriteFile(newFilePath, []byte("new line0\n"), 0o600))
+		assert.Nil(t, os.Rename(newFilePath, file.Name()))
+		assert.Nil(t, d.Reload())
+		assert.Equal(t, "", nextEvent())
+	})
+
+	t.Run("Negative from", func(t *testing.T) {
+		file := utils.CreateTempFile(t, "line0\n")
+		s, _ := newStreamServer(t, file.Name(), handler.Options{})
+		response, err := http.Get(s.URL + "/v0/lines/stream?from=-1")
+		assert.Nil(t, err)
+		defer func() {
+			_ = response.Body.Close()
+		}()
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	})
+}
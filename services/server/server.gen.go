@@ -9,29 +9,289 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/oapi-codegen/runtime"
 	strictnethttp "github.com/oapi-codegen/runtime/strictmiddleware/nethttp"
 )
 
 const (
-	BasicAuthScopes = "BasicAuth.Scopes"
+	ApiKeyAuthScopes = "ApiKeyAuth.Scopes"
+	BasicAuthScopes  = "BasicAuth.Scopes"
+	BearerAuthScopes = "BearerAuth.Scopes"
 )
 
+// Defines values for BatchLineStatus.
+const (
+	Found       BatchLineStatus = "found"
+	LineTooLong BatchLineStatus = "line_too_long"
+	OutOfRange  BatchLineStatus = "out_of_range"
+)
+
+// Defines values for IndexDetailsStatus.
+const (
+	Pending     IndexDetailsStatus = "pending"
+	Ready       IndexDetailsStatus = "ready"
+	Unavailable IndexDetailsStatus = "unavailable"
+)
+
+// Defines values for Format.
+const (
+	FormatJson   Format = "json"
+	FormatNdjson Format = "ndjson"
+	FormatText   Format = "text"
+)
+
+// Defines values for GetV0LinesParamsFormat.
+const (
+	GetV0LinesParamsFormatJson   GetV0LinesParamsFormat = "json"
+	GetV0LinesParamsFormatNdjson GetV0LinesParamsFormat = "ndjson"
+	GetV0LinesParamsFormatText   GetV0LinesParamsFormat = "text"
+)
+
+// BatchLine defines model for BatchLine.
+type BatchLine struct {
+	LineIndex int `json:"line_index"`
+
+	// Status found if the line was read, out_of_range if it is beyond the end of the file, or line_too_long if it exceeds the maximum line size served
+	Status BatchLineStatus `json:"status"`
+
+	// Text Text of the line, only present if the line was found
+	Text *string `json:"text,omitempty"`
+}
+
+// BatchLineStatus found if the line was read, out_of_range if it is beyond the end of the file, or line_too_long if it exceeds the maximum line size served
+type BatchLineStatus string
+
+// BatchLinesRequest defines model for BatchLinesRequest.
+type BatchLinesRequest struct {
+	// LineIndices Line indices to be retrieved, in any order and possibly repeated
+	LineIndices []int `json:"line_indices"`
+}
+
+// BatchLinesResponse defines model for BatchLinesResponse.
+type BatchLinesResponse struct {
+	Lines []BatchLine `json:"lines"`
+}
+
+// DatasetSummary defines model for DatasetSummary.
+type DatasetSummary struct {
+	Index IndexDetails `json:"index"`
+	Name  string       `json:"name"`
+
+	// NumberOfLines Number of lines of the file of the dataset. Only present once its index is ready.
+	NumberOfLines *int `json:"number_of_lines,omitempty"`
+}
+
+// DatasetsResponse defines model for DatasetsResponse.
+type DatasetsResponse struct {
+	// Datasets Datasets sorted by name
+	Datasets []DatasetSummary `json:"datasets"`
+}
+
+// FileResponse defines model for FileResponse.
+type FileResponse struct {
+	// Compression Compression of the file detected from its magic bytes: none, gzip or zstd. The lines of a compressed file are served from its decompressed content, while the size and fingerprint describe the compressed file.
+	Compression string `json:"compression"`
+
+	// Fingerprint SHA-256 fingerprint of the file size and content sampled at its beginning, middle and end
+	Fingerprint string       `json:"fingerprint"`
+	Index       IndexDetails `json:"index"`
+
+	// ModificationTime Modification time of the file
+	ModificationTime time.Time `json:"modification_time"`
+
+	// NumberOfLines Number of lines of the file. Only present once the index is ready, as counting the lines requires scanning the file.
+	NumberOfLines *int `json:"number_of_lines,omitempty"`
+
+	// Size Size of the file in bytes
+	Size int64 `json:"size"`
+}
+
+// IndexDetails defines model for IndexDetails.
+type IndexDetails struct {
+	// BuildDurationMs Time taken to load or generate the index in milliseconds, or elapsed so far while it is pending
+	BuildDurationMs int64 `json:"build_duration_ms"`
+
+	// Checkpoints Number of indexed lines (checkpoints). Only present once the index is ready.
+	Checkpoints *int `json:"checkpoints,omitempty"`
+
+	// IndexOffset Number of lines between consecutive checkpoints. Only present once the index is ready.
+	IndexOffset *int `json:"index_offset,omitempty"`
+
+	// Mode Where the index is stored: memory or mmap. Only present once the index is ready.
+	Mode *string `json:"mode,omitempty"`
+
+	// Status pending while the index is generated, ready once it is available, or unavailable if the file has no index
+	Status IndexDetailsStatus `json:"status"`
+}
+
+// IndexDetailsStatus pending while the index is generated, ready once it is available, or unavailable if the file has no index
+type IndexDetailsStatus string
+
 // LineResponse defines model for LineResponse.
 type LineResponse struct {
 	Text string `json:"text"`
 }
 
+// RangeLine Text of a streamed line, or a batch line with the line_too_long status if it exceeds the maximum line size served
+type RangeLine struct {
+	union json.RawMessage
+}
+
+// RangeLine0 defines model for .
+type RangeLine0 = string
+
+// UnauthorizedResponse defines model for UnauthorizedResponse.
+type UnauthorizedResponse struct {
+	// Message Reason the request is not authenticated
+	Message string `json:"message"`
+}
+
+// Count defines model for Count.
+type Count = int
+
+// DatasetName defines model for DatasetName.
+type DatasetName = string
+
+// End defines model for End.
+type End = int
+
+// Format defines model for Format.
+type Format string
+
+// From defines model for From.
+type From = int
+
+// LastEventID defines model for LastEventID.
+type LastEventID = int
+
 // LineIndex defines model for LineIndex.
 type LineIndex = int
 
+// Start defines model for Start.
+type Start = int
+
+// LinesRangeResponse defines model for LinesRangeResponse.
+type LinesRangeResponse = []RangeLine
+
+// GetV0LinesParams defines parameters for GetV0Lines.
+type GetV0LinesParams struct {
+	// Start Line index of the first line of the range
+	Start Start `form:"start" json:"start"`
+
+	// Count Number of lines of the range. Either count or end is required.
+	Count *Count `form:"count,omitempty" json:"count,omitempty"`
+
+	// End Line index following the last line of the range (exclusive). Either count or end is required.
+	End *End `form:"end,omitempty" json:"end,omitempty"`
+
+	// Format Format of the streamed lines: a JSON array of strings (json), newline-delimited JSON strings (ndjson) or newline-delimited text (text)
+	Format *GetV0LinesParamsFormat `form:"format,omitempty" json:"format,omitempty"`
+}
+
+// GetV0LinesParamsFormat defines parameters for GetV0Lines.
+type GetV0LinesParamsFormat string
+
+// GetV0LinesStreamParams defines parameters for GetV0LinesStream.
+type GetV0LinesStreamParams struct {
+	// From Line index of the first streamed line
+	From *From `form:"from,omitempty" json:"from,omitempty"`
+
+	// LastEventID Line index of the last line received by a reconnecting client, which takes precedence over from
+	LastEventID *LastEventID `json:"Last-Event-ID,omitempty"`
+}
+
+// PostV0LinesBatchJSONRequestBody defines body for PostV0LinesBatch for application/json ContentType.
+type PostV0LinesBatchJSONRequestBody = BatchLinesRequest
+
+// AsRangeLine0 returns the union data inside the RangeLine as a RangeLine0
+func (t RangeLine) AsRangeLine0() (RangeLine0, error) {
+	var body RangeLine0
+	err := json.Unmarshal(t.union, &body)
+	return body, err
+}
+
+// FromRangeLine0 overwrites any union data inside the RangeLine as the provided RangeLine0
+func (t *RangeLine) FromRangeLine0(v RangeLine0) error {
+	b, err := json.Marshal(v)
+	t.union = b
+	return err
+}
+
+// MergeRangeLine0 performs a merge with any union data inside the RangeLine, using the provided RangeLine0
+func (t *RangeLine) MergeRangeLine0(v RangeLine0) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	merged, err := runtime.JSONMerge(t.union, b)
+	t.union = merged
+	return err
+}
+
+// AsBatchLine returns the union data inside the RangeLine as a BatchLine
+func (t RangeLine) AsBatchLine() (BatchLine, error) {
+	var body BatchLine
+	err := json.Unmarshal(t.union, &body)
+	return body, err
+}
+
+// FromBatchLine overwrites any union data inside the RangeLine as the provided BatchLine
+func (t *RangeLine) FromBatchLine(v BatchLine) error {
+	b, err := json.Marshal(v)
+	t.union = b
+	return err
+}
+
+// MergeBatchLine performs a merge with any union data inside the RangeLine, using the provided BatchLine
+func (t *RangeLine) MergeBatchLine(v BatchLine) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	merged, err := runtime.JSONMerge(t.union, b)
+	t.union = merged
+	return err
+}
+
+func (t RangeLine) MarshalJSON() ([]byte, error) {
+	b, err := t.union.MarshalJSON()
+	return b, err
+}
+
+func (t *RangeLine) UnmarshalJSON(b []byte) error {
+	err := t.union.UnmarshalJSON(b)
+	return err
+}
+
 // ServerInterface represents all server handlers.
 type ServerInterface interface {
 
+	// (GET /v0/datasets)
+	GetV0Datasets(w http.ResponseWriter, r *http.Request)
+
+	// (GET /v0/datasets/{name}/lines/{line_index})
+	GetV0DatasetsNameLinesLineIndex(w http.ResponseWriter, r *http.Request, name DatasetName, lineIndex LineIndex)
+
+	// (GET /v0/file)
+	GetV0File(w http.ResponseWriter, r *http.Request)
+
+	// (GET /v0/lines)
+	GetV0Lines(w http.ResponseWriter, r *http.Request, params GetV0LinesParams)
+
+	// (GET /v0/lines/stream)
+	GetV0LinesStream(w http.ResponseWriter, r *http.Request, params GetV0LinesStreamParams)
+
 	// (GET /v0/lines/{line_index})
 	GetV0LinesLineIndex(w http.ResponseWriter, r *http.Request, lineIndex LineIndex)
+
+	// (POST /v0/lines:batch)
+	PostV0LinesBatch(w http.ResponseWriter, r *http.Request)
 }
 
 // ServerInterfaceWrapper converts contexts to parameters.
@@ -43,6 +303,209 @@ type ServerInterfaceWrapper struct {
 
 type MiddlewareFunc func(http.Handler) http.Handler
 
+// GetV0Datasets operation middleware
+func (siw *ServerInterfaceWrapper) GetV0Datasets(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BasicAuthScopes, []string{})
+
+	ctx = context.WithValue(ctx, ApiKeyAuthScopes, []string{})
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetV0Datasets(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// GetV0DatasetsNameLinesLineIndex operation middleware
+func (siw *ServerInterfaceWrapper) GetV0DatasetsNameLinesLineIndex(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "name" -------------
+	var name DatasetName
+
+	err = runtime.BindStyledParameterWithOptions("simple", "name", r.PathValue("name"), &name, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "name", Err: err})
+		return
+	}
+
+	// ------------- Path parameter "line_index" -------------
+	var lineIndex LineIndex
+
+	err = runtime.BindStyledParameterWithOptions("simple", "line_index", r.PathValue("line_index"), &lineIndex, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "line_index", Err: err})
+		return
+	}
+
+	ctx = context.WithValue(ctx, BasicAuthScopes, []string{})
+
+	ctx = context.WithValue(ctx, ApiKeyAuthScopes, []string{})
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetV0DatasetsNameLinesLineIndex(w, r, name, lineIndex)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// GetV0File operation middleware
+func (siw *ServerInterfaceWrapper) GetV0File(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BasicAuthScopes, []string{})
+
+	ctx = context.WithValue(ctx, ApiKeyAuthScopes, []string{})
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetV0File(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// GetV0Lines operation middleware
+func (siw *ServerInterfaceWrapper) GetV0Lines(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	ctx = context.WithValue(ctx, BasicAuthScopes, []string{})
+
+	ctx = context.WithValue(ctx, ApiKeyAuthScopes, []string{})
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetV0LinesParams
+
+	// ------------- Required query parameter "start" -------------
+
+	if paramValue := r.URL.Query().Get("start"); paramValue != "" {
+
+	} else {
+		siw.ErrorHandlerFunc(w, r, &RequiredParamError{ParamName: "start"})
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "start", r.URL.Query(), &params.Start)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "start", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "count" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "count", r.URL.Query(), &params.Count)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "count", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "end" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "end", r.URL.Query(), &params.End)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "end", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "format" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "format", r.URL.Query(), &params.Format)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "format", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetV0Lines(w, r, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// GetV0LinesStream operation middleware
+func (siw *ServerInterfaceWrapper) GetV0LinesStream(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	ctx = context.WithValue(ctx, BasicAuthScopes, []string{})
+
+	ctx = context.WithValue(ctx, ApiKeyAuthScopes, []string{})
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetV0LinesStreamParams
+
+	// ------------- Optional query parameter "from" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "from", r.URL.Query(), &params.From)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "from", Err: err})
+		return
+	}
+
+	headers := r.Header
+
+	// ------------- Optional header parameter "Last-Event-ID" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("Last-Event-ID")]; found {
+		var LastEventID LastEventID
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "Last-Event-ID", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "Last-Event-ID", valueList[0], &LastEventID, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "Last-Event-ID", Err: err})
+			return
+		}
+
+		params.LastEventID = &LastEventID
+
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetV0LinesStream(w, r, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
 // GetV0LinesLineIndex operation middleware
 func (siw *ServerInterfaceWrapper) GetV0LinesLineIndex(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -60,6 +523,10 @@ func (siw *ServerInterfaceWrapper) GetV0LinesLineIndex(w http.ResponseWriter, r
 
 	ctx = context.WithValue(ctx, BasicAuthScopes, []string{})
 
+	ctx = context.WithValue(ctx, ApiKeyAuthScopes, []string{})
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		siw.Handler.GetV0LinesLineIndex(w, r, lineIndex)
 	}))
@@ -71,6 +538,27 @@ func (siw *ServerInterfaceWrapper) GetV0LinesLineIndex(w http.ResponseWriter, r
 	handler.ServeHTTP(w, r.WithContext(ctx))
 }
 
+// PostV0LinesBatch operation middleware
+func (siw *ServerInterfaceWrapper) PostV0LinesBatch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BasicAuthScopes, []string{})
+
+	ctx = context.WithValue(ctx, ApiKeyAuthScopes, []string{})
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostV0LinesBatch(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
 type UnescapedCookieParamError struct {
 	ParamName string
 	Err       error
@@ -185,20 +673,357 @@ func HandlerWithOptions(si ServerInterface, options StdHTTPServerOptions) http.H
 		ErrorHandlerFunc:   options.ErrorHandlerFunc,
 	}
 
+	m.HandleFunc("GET "+options.BaseURL+"/v0/datasets", wrapper.GetV0Datasets)
+	m.HandleFunc("GET "+options.BaseURL+"/v0/datasets/{name}/lines/{line_index}", wrapper.GetV0DatasetsNameLinesLineIndex)
+	m.HandleFunc("GET "+options.BaseURL+"/v0/file", wrapper.GetV0File)
+	m.HandleFunc("GET "+options.BaseURL+"/v0/lines", wrapper.GetV0Lines)
+	m.HandleFunc("GET "+options.BaseURL+"/v0/lines/stream", wrapper.GetV0LinesStream)
 	m.HandleFunc("GET "+options.BaseURL+"/v0/lines/{line_index}", wrapper.GetV0LinesLineIndex)
+	m.HandleFunc("POST "+options.BaseURL+"/v0/lines:batch", wrapper.PostV0LinesBatch)
 
 	return m
 }
 
 type BadRequestResponseTextResponse string
 
-type LineResponseJSONResponse LineResponse
+type BatchBadRequestResponseTextResponse string
 
-type RequestEntityTooLargeResponseResponse struct {
-}
+type BatchLinesResponseJSONResponse BatchLinesResponse
 
-type UnauthorizedResponseResponse struct {
-}
+type DatasetNotFoundResponseTextResponse string
+
+type DatasetsResponseJSONResponse DatasetsResponse
+
+type FileResponseJSONResponse FileResponse
+
+type ForbiddenResponseTextResponse string
+
+type LineResponseJSONResponse LineResponse
+
+type LineTooLongResponseTextResponse string
+
+type LinesRangeResponseJSONResponse []RangeLine
+type LinesRangeResponseApplicationxNdjsonResponse struct {
+	Body io.Reader
+
+	ContentLength int64
+}
+type LinesRangeResponseTextResponse string
+
+type LinesStreamResponseTexteventStreamResponse struct {
+	Body io.Reader
+
+	ContentLength int64
+}
+
+type RangeBadRequestResponseTextResponse string
+
+type RequestEntityTooLargeResponseResponse struct {
+}
+
+type StreamBadRequestResponseTextResponse string
+
+type UnauthorizedResponseJSONResponse UnauthorizedResponse
+
+type GetV0DatasetsRequestObject struct {
+}
+
+type GetV0DatasetsResponseObject interface {
+	VisitGetV0DatasetsResponse(w http.ResponseWriter) error
+}
+
+type GetV0Datasets200JSONResponse struct{ DatasetsResponseJSONResponse }
+
+func (response GetV0Datasets200JSONResponse) VisitGetV0DatasetsResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GetV0Datasets401JSONResponse struct {
+	UnauthorizedResponseJSONResponse
+}
+
+func (response GetV0Datasets401JSONResponse) VisitGetV0DatasetsResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(401)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GetV0Datasets403TextResponse string
+
+func (response GetV0Datasets403TextResponse) VisitGetV0DatasetsResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(403)
+
+	_, err := w.Write([]byte(response))
+	return err
+}
+
+type GetV0DatasetsNameLinesLineIndexRequestObject struct {
+	Name      DatasetName `json:"name"`
+	LineIndex LineIndex   `json:"line_index"`
+}
+
+type GetV0DatasetsNameLinesLineIndexResponseObject interface {
+	VisitGetV0DatasetsNameLinesLineIndexResponse(w http.ResponseWriter) error
+}
+
+type GetV0DatasetsNameLinesLineIndex200JSONResponse struct{ LineResponseJSONResponse }
+
+func (response GetV0DatasetsNameLinesLineIndex200JSONResponse) VisitGetV0DatasetsNameLinesLineIndexResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GetV0DatasetsNameLinesLineIndex400TextResponse string
+
+func (response GetV0DatasetsNameLinesLineIndex400TextResponse) VisitGetV0DatasetsNameLinesLineIndexResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(400)
+
+	_, err := w.Write([]byte(response))
+	return err
+}
+
+type GetV0DatasetsNameLinesLineIndex401JSONResponse struct {
+	UnauthorizedResponseJSONResponse
+}
+
+func (response GetV0DatasetsNameLinesLineIndex401JSONResponse) VisitGetV0DatasetsNameLinesLineIndexResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(401)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GetV0DatasetsNameLinesLineIndex403TextResponse string
+
+func (response GetV0DatasetsNameLinesLineIndex403TextResponse) VisitGetV0DatasetsNameLinesLineIndexResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(403)
+
+	_, err := w.Write([]byte(response))
+	return err
+}
+
+type GetV0DatasetsNameLinesLineIndex404TextResponse string
+
+func (response GetV0DatasetsNameLinesLineIndex404TextResponse) VisitGetV0DatasetsNameLinesLineIndexResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(404)
+
+	_, err := w.Write([]byte(response))
+	return err
+}
+
+type GetV0DatasetsNameLinesLineIndex413Response = RequestEntityTooLargeResponseResponse
+
+func (response GetV0DatasetsNameLinesLineIndex413Response) VisitGetV0DatasetsNameLinesLineIndexResponse(w http.ResponseWriter) error {
+	w.WriteHeader(413)
+	return nil
+}
+
+type GetV0DatasetsNameLinesLineIndex422TextResponse string
+
+func (response GetV0DatasetsNameLinesLineIndex422TextResponse) VisitGetV0DatasetsNameLinesLineIndexResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(422)
+
+	_, err := w.Write([]byte(response))
+	return err
+}
+
+type GetV0FileRequestObject struct {
+}
+
+type GetV0FileResponseObject interface {
+	VisitGetV0FileResponse(w http.ResponseWriter) error
+}
+
+type GetV0File200JSONResponse struct{ FileResponseJSONResponse }
+
+func (response GetV0File200JSONResponse) VisitGetV0FileResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GetV0File401JSONResponse struct {
+	UnauthorizedResponseJSONResponse
+}
+
+func (response GetV0File401JSONResponse) VisitGetV0FileResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(401)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GetV0File403TextResponse string
+
+func (response GetV0File403TextResponse) VisitGetV0FileResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(403)
+
+	_, err := w.Write([]byte(response))
+	return err
+}
+
+type GetV0LinesRequestObject struct {
+	Params GetV0LinesParams
+}
+
+type GetV0LinesResponseObject interface {
+	VisitGetV0LinesResponse(w http.ResponseWriter) error
+}
+
+type GetV0Lines200JSONResponse struct{ LinesRangeResponseJSONResponse }
+
+func (response GetV0Lines200JSONResponse) VisitGetV0LinesResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GetV0Lines200ApplicationxNdjsonResponse struct {
+	LinesRangeResponseApplicationxNdjsonResponse
+}
+
+func (response GetV0Lines200ApplicationxNdjsonResponse) VisitGetV0LinesResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	if response.ContentLength != 0 {
+		w.Header().Set("Content-Length", fmt.Sprint(response.ContentLength))
+	}
+	w.WriteHeader(200)
+
+	if closer, ok := response.Body.(io.ReadCloser); ok {
+		defer closer.Close()
+	}
+	_, err := io.Copy(w, response.Body)
+	return err
+}
+
+type GetV0Lines200TextResponse string
+
+func (response GetV0Lines200TextResponse) VisitGetV0LinesResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(200)
+
+	_, err := w.Write([]byte(response))
+	return err
+}
+
+type GetV0Lines400TextResponse string
+
+func (response GetV0Lines400TextResponse) VisitGetV0LinesResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(400)
+
+	_, err := w.Write([]byte(response))
+	return err
+}
+
+type GetV0Lines401JSONResponse struct {
+	UnauthorizedResponseJSONResponse
+}
+
+func (response GetV0Lines401JSONResponse) VisitGetV0LinesResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(401)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GetV0Lines403TextResponse string
+
+func (response GetV0Lines403TextResponse) VisitGetV0LinesResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(403)
+
+	_, err := w.Write([]byte(response))
+	return err
+}
+
+type GetV0Lines413Response = RequestEntityTooLargeResponseResponse
+
+func (response GetV0Lines413Response) VisitGetV0LinesResponse(w http.ResponseWriter) error {
+	w.WriteHeader(413)
+	return nil
+}
+
+type GetV0Lines422TextResponse string
+
+func (response GetV0Lines422TextResponse) VisitGetV0LinesResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(422)
+
+	_, err := w.Write([]byte(response))
+	return err
+}
+
+type GetV0LinesStreamRequestObject struct {
+	Params GetV0LinesStreamParams
+}
+
+type GetV0LinesStreamResponseObject interface {
+	VisitGetV0LinesStreamResponse(w http.ResponseWriter) error
+}
+
+type GetV0LinesStream200TexteventStreamResponse struct {
+	LinesStreamResponseTexteventStreamResponse
+}
+
+func (response GetV0LinesStream200TexteventStreamResponse) VisitGetV0LinesStreamResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "text/event-stream")
+	if response.ContentLength != 0 {
+		w.Header().Set("Content-Length", fmt.Sprint(response.ContentLength))
+	}
+	w.WriteHeader(200)
+
+	if closer, ok := response.Body.(io.ReadCloser); ok {
+		defer closer.Close()
+	}
+	_, err := io.Copy(w, response.Body)
+	return err
+}
+
+type GetV0LinesStream400TextResponse string
+
+func (response GetV0LinesStream400TextResponse) VisitGetV0LinesStreamResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(400)
+
+	_, err := w.Write([]byte(response))
+	return err
+}
+
+type GetV0LinesStream401JSONResponse struct {
+	UnauthorizedResponseJSONResponse
+}
+
+func (response GetV0LinesStream401JSONResponse) VisitGetV0LinesStreamResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(401)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GetV0LinesStream403TextResponse string
+
+func (response GetV0LinesStream403TextResponse) VisitGetV0LinesStreamResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(403)
+
+	_, err := w.Write([]byte(response))
+	return err
+}
 
 type GetV0LinesLineIndexRequestObject struct {
 	LineIndex LineIndex `json:"line_index"`
@@ -227,11 +1052,25 @@ func (response GetV0LinesLineIndex400TextResponse) VisitGetV0LinesLineIndexRespo
 	return err
 }
 
-type GetV0LinesLineIndex401Response = UnauthorizedResponseResponse
+type GetV0LinesLineIndex401JSONResponse struct {
+	UnauthorizedResponseJSONResponse
+}
 
-func (response GetV0LinesLineIndex401Response) VisitGetV0LinesLineIndexResponse(w http.ResponseWriter) error {
+func (response GetV0LinesLineIndex401JSONResponse) VisitGetV0LinesLineIndexResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(401)
-	return nil
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GetV0LinesLineIndex403TextResponse string
+
+func (response GetV0LinesLineIndex403TextResponse) VisitGetV0LinesLineIndexResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(403)
+
+	_, err := w.Write([]byte(response))
+	return err
 }
 
 type GetV0LinesLineIndex413Response = RequestEntityTooLargeResponseResponse
@@ -241,11 +1080,87 @@ func (response GetV0LinesLineIndex413Response) VisitGetV0LinesLineIndexResponse(
 	return nil
 }
 
+type GetV0LinesLineIndex422TextResponse string
+
+func (response GetV0LinesLineIndex422TextResponse) VisitGetV0LinesLineIndexResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(422)
+
+	_, err := w.Write([]byte(response))
+	return err
+}
+
+type PostV0LinesBatchRequestObject struct {
+	Body *PostV0LinesBatchJSONRequestBody
+}
+
+type PostV0LinesBatchResponseObject interface {
+	VisitPostV0LinesBatchResponse(w http.ResponseWriter) error
+}
+
+type PostV0LinesBatch200JSONResponse struct{ BatchLinesResponseJSONResponse }
+
+func (response PostV0LinesBatch200JSONResponse) VisitPostV0LinesBatchResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type PostV0LinesBatch400TextResponse string
+
+func (response PostV0LinesBatch400TextResponse) VisitPostV0LinesBatchResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(400)
+
+	_, err := w.Write([]byte(response))
+	return err
+}
+
+type PostV0LinesBatch401JSONResponse struct {
+	UnauthorizedResponseJSONResponse
+}
+
+func (response PostV0LinesBatch401JSONResponse) VisitPostV0LinesBatchResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(401)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type PostV0LinesBatch403TextResponse string
+
+func (response PostV0LinesBatch403TextResponse) VisitPostV0LinesBatchResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(403)
+
+	_, err := w.Write([]byte(response))
+	return err
+}
+
 // StrictServerInterface represents all server handlers.
 type StrictServerInterface interface {
 
+	// (GET /v0/datasets)
+	GetV0Datasets(ctx context.Context, request GetV0DatasetsRequestObject) (GetV0DatasetsResponseObject, error)
+
+	// (GET /v0/datasets/{name}/lines/{line_index})
+	GetV0DatasetsNameLinesLineIndex(ctx context.Context, request GetV0DatasetsNameLinesLineIndexRequestObject) (GetV0DatasetsNameLinesLineIndexResponseObject, error)
+
+	// (GET /v0/file)
+	GetV0File(ctx context.Context, request GetV0FileRequestObject) (GetV0FileResponseObject, error)
+
+	// (GET /v0/lines)
+	GetV0Lines(ctx context.Context, request GetV0LinesRequestObject) (GetV0LinesResponseObject, error)
+
+	// (GET /v0/lines/stream)
+	GetV0LinesStream(ctx context.Context, request GetV0LinesStreamRequestObject) (GetV0LinesStreamResponseObject, error)
+
 	// (GET /v0/lines/{line_index})
 	GetV0LinesLineIndex(ctx context.Context, request GetV0LinesLineIndexRequestObject) (GetV0LinesLineIndexResponseObject, error)
+
+	// (POST /v0/lines:batch)
+	PostV0LinesBatch(ctx context.Context, request PostV0LinesBatchRequestObject) (PostV0LinesBatchResponseObject, error)
 }
 
 type StrictHandlerFunc = strictnethttp.StrictHTTPHandlerFunc
@@ -277,6 +1192,133 @@ type strictHandler struct {
 	options     StrictHTTPServerOptions
 }
 
+// GetV0Datasets operation middleware
+func (sh *strictHandler) GetV0Datasets(w http.ResponseWriter, r *http.Request) {
+	var request GetV0DatasetsRequestObject
+
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request, request interface{}) (interface{}, error) {
+		return sh.ssi.GetV0Datasets(ctx, request.(GetV0DatasetsRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "GetV0Datasets")
+	}
+
+	response, err := handler(r.Context(), w, r, request)
+
+	if err != nil {
+		sh.options.ResponseErrorHandlerFunc(w, r, err)
+	} else if validResponse, ok := response.(GetV0DatasetsResponseObject); ok {
+		if err := validResponse.VisitGetV0DatasetsResponse(w); err != nil {
+			sh.options.ResponseErrorHandlerFunc(w, r, err)
+		}
+	} else if response != nil {
+		sh.options.ResponseErrorHandlerFunc(w, r, fmt.Errorf("unexpected response type: %T", response))
+	}
+}
+
+// GetV0DatasetsNameLinesLineIndex operation middleware
+func (sh *strictHandler) GetV0DatasetsNameLinesLineIndex(w http.ResponseWriter, r *http.Request, name DatasetName, lineIndex LineIndex) {
+	var request GetV0DatasetsNameLinesLineIndexRequestObject
+
+	request.Name = name
+	request.LineIndex = lineIndex
+
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request, request interface{}) (interface{}, error) {
+		return sh.ssi.GetV0DatasetsNameLinesLineIndex(ctx, request.(GetV0DatasetsNameLinesLineIndexRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "GetV0DatasetsNameLinesLineIndex")
+	}
+
+	response, err := handler(r.Context(), w, r, request)
+
+	if err != nil {
+		sh.options.ResponseErrorHandlerFunc(w, r, err)
+	} else if validResponse, ok := response.(GetV0DatasetsNameLinesLineIndexResponseObject); ok {
+		if err := validResponse.VisitGetV0DatasetsNameLinesLineIndexResponse(w); err != nil {
+			sh.options.ResponseErrorHandlerFunc(w, r, err)
+		}
+	} else if response != nil {
+		sh.options.ResponseErrorHandlerFunc(w, r, fmt.Errorf("unexpected response type: %T", response))
+	}
+}
+
+// GetV0File operation middleware
+func (sh *strictHandler) GetV0File(w http.ResponseWriter, r *http.Request) {
+	var request GetV0FileRequestObject
+
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request, request interface{}) (interface{}, error) {
+		return sh.ssi.GetV0File(ctx, request.(GetV0FileRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "GetV0File")
+	}
+
+	response, err := handler(r.Context(), w, r, request)
+
+	if err != nil {
+		sh.options.ResponseErrorHandlerFunc(w, r, err)
+	} else if validResponse, ok := response.(GetV0FileResponseObject); ok {
+		if err := validResponse.VisitGetV0FileResponse(w); err != nil {
+			sh.options.ResponseErrorHandlerFunc(w, r, err)
+		}
+	} else if response != nil {
+		sh.options.ResponseErrorHandlerFunc(w, r, fmt.Errorf("unexpected response type: %T", response))
+	}
+}
+
+// GetV0Lines operation middleware
+func (sh *strictHandler) GetV0Lines(w http.ResponseWriter, r *http.Request, params GetV0LinesParams) {
+	var request GetV0LinesRequestObject
+
+	request.Params = params
+
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request, request interface{}) (interface{}, error) {
+		return sh.ssi.GetV0Lines(ctx, request.(GetV0LinesRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "GetV0Lines")
+	}
+
+	response, err := handler(r.Context(), w, r, request)
+
+	if err != nil {
+		sh.options.ResponseErrorHandlerFunc(w, r, err)
+	} else if validResponse, ok := response.(GetV0LinesResponseObject); ok {
+		if err := validResponse.VisitGetV0LinesResponse(w); err != nil {
+			sh.options.ResponseErrorHandlerFunc(w, r, err)
+		}
+	} else if response != nil {
+		sh.options.ResponseErrorHandlerFunc(w, r, fmt.Errorf("unexpected response type: %T", response))
+	}
+}
+
+// GetV0LinesStream operation middleware
+func (sh *strictHandler) GetV0LinesStream(w http.ResponseWriter, r *http.Request, params GetV0LinesStreamParams) {
+	var request GetV0LinesStreamRequestObject
+
+	request.Params = params
+
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request, request interface{}) (interface{}, error) {
+		return sh.ssi.GetV0LinesStream(ctx, request.(GetV0LinesStreamRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "GetV0LinesStream")
+	}
+
+	response, err := handler(r.Context(), w, r, request)
+
+	if err != nil {
+		sh.options.ResponseErrorHandlerFunc(w, r, err)
+	} else if validResponse, ok := response.(GetV0LinesStreamResponseObject); ok {
+		if err := validResponse.VisitGetV0LinesStreamResponse(w); err != nil {
+			sh.options.ResponseErrorHandlerFunc(w, r, err)
+		}
+	} else if response != nil {
+		sh.options.ResponseErrorHandlerFunc(w, r, fmt.Errorf("unexpected response type: %T", response))
+	}
+}
+
 // GetV0LinesLineIndex operation middleware
 func (sh *strictHandler) GetV0LinesLineIndex(w http.ResponseWriter, r *http.Request, lineIndex LineIndex) {
 	var request GetV0LinesLineIndexRequestObject
@@ -302,3 +1344,34 @@ func (sh *strictHandler) GetV0LinesLineIndex(w http.ResponseWriter, r *http.Requ
 		sh.options.ResponseErrorHandlerFunc(w, r, fmt.Errorf("unexpected response type: %T", response))
 	}
 }
+
+// PostV0LinesBatch operation middleware
+func (sh *strictHandler) PostV0LinesBatch(w http.ResponseWriter, r *http.Request) {
+	var request PostV0LinesBatchRequestObject
+
+	var body PostV0LinesBatchJSONRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sh.options.RequestErrorHandlerFunc(w, r, fmt.Errorf("can't decode JSON body: %w", err))
+		return
+	}
+	request.Body = &body
+
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request, request interface{}) (interface{}, error) {
+		return sh.ssi.PostV0LinesBatch(ctx, request.(PostV0LinesBatchRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "PostV0LinesBatch")
+	}
+
+	response, err := handler(r.Context(), w, r, request)
+
+	if err != nil {
+		sh.options.ResponseErrorHandlerFunc(w, r, err)
+	} else if validResponse, ok := response.(PostV0LinesBatchResponseObject); ok {
+		if err := validResponse.VisitPostV0LinesBatchResponse(w); err != nil {
+			sh.options.ResponseErrorHandlerFunc(w, r, err)
+		}
+	} else if response != nil {
+		sh.options.ResponseErrorHandlerFunc(w, r, fmt.Errorf("unexpected response type: %T", response))
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/pkg/errors"
+	"github.com/renanrv/line-server/pkg/dataset"
 	"github.com/renanrv/line-server/pkg/fileprocessing"
 	"github.com/renanrv/line-server/services/handler"
 	"github.com/renanrv/line-server/services/server"
@@ -13,15 +14,33 @@ import (
 )
 
 type Dependencies struct {
-	Logger           *zerolog.Logger
-	FilePath         string
-	FileIndexSummary *fileprocessing.FileIndexSummary
+	Logger   *zerolog.Logger
+	FilePath string
+	Index    *fileprocessing.IndexHolder
+	// Dataset serves the file and reloads it once it is replaced. If nil, the file is served without being reloaded.
+	Dataset        *dataset.Dataset
+	MaxLineSize    int
+	Delimiter      fileprocessing.Delimiter
+	MaxBatchSize   int
+	MaxOpenFiles   int
+	LineCacheSize  int64
+	BlockCacheSize int64
+	// Datasets holds the datasets served by name. If nil, no dataset is served by name.
+	Datasets *dataset.Registry
 }
 
 type service struct {
-	logger           *zerolog.Logger
-	filePath         string
-	fileIndexSummary *fileprocessing.FileIndexSummary
+	logger         *zerolog.Logger
+	filePath       string
+	index          *fileprocessing.IndexHolder
+	dataset        *dataset.Dataset
+	maxLineSize    int
+	delimiter      fileprocessing.Delimiter
+	maxBatchSize   int
+	maxOpenFiles   int
+	lineCacheSize  int64
+	blockCacheSize int64
+	datasets       *dataset.Registry
 }
 
 // RouterOpts represents router options
@@ -44,15 +63,38 @@ func New(d Dependencies) (Service, error) {
 		return nil, errors.New("file path is required")
 	}
 	return service{
-		logger:           d.Logger,
-		filePath:         d.FilePath,
-		fileIndexSummary: d.FileIndexSummary,
+		logger:         d.Logger,
+		filePath:       d.FilePath,
+		index:          d.Index,
+		dataset:        d.Dataset,
+		maxLineSize:    d.MaxLineSize,
+		delimiter:      d.Delimiter,
+		maxBatchSize:   d.MaxBatchSize,
+		maxOpenFiles:   d.MaxOpenFiles,
+		lineCacheSize:  d.LineCacheSize,
+		blockCacheSize: d.BlockCacheSize,
+		datasets:       d.Datasets,
 	}, nil
 }
 
 // Router returns a router configured with the quantifier service
 func (s service) Router(opts RouterOpts) (*http.ServeMux, error) {
-	h, err := handler.New(s.logger, s.filePath, s.fileIndexSummary)
+	handlerOpts := handler.Options{
+		MaxLineSize:    s.maxLineSize,
+		Delimiter:      s.delimiter,
+		MaxBatchSize:   s.maxBatchSize,
+		MaxOpenFiles:   s.maxOpenFiles,
+		LineCacheSize:  s.lineCacheSize,
+		BlockCacheSize: s.blockCacheSize,
+		Datasets:       s.datasets,
+	}
+	var h server.StrictServerInterface
+	var err error
+	if s.dataset != nil {
+		h, err = handler.NewForDataset(s.logger, s.dataset, handlerOpts)
+	} else {
+		h, err = handler.New(s.logger, s.filePath, s.index, handlerOpts)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -63,7 +105,7 @@ func (s service) Router(opts RouterOpts) (*http.ServeMux, error) {
 		BaseURL:    opts.PathPrefix,
 		BaseRouter: router,
 	}
-	hdl := server.NewStrictHandler(h, nil)
+	hdl := server.NewStrictHandler(h, []server.StrictMiddlewareFunc{handler.ScopeMiddleware(s.logger)})
 	server.HandlerWithOptions(hdl, handlerOptions)
 
 	return router, nil
@@ -4,9 +4,12 @@ package services_test
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/renanrv/line-server/pkg/dataset"
+	"github.com/renanrv/line-server/pkg/fileprocessing"
 	"github.com/renanrv/line-server/pkg/utils"
 	"github.com/renanrv/line-server/services"
 	"github.com/rs/zerolog"
@@ -103,3 +106,66 @@ func TestRouter(t *testing.T) {
 		})
 	}
 }
+
+func TestRouter_EscapedDatasetName(t *testing.T) {
+	logger := zerolog.New(nil)
+	registry := dataset.NewRegistry()
+	defer registry.Close()
+
+	file := utils.CreateTempFile(t, "line1\nline2\n")
+	defaultDataset, err := dataset.New(&logger, file.Name(), fileprocessing.NewIndexHolder(nil), dataset.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create dataset: %v", err)
+	}
+	if err := registry.Add(dataset.DefaultName, defaultDataset); err != nil {
+		t.Fatalf("Failed to add dataset: %v", err)
+	}
+	// The datasets of the files in the subdirectories of the data directory are named after their relative path
+	nestedFile := utils.CreateTempFile(t, "app line1\napp line2\n")
+	nestedDataset, err := dataset.New(&logger, nestedFile.Name(), fileprocessing.NewIndexHolder(nil), dataset.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create dataset: %v", err)
+	}
+	if err := registry.Add("logs/app.log", nestedDataset); err != nil {
+		t.Fatalf("Failed to add dataset: %v", err)
+	}
+
+	svc, err := services.New(services.Dependencies{
+		Logger:   &logger,
+		FilePath: file.Name(),
+		Dataset:  defaultDataset,
+		Datasets: registry,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create svc: %v", err)
+	}
+	router, err := svc.Router(services.RouterOpts{PathPrefix: "/api"})
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Escaped slash", path: "/api/v0/datasets/logs%2Fapp.log/lines/1", expectedStatus: http.StatusOK,
+			expectedBody: "{\"text\":\"app line2\"}\n"},
+		{name: "Unescaped slash", path: "/api/v0/datasets/logs/app.log/lines/1", expectedStatus: http.StatusNotFound},
+		{name: "Unknown dataset", path: "/api/v0/datasets/logs%2Fother.log/lines/1",
+			expectedStatus: http.StatusNotFound, expectedBody: "dataset \"logs/other.log\" not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rw.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rw.Code)
+			}
+			if tt.expectedBody != "" && rw.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, rw.Body.String())
+			}
+		})
+	}
+}